@@ -20,6 +20,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 type StorageTemplate struct {
@@ -35,6 +36,138 @@ type StorageTemplate struct {
 	Class string `json:"class,omitempty"`
 }
 
+// SnapshotIndex defines where to look up the snapshots available for the network
+type SnapshotIndex struct {
+	// url Is the URL of the JSON snapshot index, listing the available snapshots:
+	// `{"snapshots": [{"network", "fileName", "checksum", "size", "extractedSize", "blockHeight", "version"}]}`.
+	//
+	// There is no default: the pathfinder snapshot service does not publish such an index.
+	// See docs/snapshot-index.md for the schema, and config/samples/snapshots for an example.
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	URL string `json:"url"`
+
+	// version Is a semver range the pathfinder version of the snapshot must satisfy
+	// (e.g. ">=0.16.0 <0.17.0").
+	//
+	// If not set, the snapshot with the highest block for the network is used.
+	// +optional
+	Version string `json:"version,omitempty"`
+}
+
+// RestoreRetryPolicy defines how failed restore attempts are retried
+type RestoreRetryPolicy struct {
+	// maxAttempts Is the maximum number of restore jobs started before giving up
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=3
+	// +optional
+	MaxAttempts *int32 `json:"maxAttempts,omitempty"`
+
+	// initialBackoff Is the delay before the second attempt, doubled after each failure
+	// +kubebuilder:default="30s"
+	// +optional
+	InitialBackoff *metav1.Duration `json:"initialBackoff,omitempty"`
+
+	// maxBackoff Is the maximum delay between two attempts
+	// +kubebuilder:default="10m"
+	// +optional
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
+}
+
+// HTTPArchiveSource downloads the snapshot file over HTTP(S)
+type HTTPArchiveSource struct {
+	// url Is the URL of the directory holding the snapshot files, the file name is appended to it
+	// (e.g. https://mirror.example.com/pathfinder)
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +required
+	URL string `json:"url"`
+}
+
+// S3ArchiveSource downloads the snapshot file from an S3-compatible bucket
+type S3ArchiveSource struct {
+	// bucket Is the name of the bucket holding the snapshot files
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	Bucket string `json:"bucket"`
+
+	// path Is the prefix of the snapshot files in the bucket
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// endpoint Is the URL of the S3 API. If not set, the AWS endpoint of the region is used.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// region Is the region of the bucket
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// provider Is the rclone S3 provider (e.g. AWS, Cloudflare, Minio, Ceph)
+	// +kubebuilder:default=Other
+	// +optional
+	Provider string `json:"provider,omitempty"`
+
+	// credentialsSecretRef Is a secret holding the `S3_ACCESS_KEY_ID` and `S3_SECRET_ACCESS_KEY` keys.
+	//
+	// If not set, the credentials are read from the environment of the pod (e.g. IAM roles for service accounts).
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+}
+
+// GCSArchiveSource downloads the snapshot file from a Google Cloud Storage bucket
+type GCSArchiveSource struct {
+	// bucket Is the name of the bucket holding the snapshot files
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	Bucket string `json:"bucket"`
+
+	// path Is the prefix of the snapshot files in the bucket
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// credentialsSecretRef Is the key of a secret holding the JSON key of a service account.
+	//
+	// If not set, the credentials are read from the environment of the pod (e.g. Workload Identity).
+	// +optional
+	CredentialsSecretRef *corev1.SecretKeySelector `json:"credentialsSecretRef,omitempty"`
+}
+
+// PVCArchiveSource reads the snapshot file from a pre-populated volume, without downloading it
+type PVCArchiveSource struct {
+	// claimName Is the name of the claim holding the snapshot files, in the namespace of the node.
+	// It is mounted read-only, and should be ReadOnlyMany to be shared between nodes.
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	ClaimName string `json:"claimName"`
+
+	// path Is the directory holding the snapshot files in the volume
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// ArchiveSource defines where the snapshot file is downloaded from. Exactly one source must be set.
+// +kubebuilder:validation:XValidation:rule="[has(self.http), has(self.s3), has(self.gcs), has(self.pvc)].filter(x, x).size() == 1",message="exactly one source must be set"
+type ArchiveSource struct {
+	// http downloads the snapshot file from a plain HTTP(S) URL
+	// +optional
+	HTTP *HTTPArchiveSource `json:"http,omitempty"`
+
+	// s3 downloads the snapshot file from an S3-compatible bucket
+	// +optional
+	S3 *S3ArchiveSource `json:"s3,omitempty"`
+
+	// gcs downloads the snapshot file from a Google Cloud Storage bucket
+	// +optional
+	GCS *GCSArchiveSource `json:"gcs,omitempty"`
+
+	// pvc reads the snapshot file from an existing volume
+	// +optional
+	PVC *PVCArchiveSource `json:"pvc,omitempty"`
+}
+
+// +kubebuilder:validation:XValidation:rule="(has(self.enable) && !self.enable) || has(self.index) || (has(self.fileName) && has(self.checksum))",message="either index, or both fileName and checksum must be set"
+// +kubebuilder:validation:XValidation:rule="!(has(self.configSecretRef) && has(self.rsyncConfig))",message="configSecretRef and rsyncConfig are mutually exclusive"
+// +kubebuilder:validation:XValidation:rule="!has(self.source) || !(has(self.configSecretRef) || has(self.credentialsSecretRef) || has(self.rsyncConfig))",message="configSecretRef, credentialsSecretRef and rsyncConfig only apply to the default source"
 type ArchiveSnapshot struct {
 	// enable indicates if the archive restore process should be done or not.
 	//
@@ -43,16 +176,46 @@ type ArchiveSnapshot struct {
 	// +default true
 	Enable *bool `json:"enable,omitempty"`
 	// fileName Is the name of the snapshot file to restore
-	// +required
-	FileName string `json:"fileName"` // TODO(Red): Make it optional, and fetch the data from the snapshot service
+	//
+	// If not set, the snapshot is resolved from the index.
+	// +optional
+	FileName string `json:"fileName,omitempty"`
 	// checksum Is the checksum of the snapshot file to restore
-	// +required
-	Checksum string `json:"checksum"` // TODO(Red): Make it optional, and fetch the data from the snapshot service
-	// rsyncConfig Is the configuration for downloading the snapshot file
 	//
-	// If not set, the operator will use the default configuration as provided by the
+	// If not set, the snapshot is resolved from the index.
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
+	// index Is the snapshot index used to resolve the snapshot to restore,
+	// when fileName and checksum are not set.
+	// +optional
+	Index *SnapshotIndex `json:"index,omitempty"`
+	// source Is where the snapshot file is downloaded from.
+	//
+	// If not set, it is downloaded from the `pathfinder-snapshots` rclone remote (the pathfinder snapshot
+	// service by default), configured with configSecretRef or credentialsSecretRef. One of them is required:
+	// no credentials are built in, and the restore is not started without them (MissingCredentials).
+	// +optional
+	Source *ArchiveSource `json:"source,omitempty"`
+
+	// configSecretRef Is the key of a secret holding the rclone configuration used to download the
+	// snapshot file. It must define the `pathfinder-snapshots` remote.
+	//
+	// If not set, the configuration is generated from the S3 credentials of credentialsSecretRef, for the
 	// [snapshot service](https://eqlabs.github.io/pathfinder/database-snapshots#rclone-configuration)
 	// +optional
+	ConfigSecretRef *corev1.SecretKeySelector `json:"configSecretRef,omitempty"`
+
+	// credentialsSecretRef Is a secret holding the S3 credentials used to download the snapshot file,
+	// when configSecretRef is not set: `S3_ACCESS_KEY_ID` and `S3_SECRET_ACCESS_KEY`, and optionally
+	// `S3_ENDPOINT_URL`, `S3_PROVIDER` and `S3_BUCKET_NAME`.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+
+	// rsyncConfig Is the rclone configuration for downloading the snapshot file
+	//
+	// Deprecated: the configuration is readable by every user allowed to read the StarknetRPC,
+	// use configSecretRef instead.
+	// +optional
 	RsyncConfig *string `json:"rsyncConfig,omitempty"`
 
 	// restoreImage is the image going to be used for the restore process.
@@ -60,12 +223,62 @@ type ArchiveSnapshot struct {
 	// If not set, the default image as configured by the service will be used
 	// +optional
 	RestoreImage *string `json:"restoreImage,omitempty"`
+	// retryPolicy Is the policy used to retry failed restore attempts, and the failed copies of the database of restoreFrom
+	// +optional
+	RetryPolicy *RestoreRetryPolicy `json:"retryPolicy,omitempty"`
+	// jobCleanupPolicy Is what happens to the restore jobs once they finished: Delete, KeepFailed or Keep.
+	//
+	// The jobs which are kept, along with the logs of their pods, are deleted once jobTTLSecondsAfterFinished elapsed.
+	// +kubebuilder:default=KeepFailed
+	// +optional
+	JobCleanupPolicy RestoreJobCleanupPolicy `json:"jobCleanupPolicy,omitempty"`
+	// jobTTLSecondsAfterFinished Is how long the finished restore jobs are kept, 1 day by default
+	//
+	// It must leave the operator the time to record the outcome of the job, at least 1 minute.
+	// +kubebuilder:validation:Minimum=60
+	// +optional
+	JobTTLSecondsAfterFinished *int32 `json:"jobTTLSecondsAfterFinished,omitempty"`
+	// mode Is how the snapshot file is restored to the data volume
+	//
+	// Download stores the archive on the scratch volume before decompressing it, while Stream
+	// decompresses it while it is being downloaded, and checks the checksum at the end.
+	// +kubebuilder:default=Download
+	// +optional
+	Mode RestoreMode `json:"mode,omitempty"`
+
 	// storage Is the storage configuration for the snapshot restore process
 	//
-	// Note that this storage is temporary, and will be deleted after the snapshot is restored to the main storage configuration
+	// Note that this storage is temporary, and will be deleted after the snapshot is restored to the main storage configuration.
+	// It is not used by the pvc source, which reads the snapshot file in place, nor in Stream mode.
 	Storage StorageTemplate `json:"storage"`
 }
 
+// VolumeSnapshotSource references a CSI VolumeSnapshot holding the database of a node
+type VolumeSnapshotSource struct {
+	// name Is the name of the VolumeSnapshot (snapshot.storage.k8s.io), in the namespace of the node
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	Name string `json:"name"`
+}
+
+// RestoreSource defines where the data volume of the node is seeded from, instead of
+// downloading a pathfinder archive.
+// +kubebuilder:validation:XValidation:rule="has(self.volumeSnapshot) != has(self.starknetRPC)",message="exactly one restore source must be set"
+type RestoreSource struct {
+	// volumeSnapshot creates the data volume from a CSI VolumeSnapshot, through the
+	// `dataSource` of the claim. No scratch volume nor restore job is needed.
+	// +optional
+	VolumeSnapshot *VolumeSnapshotSource `json:"volumeSnapshot,omitempty"`
+
+	// starknetRPC Is the name of another node of the namespace, whose data volume is cloned.
+	//
+	// The volume is cloned by the storage driver (CSI volume cloning) when possible. Otherwise,
+	// the database is copied by a job, while the source node is briefly stopped.
+	// The source node must run on the same network, with a pathfinder version that is not newer.
+	// +optional
+	StarknetRPC string `json:"starknetRPC,omitempty"`
+}
+
 // PodMonitor defines the configuration for Prometheus monitoring
 type PodMonitor struct {
 	// enabled indicates if the PodMonitor should be created for monitoring.
@@ -79,7 +292,112 @@ type PodMonitor struct {
 	Labels map[string]string `json:"labels,omitempty"`
 }
 
+// ServiceTemplate defines the configuration of the Service exposing the RPC node
+type ServiceTemplate struct {
+	// type Is the type of the Service
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +kubebuilder:default=ClusterIP
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// labels are additional labels to add to the Service resource
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// annotations are additional annotations to add to the Service resource
+	// (e.g. to configure a cloud load balancer)
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// additionalPorts are exposed by the Service in addition to the `rpc` port,
+	// which serves both the JSON-RPC and the WebSocket APIs.
+	// +optional
+	// +listType=atomic
+	AdditionalPorts []corev1.ServicePort `json:"additionalPorts,omitempty"`
+}
+
+// ReadinessConfig defines when the node is considered ready to receive traffic
+type ReadinessConfig struct {
+	// maxBlockLag is the maximum number of blocks the node can be behind the chain head
+	// and still receive traffic from the Service.
+	//
+	// When set to 0, the node must be fully synced according to pathfinder (`/ready/synced`).
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=10
+	// +optional
+	MaxBlockLag *int64 `json:"maxBlockLag,omitempty"`
+}
+
+// WorkloadType is the kind of workload running the RPC node
+// +kubebuilder:validation:Enum=Pod;StatefulSet
+type WorkloadType string
+
+const (
+	// WorkloadTypePod runs the node in a pod managed by the operator
+	WorkloadTypePod WorkloadType = "Pod"
+	// WorkloadTypeStatefulSet runs the node in a single-replica StatefulSet, so that the rollouts,
+	// the evictions and the node drains are handled by Kubernetes
+	WorkloadTypeStatefulSet WorkloadType = "StatefulSet"
+)
+
+// UpgradeStrategyType is how a new pathfinder image is rolled out
+// +kubebuilder:validation:Enum=InPlace;BlueGreen
+type UpgradeStrategyType string
+
+const (
+	// UpgradeStrategyInPlace runs the new image on the data volume of the node
+	UpgradeStrategyInPlace UpgradeStrategyType = "InPlace"
+	// UpgradeStrategyBlueGreen runs the new image next to the node, on a clone of its data volume,
+	// and only sends the traffic to it once it caught up with the chain
+	UpgradeStrategyBlueGreen UpgradeStrategyType = "BlueGreen"
+)
+
+// UpgradePolicy defines how the node is upgraded when its image changes
+type UpgradePolicy struct {
+	// strategy Is how the new image is rolled out.
+	//
+	// The migrations of the pathfinder database are one-way: with BlueGreen, the new version runs
+	// on a clone of the data volume, and the node keeps running on its volume until the new version is ready.
+	// The storage driver must support volume cloning.
+	// +kubebuilder:default=InPlace
+	// +optional
+	Strategy UpgradeStrategyType `json:"strategy,omitempty"`
+
+	// progressDeadlineSeconds Is how long the new version has to catch up with the chain,
+	// before the upgrade is rolled back. Only used with the BlueGreen strategy.
+	// +kubebuilder:validation:Minimum=60
+	// +kubebuilder:default=7200
+	// +optional
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
+
+	// backupBeforeUpgrade backs up the database before a new image is started on it.
+	//
+	// Pathfinder migrates its database irreversibly on startup: the node keeps running the previous image
+	// until the backup is completed, and the snapshot is recorded in the status so that the node can be
+	// restored from it. If the backup fails, the node is not upgraded; delete the failed StarknetRPCBackup to retry.
+	// +optional
+	BackupBeforeUpgrade *UpgradeBackupTemplate `json:"backupBeforeUpgrade,omitempty"`
+}
+
+// UpgradeBackupTemplate defines the backup taken before an upgrade
+type UpgradeBackupTemplate struct {
+	// destination Is where the snapshot is uploaded
+	// +required
+	Destination BackupDestination `json:"destination"`
+
+	// image Is the image used to create the snapshot.
+	//
+	// If not set, the same image as the archive restore of the node is used.
+	// +optional
+	Image *string `json:"image,omitempty"`
+
+	// storage Is the scratch storage holding the compressed snapshot before its upload
+	// +required
+	Storage StorageTemplate `json:"storage"`
+}
+
 // StarknetRPCSpec defines the desired state of StarknetRPC.
+// +kubebuilder:validation:XValidation:rule="has(self.restoreArchive) || has(self.restoreFrom)",message="either restoreArchive or restoreFrom must be set"
 type StarknetRPCSpec struct {
 	// network The network the node will provide and connect to
 	// +kubebuilder:validation:MinLength=0
@@ -88,8 +406,13 @@ type StarknetRPCSpec struct {
 
 	// restoreArchive The archive snapshot restore information
 	//
-	// +required
-	RestoreArchive ArchiveSnapshot `json:"restoreArchive"`
+	// Ignored when restoreFrom is set.
+	// +optional
+	RestoreArchive ArchiveSnapshot `json:"restoreArchive,omitzero"`
+
+	// restoreFrom seeds the data volume from another source than a pathfinder archive
+	// +optional
+	RestoreFrom *RestoreSource `json:"restoreFrom,omitempty"`
 
 	// resources is the amount of resources dedicated to the StarknetRPC pod
 	//
@@ -118,6 +441,265 @@ type StarknetRPCSpec struct {
 	// podMonitor is the configuration for Prometheus monitoring via PodMonitor
 	// +optional
 	PodMonitor *PodMonitor `json:"podMonitor,omitempty"`
+
+	// service is the configuration of the Service exposing the RPC node.
+	//
+	// If not set, a ClusterIP Service exposing the `rpc` port is created.
+	// +optional
+	Service *ServiceTemplate `json:"service,omitempty"`
+
+	// readiness is the configuration of the readiness gate of the pod, used so that
+	// only the nodes that caught up with the chain receive traffic.
+	// +optional
+	Readiness *ReadinessConfig `json:"readiness,omitempty"`
+
+	// workload is the kind of workload running the node: a pod managed by the operator,
+	// or a single-replica StatefulSet mounting the data volume.
+	//
+	// Changing it stops the node, and starts it again with the new workload.
+	// +kubebuilder:default=Pod
+	// +optional
+	Workload WorkloadType `json:"workload,omitempty"`
+
+	// upgradePolicy Is how the node is upgraded when its image changes.
+	//
+	// If not set, the pod is re-created with the new image, on the same data volume.
+	// +optional
+	UpgradePolicy *UpgradePolicy `json:"upgradePolicy,omitempty"`
+}
+
+// SyncStatus is the sync progress of the node, as reported by the node itself
+type SyncStatus struct {
+	// currentBlock Is the latest block processed by the node
+	CurrentBlock int64 `json:"currentBlock"`
+
+	// highestBlock Is the highest block known by the node
+	HighestBlock int64 `json:"highestBlock"`
+
+	// lastCheckTime Is the last time the sync status was successfully fetched from the node
+	// +optional
+	LastCheckTime metav1.Time `json:"lastCheckTime,omitzero"`
+}
+
+// ResolvedSnapshot is the snapshot restored on the node
+type ResolvedSnapshot struct {
+	// fileName Is the name of the snapshot file
+	FileName string `json:"fileName"`
+
+	// checksum Is the sha256 checksum of the snapshot file
+	Checksum string `json:"checksum"`
+
+	// size Is the size of the snapshot file, in bytes
+	// +optional
+	Size int64 `json:"size,omitempty"`
+
+	// extractedSize Is the size of the database once extracted, in bytes
+	// +optional
+	ExtractedSize int64 `json:"extractedSize,omitempty"`
+
+	// blockHeight Is the latest block contained in the snapshot
+	// +optional
+	BlockHeight int64 `json:"blockHeight,omitempty"`
+
+	// version Is the pathfinder version that created the snapshot
+	// +optional
+	Version string `json:"version,omitempty"`
+}
+
+// RestoreJobCleanupPolicy is what happens to the restore jobs once they finished
+// +kubebuilder:validation:Enum=Delete;KeepFailed;Keep
+type RestoreJobCleanupPolicy string
+
+const (
+	// RestoreJobCleanupDelete deletes the finished jobs, along with the logs of their pods
+	RestoreJobCleanupDelete RestoreJobCleanupPolicy = "Delete"
+	// RestoreJobCleanupKeepFailed keeps the jobs of the failed attempts until their TTL expires
+	RestoreJobCleanupKeepFailed RestoreJobCleanupPolicy = "KeepFailed"
+	// RestoreJobCleanupKeep keeps every finished job until its TTL expires
+	RestoreJobCleanupKeep RestoreJobCleanupPolicy = "Keep"
+)
+
+// RestoreMode is how the snapshot file is restored to the data volume
+// +kubebuilder:validation:Enum=Download;Stream
+type RestoreMode string
+
+const (
+	// RestoreModeDownload downloads the archive to the scratch volume, then decompresses it
+	RestoreModeDownload RestoreMode = "Download"
+	// RestoreModeStream decompresses the archive to the data volume while it is being downloaded
+	RestoreModeStream RestoreMode = "Stream"
+)
+
+// RestorePhase is the step of a restore job, as reported by the job
+// +kubebuilder:validation:Enum=Downloading;Verifying;Extracting;Completed
+type RestorePhase string
+
+const (
+	// RestorePhaseDownloading is when the archive is downloaded (and decompressed, when streaming)
+	RestorePhaseDownloading RestorePhase = "Downloading"
+	// RestorePhaseVerifying is when the checksum of the downloaded archive is verified
+	RestorePhaseVerifying RestorePhase = "Verifying"
+	// RestorePhaseExtracting is when the archive is decompressed to the data volume
+	RestorePhaseExtracting RestorePhase = "Extracting"
+	// RestorePhaseCompleted is when the database has been restored
+	RestorePhaseCompleted RestorePhase = "Completed"
+)
+
+// CloneMethod is how the data volume of a node is cloned from another node
+// +kubebuilder:validation:Enum=Clone;Copy
+type CloneMethod string
+
+const (
+	// CloneMethodClone clones the volume through the storage driver
+	CloneMethodClone CloneMethod = "Clone"
+	// CloneMethodCopy copies the database with a job, while the source node is stopped
+	CloneMethodCopy CloneMethod = "Copy"
+)
+
+// NodeColor is one of the two sets of pod and data volume a node alternates between on blue/green upgrades
+// +kubebuilder:validation:Enum=Blue;Green
+type NodeColor string
+
+const (
+	// NodeColorBlue uses the `<name>-rpc` pod and the `<name>-storage` data volume
+	NodeColorBlue NodeColor = "Blue"
+	// NodeColorGreen uses the `<name>-rpc-green` pod and the `<name>-storage-green` data volume
+	NodeColorGreen NodeColor = "Green"
+)
+
+// UpgradePhase is the step of a blue/green upgrade
+// +kubebuilder:validation:Enum=Cloning;Syncing;Promoting;Succeeded;RolledBack
+type UpgradePhase string
+
+const (
+	// UpgradePhaseCloning is when the data volume of the node is cloned
+	UpgradePhaseCloning UpgradePhase = "Cloning"
+	// UpgradePhaseSyncing is when the new version migrates the database and catches up with the chain
+	UpgradePhaseSyncing UpgradePhase = "Syncing"
+	// UpgradePhasePromoting is when the traffic is sent to the new version, and the previous one is retired
+	UpgradePhasePromoting UpgradePhase = "Promoting"
+	// UpgradePhaseSucceeded is when the new version serves the traffic alone
+	UpgradePhaseSucceeded UpgradePhase = "Succeeded"
+	// UpgradePhaseRolledBack is when the new version did not catch up in time, and the node kept running the previous one
+	UpgradePhaseRolledBack UpgradePhase = "RolledBack"
+)
+
+// UpgradeStatus is the progress of the latest blue/green upgrade
+type UpgradeStatus struct {
+	// phase Is the step of the upgrade
+	Phase UpgradePhase `json:"phase"`
+
+	// fromImage Is the image run by the node before the upgrade
+	FromImage string `json:"fromImage"`
+
+	// toImage Is the image the node is upgraded to
+	ToImage string `json:"toImage"`
+
+	// color Is the set of pod and data volume running the new version
+	Color NodeColor `json:"color"`
+
+	// startTime Is when the upgrade started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// completionTime Is when the upgrade succeeded or was rolled back
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// message Is a human readable description of the state of the upgrade
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// UpgradeBackupStatus references the backup of the database taken before the latest upgrade
+type UpgradeBackupStatus struct {
+	// backupName Is the name of the StarknetRPCBackup
+	BackupName string `json:"backupName"`
+
+	// phase Is the phase of the backup
+	// +optional
+	Phase StarknetRPCBackupPhase `json:"phase,omitempty"`
+
+	// fromImage Is the image that wrote the backed up database, to roll back to
+	FromImage string `json:"fromImage"`
+
+	// toImage Is the image the node is upgraded to once the backup is completed
+	ToImage string `json:"toImage"`
+
+	// fileName Is the name of the uploaded snapshot file, to restore the node from when rolling back
+	// +optional
+	FileName string `json:"fileName,omitempty"`
+
+	// checksum Is the sha256 checksum of the uploaded snapshot file
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
+
+	// blockHeight Is the latest block contained in the snapshot
+	// +optional
+	BlockHeight int64 `json:"blockHeight,omitempty"`
+}
+
+// RestoreStatus is the history of the restore attempts of the node
+type RestoreStatus struct {
+	// attempts Is the number of restore jobs started
+	Attempts int32 `json:"attempts"`
+
+	// failedAttempts Is the number of restore jobs that failed
+	// +optional
+	FailedAttempts int32 `json:"failedAttempts,omitempty"`
+
+	// jobName Is the name of the job of the latest attempt
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+
+	// lastAttemptTime Is the time the latest attempt was started
+	// +optional
+	LastAttemptTime *metav1.Time `json:"lastAttemptTime,omitempty"`
+
+	// lastFailureTime Is the time the latest failure was observed
+	// +optional
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+
+	// lastFailureReason Is the termination message of the latest failed job
+	// +optional
+	LastFailureReason string `json:"lastFailureReason,omitempty"`
+
+	// cloneMethod Is how the data volume is cloned from another node: Clone (by the storage driver) or Copy (by a job)
+	// +optional
+	CloneMethod CloneMethod `json:"cloneMethod,omitempty"`
+
+	// snapshot Is the file name of the snapshot being restored
+	// +optional
+	Snapshot string `json:"snapshot,omitempty"`
+
+	// phase Is the step of the latest attempt, as reported by the restore job
+	// +optional
+	Phase RestorePhase `json:"phase,omitempty"`
+
+	// bytesDone Is the number of bytes of the archive processed in the current phase
+	// +optional
+	BytesDone int64 `json:"bytesDone,omitempty"`
+
+	// bytesTotal Is the size of the archive, if known
+	// +optional
+	BytesTotal int64 `json:"bytesTotal,omitempty"`
+
+	// startTime Is the time the first attempt was started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// lastProgressTime Is the time the restore job last reported its progress
+	// +optional
+	LastProgressTime *metav1.Time `json:"lastProgressTime,omitempty"`
+
+	// completionTime Is the time the database was restored
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// volumeUID Is the UID of the data volume claim the snapshot was restored to.
+	// A data volume with a different UID does not contain the restored database anymore.
+	// +optional
+	VolumeUID types.UID `json:"volumeUID,omitempty"`
 }
 
 // StarknetRPCStatus defines the observed state of StarknetRPC.
@@ -135,10 +717,49 @@ type StarknetRPCStatus struct {
 	// +listMapKey=type
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// sync Is the sync progress of the node
+	// +optional
+	Sync *SyncStatus `json:"sync,omitempty"`
+
+	// snapshot Is the snapshot restored on the node, once resolved
+	// +optional
+	Snapshot *ResolvedSnapshot `json:"snapshot,omitempty"`
+
+	// restore Is the history of the restore attempts
+	// +optional
+	Restore *RestoreStatus `json:"restore,omitempty"`
+
+	// observedGeneration Is the most recent generation fully reconciled by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// activeColor Is the set of pod and data volume serving the traffic, Blue if not set
+	// +optional
+	ActiveColor NodeColor `json:"activeColor,omitempty"`
+
+	// upgrade Is the progress of the latest blue/green upgrade
+	// +optional
+	Upgrade *UpgradeStatus `json:"upgrade,omitempty"`
+
+	// upgradeBackup Is the backup taken before the latest upgrade, when enabled in the upgrade policy
+	// +optional
+	UpgradeBackup *UpgradeBackupStatus `json:"upgradeBackup,omitempty"`
+
+	// lastResetToken Is the token of the last reset requested through the
+	// `pathfinder.runelabs.xyz/reset` annotation that was handled
+	// +optional
+	LastResetToken string `json:"lastResetToken,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Network",type=string,JSONPath=`.spec.network`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].reason`
+// +kubebuilder:printcolumn:name="Block",type=integer,JSONPath=`.status.sync.currentBlock`
+// +kubebuilder:printcolumn:name="Restore",type=string,JSONPath=`.status.restore.phase`,priority=1
+// +kubebuilder:printcolumn:name="Upgrade",type=string,JSONPath=`.status.upgrade.phase`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // StarknetRPC is the Schema for the starknetrpcs API.
 type StarknetRPC struct {
@@ -0,0 +1,155 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BackupDestination defines where the snapshot of a backup is uploaded
+type BackupDestination struct {
+	// rcloneConfig Is the key of a Secret holding the rclone configuration used to upload the snapshot
+	// +required
+	RcloneConfig corev1.SecretKeySelector `json:"rcloneConfig"`
+
+	// remote Is the rclone remote and path the snapshot is uploaded to (e.g. "snapshots:pathfinder/mainnet")
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	Remote string `json:"remote"`
+}
+
+// StarknetRPCBackupSpec defines the desired state of StarknetRPCBackup.
+type StarknetRPCBackupSpec struct {
+	// starknetRPC Is the StarknetRPC node to back up, in the same namespace.
+	//
+	// The node is stopped while its database is being compressed.
+	// +required
+	StarknetRPC corev1.LocalObjectReference `json:"starknetRPC"`
+
+	// destination Is where the snapshot is uploaded
+	// +required
+	Destination BackupDestination `json:"destination"`
+
+	// fileName Is the name of the snapshot file.
+	//
+	// If not set, it is named after the network and the latest block of the database
+	// (`<network>_<block>.sqlite.zst`).
+	// +optional
+	FileName string `json:"fileName,omitempty"`
+
+	// image Is the image used to create the snapshot.
+	//
+	// If not set, the same image as the archive restore of the node is used.
+	// +optional
+	Image *string `json:"image,omitempty"`
+
+	// storage Is the scratch storage holding the compressed snapshot before its upload.
+	//
+	// Should be large enough to hold the compressed database. Deleted once the backup is done.
+	// +required
+	Storage StorageTemplate `json:"storage"`
+}
+
+// StarknetRPCBackupPhase is the phase of a backup
+// +kubebuilder:validation:Enum=Pending;Quiescing;Running;Completed;Failed
+type StarknetRPCBackupPhase string
+
+const (
+	// StarknetRPCBackupPhasePending means the backup is waiting for the node to be restored, or for another backup
+	StarknetRPCBackupPhasePending StarknetRPCBackupPhase = "Pending"
+	// StarknetRPCBackupPhaseQuiescing means the node is being stopped
+	StarknetRPCBackupPhaseQuiescing StarknetRPCBackupPhase = "Quiescing"
+	// StarknetRPCBackupPhaseRunning means the backup job is compressing and uploading the database
+	StarknetRPCBackupPhaseRunning StarknetRPCBackupPhase = "Running"
+	// StarknetRPCBackupPhaseCompleted means the snapshot has been uploaded
+	StarknetRPCBackupPhaseCompleted StarknetRPCBackupPhase = "Completed"
+	// StarknetRPCBackupPhaseFailed means the backup failed, and will not be retried
+	StarknetRPCBackupPhaseFailed StarknetRPCBackupPhase = "Failed"
+)
+
+// StarknetRPCBackupStatus defines the observed state of StarknetRPCBackup.
+type StarknetRPCBackupStatus struct {
+	// phase Is the current phase of the backup
+	// +optional
+	Phase StarknetRPCBackupPhase `json:"phase,omitempty"`
+
+	// message Is a human readable description of the phase (e.g. the failure reason)
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// jobName Is the name of the job creating the snapshot
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+
+	// fileName Is the name of the uploaded snapshot file
+	// +optional
+	FileName string `json:"fileName,omitempty"`
+
+	// checksum Is the sha256 checksum of the uploaded snapshot file
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
+
+	// size Is the size of the uploaded snapshot file, in bytes
+	// +optional
+	Size int64 `json:"size,omitempty"`
+
+	// blockHeight Is the latest block contained in the snapshot
+	// +optional
+	BlockHeight int64 `json:"blockHeight,omitempty"`
+
+	// startTime Is the time the node was stopped for the backup
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// completionTime Is the time the backup completed or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Node",type=string,JSONPath=`.spec.starknetRPC.name`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Block",type=integer,JSONPath=`.status.blockHeight`
+// +kubebuilder:printcolumn:name="File",type=string,JSONPath=`.status.fileName`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// StarknetRPCBackup is the Schema for the starknetrpcbackups API.
+//
+// It stops a StarknetRPC node, compresses its database and uploads it, so that new
+// nodes can be restored from it.
+type StarknetRPCBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   StarknetRPCBackupSpec   `json:"spec,omitempty"`
+	Status StarknetRPCBackupStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// StarknetRPCBackupList contains a list of StarknetRPCBackup.
+type StarknetRPCBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitzero"`
+	Items           []StarknetRPCBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&StarknetRPCBackup{}, &StarknetRPCBackupList{})
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StarknetRPCTemplateMetadata is the metadata copied onto every node created by a StarknetRPCDeployment
+type StarknetRPCTemplateMetadata struct {
+	// labels are additional labels added to every StarknetRPC node
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// annotations are additional annotations added to every StarknetRPC node
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// StarknetRPCTemplateSpec describes the StarknetRPC nodes created by a StarknetRPCDeployment
+type StarknetRPCTemplateSpec struct {
+	// metadata Is the metadata added to every StarknetRPC node
+	// +optional
+	Metadata StarknetRPCTemplateMetadata `json:"metadata,omitzero"`
+
+	// spec Is the specification of every StarknetRPC node
+	// +required
+	Spec StarknetRPCSpec `json:"spec"`
+}
+
+// StarknetRPCDeploymentSpec defines the desired state of StarknetRPCDeployment.
+type StarknetRPCDeploymentSpec struct {
+	// replicas Is the number of StarknetRPC nodes to run
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// template Is the template used to create every StarknetRPC node
+	// +required
+	Template StarknetRPCTemplateSpec `json:"template"`
+}
+
+// StarknetRPCDeploymentStatus defines the observed state of StarknetRPCDeployment.
+type StarknetRPCDeploymentStatus struct {
+	// replicas Is the number of StarknetRPC nodes currently managed by the deployment
+	// +optional
+	Replicas int32 `json:"replicas"`
+
+	// updatedReplicas Is the number of nodes whose spec matches the current template
+	// +optional
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+
+	// readyReplicas Is the number of nodes answering requests (catching up or synced)
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas"`
+
+	// syncedReplicas Is the number of nodes that are fully synced (Available condition is true)
+	// +optional
+	SyncedReplicas int32 `json:"syncedReplicas"`
+
+	// selector Is the label selector of the managed nodes, used by the scale subresource
+	// +optional
+	Selector string `json:"selector,omitempty"`
+
+	// observedGeneration Is the most recent generation observed by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// conditions represent the current state of the StarknetRPCDeployment resource.
+	//
+	// The "Available" condition is true when at least one node is fully synced.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.spec.replicas`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+// +kubebuilder:printcolumn:name="Synced",type=integer,JSONPath=`.status.syncedReplicas`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// StarknetRPCDeployment is the Schema for the starknetrpcdeployments API.
+//
+// It manages a set of identical StarknetRPC nodes, named after the deployment
+// and their ordinal (`<name>-0`, `<name>-1`, ...).
+type StarknetRPCDeployment struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   StarknetRPCDeploymentSpec   `json:"spec,omitempty"`
+	Status StarknetRPCDeploymentStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// StarknetRPCDeploymentList contains a list of StarknetRPCDeployment.
+type StarknetRPCDeploymentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitzero"`
+	Items           []StarknetRPCDeployment `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&StarknetRPCDeployment{}, &StarknetRPCDeploymentList{})
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BackupRetentionPolicy defines which completed backups are kept.
+//
+// A backup is kept if any of the rules keeps it. Backups that are not kept are
+// deleted, along with their snapshot file on the destination.
+type BackupRetentionPolicy struct {
+	// keepLast Is the number of most recent backups to keep
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	KeepLast *int32 `json:"keepLast,omitempty"`
+
+	// keepDaily Is the number of days for which the most recent backup of the day is kept
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	KeepDaily *int32 `json:"keepDaily,omitempty"`
+
+	// keepWeekly Is the number of weeks for which the most recent backup of the week is kept
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	KeepWeekly *int32 `json:"keepWeekly,omitempty"`
+}
+
+// StarknetRPCScheduledBackupSpec defines the desired state of StarknetRPCScheduledBackup.
+type StarknetRPCScheduledBackupSpec struct {
+	// schedule Is the cron expression of the backups (e.g. "0 3 * * *"), in UTC
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	Schedule string `json:"schedule"`
+
+	// suspend stops the creation of new backups. The retention policy is still enforced.
+	// +optional
+	Suspend *bool `json:"suspend,omitempty"`
+
+	// template Is the specification of the backups created on schedule.
+	//
+	// The file name is always generated, so that backups do not overwrite each other.
+	// +required
+	Template StarknetRPCBackupSpec `json:"template"`
+
+	// retention Is the policy used to prune the old backups.
+	//
+	// If not set, every backup is kept.
+	// +optional
+	Retention *BackupRetentionPolicy `json:"retention,omitempty"`
+}
+
+// StarknetRPCScheduledBackupStatus defines the observed state of StarknetRPCScheduledBackup.
+type StarknetRPCScheduledBackupStatus struct {
+	// lastScheduleTime Is the last time a backup was scheduled
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// nextScheduleTime Is the next time a backup will be scheduled
+	// +optional
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+
+	// active Is the name of the backup currently running, if any
+	// +optional
+	Active string `json:"active,omitempty"`
+
+	// lastSuccessfulBackup Is the name of the latest completed backup
+	// +optional
+	LastSuccessfulBackup string `json:"lastSuccessfulBackup,omitempty"`
+
+	// lastSuccessfulTime Is the completion time of the latest completed backup
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+
+	// lastSuccessfulBlockHeight Is the block height of the latest completed backup
+	// +optional
+	LastSuccessfulBlockHeight int64 `json:"lastSuccessfulBlockHeight,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Node",type=string,JSONPath=`.spec.template.starknetRPC.name`
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+// +kubebuilder:printcolumn:name="Last Success",type=date,JSONPath=`.status.lastSuccessfulTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// StarknetRPCScheduledBackup is the Schema for the starknetrpcscheduledbackups API.
+//
+// It creates StarknetRPCBackups of a node on a schedule, and prunes the old ones.
+type StarknetRPCScheduledBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   StarknetRPCScheduledBackupSpec   `json:"spec,omitempty"`
+	Status StarknetRPCScheduledBackupStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// StarknetRPCScheduledBackupList contains a list of StarknetRPCScheduledBackup.
+type StarknetRPCScheduledBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitzero"`
+	Items           []StarknetRPCScheduledBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&StarknetRPCScheduledBackup{}, &StarknetRPCScheduledBackupList{})
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -42,6 +43,10 @@ import (
 
 	pathfinderv1alpha1 "github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
 	"github.com/runelabs-xyz/starknet-operators/internal/controller"
+	"github.com/runelabs-xyz/starknet-operators/internal/snapshotter"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/podlogs"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/snapshot"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -66,11 +71,18 @@ func init() {
 
 // nolint:gocyclo
 func main() {
+	// The restore jobs run the operator image with the restore subcommand
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		runRestore()
+		return
+	}
+
 	var metricsAddr string
 	var metricsCertPath, metricsCertName, metricsCertKey string
 	var webhookCertPath, webhookCertName, webhookCertKey string
 	var enableLeaderElection bool
 	var probeAddr string
+	var restorerImage string
 	var secureMetrics bool
 	var enableHTTP2 bool
 	var tlsOpts []func(*tls.Config)
@@ -91,6 +103,9 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&restorerImage, "restorer-image", os.Getenv("RESTORER_IMAGE"),
+		"If set, the archive restores run the restore subcommand of this image (the operator image) "+
+			"instead of the snapshotter script, when the snapshot source supports it.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -212,15 +227,44 @@ func main() {
 		os.Exit(1)
 	}
 
+	kubeInterface := kubernetes.NewForConfigOrDie(mgr.GetConfig())
 	if err = (&controller.StarknetRPCReconciler{
-		Interface: kubernetes.NewForConfigOrDie(mgr.GetConfig()),
-		Client:    mgr.GetClient(),
-		Scheme:    mgr.GetScheme(),
-		Recorder:  mgr.GetEventRecorderFor("starknet-rpc-controller"),
+		Interface:        kubeInterface,
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		Recorder:         mgr.GetEventRecorderFor("starknet-rpc-controller"),
+		HealthClient:     proxy.NewNodeHealthClient(kubeInterface),
+		SnapshotResolver: snapshot.NewResolver(nil),
+		RestorerImage:    restorerImage,
+		LogReader:        podlogs.NewReader(kubeInterface),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "StarknetRPC")
 		os.Exit(1)
 	}
+	if err = (&controller.StarknetRPCDeploymentReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("starknet-rpc-deployment-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "StarknetRPCDeployment")
+		os.Exit(1)
+	}
+	if err = (&controller.StarknetRPCBackupReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("starknet-rpc-backup-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "StarknetRPCBackup")
+		os.Exit(1)
+	}
+	if err = (&controller.StarknetRPCScheduledBackupReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("starknet-rpc-scheduled-backup-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "StarknetRPCScheduledBackup")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	if metricsCertWatcher != nil {
@@ -254,3 +298,12 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// runRestore restores the snapshot described by the environment of the restore job, and exits
+func runRestore() {
+	ctx := ctrl.SetupSignalHandler()
+	if err := snapshotter.RunRestore(ctx, os.Getenv, os.Stdout, snapshotter.TerminationMessagePath); err != nil {
+		fmt.Fprintf(os.Stderr, "restore failed: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,67 @@
+#!/bin/sh
+
+# This file relies on the following env variables to be set:
+# PATHFINDER_NETWORK
+# RSYNC_CONFIG: The rclone configuration, defining the remote to upload to
+# RCLONE_REMOTE: The remote (and path) to upload the snapshot to, e.g. snapshots:bucket/mainnet
+# BACKUP_FILE_NAME: Defaults to <network>_<block>.sqlite.zst
+# EXTRACT_DIR: Defaults to /scratch
+# DATA_DIR: Defaults to /data
+#
+# On success, the result is written as JSON to the termination log:
+# {"fileName": "...", "checksum": "...", "size": 123, "blockHeight": 456}
+
+set -e
+
+EXTRACT_DIR=${EXTRACT_DIR:-/scratch}
+DATA_DIR=${DATA_DIR:-/data}
+TERMINATION_LOG=${TERMINATION_LOG:-/dev/termination-log}
+DATABASE=$DATA_DIR/${PATHFINDER_NETWORK}.sqlite
+
+if [ -z "$RSYNC_CONFIG" ] || [ -z "$RCLONE_REMOTE" ]; then
+    echo "RSYNC_CONFIG and RCLONE_REMOTE must be set"
+    exit 1
+fi
+
+if [ ! -f "$DATABASE" ]; then
+    echo "Database not found at $DATABASE"
+    exit 1
+fi
+
+echo "Starting snapshot creation and upload process..."
+
+# Trap to ensure cleanup happens even if script fails
+cleanup() {
+    echo "Cleaning up scratch space..."
+    rm -rf $EXTRACT_DIR/* 2>/dev/null || true
+    rm -rf $EXTRACT_DIR/.* 2>/dev/null || true
+    echo "Scratch space cleanup completed."
+}
+trap cleanup EXIT
+
+mkdir -p $EXTRACT_DIR
+
+# Fold the write-ahead log into the database, so that the file holds everything
+echo "Checkpointing the database..."
+sqlite3 "$DATABASE" "PRAGMA wal_checkpoint(TRUNCATE);"
+
+BLOCK_HEIGHT=$(sqlite3 "$DATABASE" "SELECT COALESCE(MAX(number), 0) FROM block_headers;")
+echo "Database is at block $BLOCK_HEIGHT"
+
+FILE_NAME=${BACKUP_FILE_NAME:-${PATHFINDER_NETWORK}_${BLOCK_HEIGHT}.sqlite.zst}
+
+echo "Compressing database to $FILE_NAME..."
+zstd -T0 -q "$DATABASE" -o "$EXTRACT_DIR/$FILE_NAME"
+
+CHECKSUM=$(sha256sum "$EXTRACT_DIR/$FILE_NAME" | cut -d' ' -f1)
+SIZE=$(stat -c %s "$EXTRACT_DIR/$FILE_NAME")
+echo "Snapshot created: $SIZE bytes, checksum $CHECKSUM"
+
+echo "$RSYNC_CONFIG" > /app/rclone.conf
+
+echo "Uploading snapshot to $RCLONE_REMOTE..."
+rclone copy -P --config /app/rclone.conf "$EXTRACT_DIR/$FILE_NAME" "$RCLONE_REMOTE"
+
+echo "Snapshot upload completed successfully."
+printf '{"fileName":"%s","checksum":"%s","size":%s,"blockHeight":%s}' \
+    "$FILE_NAME" "$CHECKSUM" "$SIZE" "$BLOCK_HEIGHT" > "$TERMINATION_LOG"
@@ -0,0 +1,23 @@
+#!/bin/sh
+
+# This file relies on the following env variables to be set:
+# RSYNC_CONFIG: The rclone configuration, defining the remote holding the snapshots
+# RCLONE_REMOTE: The remote (and path) the snapshot was uploaded to, e.g. snapshots:bucket/mainnet
+# BACKUP_FILE_NAME: The snapshot file to delete
+
+set -e
+
+if [ -z "$RSYNC_CONFIG" ] || [ -z "$RCLONE_REMOTE" ] || [ -z "$BACKUP_FILE_NAME" ]; then
+    echo "RSYNC_CONFIG, RCLONE_REMOTE and BACKUP_FILE_NAME must be set"
+    exit 1
+fi
+
+echo "$RSYNC_CONFIG" > /app/rclone.conf
+
+# A file already deleted from the remote is not an error
+if rclone lsf --config /app/rclone.conf "$RCLONE_REMOTE/$BACKUP_FILE_NAME" | grep -q .; then
+    echo "Deleting $RCLONE_REMOTE/$BACKUP_FILE_NAME"
+    rclone deletefile --config /app/rclone.conf "$RCLONE_REMOTE/$BACKUP_FILE_NAME"
+else
+    echo "$RCLONE_REMOTE/$BACKUP_FILE_NAME does not exist anymore"
+fi
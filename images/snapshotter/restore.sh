@@ -1,27 +1,38 @@
 #!/bin/sh
 
+# The restore subcommand of the operator binary (internal/snapshotter) reads the same environment,
+# except for the gcs source and the rclone configuration files.
+
 # This file relies on the following env variables to be set:
-# S3_PROVIDER
-# S3_BUCKET_NAME
-# S3_ACCESS_KEY_ID
-# S3_SECRET_ACCESS_KEY
-# S3_ENDPOINT_URL
-# S3_BUCKET_NAME
 # PATHFINDER_NETWORK
 # PATHFINDER_FILE_NAME
 # PATHFINDER_CHECKSUM
 # EXTRACT_DIR: Defaults to /scratch
 # DATA_DIR: Defaults to /data
-# RSYNC_CONFIG: If set, replaces the automatically generated configuration
+# SNAPSHOT_SOURCE: Where the snapshot file is read from, defaults to rclone
+# RESTORE_MODE: download (the default) stores the archive in EXTRACT_DIR before decompressing it,
+#   stream decompresses it to DATA_DIR while it is downloaded, and checks the checksum at the end
+#
+# rclone: the file is downloaded from the `pathfinder-snapshots` remote, whose configuration is read from (in order):
+#   RCLONE_CONFIG_FILE: The path of a configuration file (e.g. mounted from a secret)
+#   RSYNC_CONFIG: The configuration itself (deprecated)
+#   Otherwise, it is generated from the S3 credentials:
+#   S3_ACCESS_KEY_ID
+#   S3_SECRET_ACCESS_KEY
+#   S3_PROVIDER: Defaults to Cloudflare
+#   S3_ENDPOINT_URL: Defaults to the endpoint of the pathfinder snapshot service
+#   S3_BUCKET_NAME: Defaults to pathfinder-snapshots
+# http: the file is downloaded from SNAPSHOT_URL
+# s3: the file is downloaded from S3_BUCKET_NAME/S3_PATH, with S3_PROVIDER, S3_ENDPOINT_URL, S3_REGION
+#   and the S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY credentials (from the environment if not set)
+# gcs: the file is downloaded from GCS_BUCKET_NAME/GCS_PATH, with the service account key
+#   GCS_CREDENTIALS_FILE (from the environment if not set)
+# pvc: the file is read in place from SNAPSHOT_DIR
 
 set -e
 
-# Default to the standard system for now
-S3_PROVIDER=${S3_PROVIDER:-Cloudflare}
-S3_BUCKET_NAME=${S3_BUCKET_NAME:-"pathfinder-snapshots"}
-S3_ACCESS_KEY_ID=${S3_ACCESS_KEY_ID:-"7635ce5752c94f802d97a28186e0c96d"}
-S3_SECRET_ACCESS_KEY=${S3_SECRET_ACCESS_KEY:-"529f8db483aae4df4e2a781b9db0c8a3a7c75c82ff70787ba2620310791c7821"}
-S3_ENDPOINT_URL=${S3_ENDPOINT_URL:-"https://cbf011119e7864a873158d83f3304e27.r2.cloudflarestorage.com"}
+SNAPSHOT_SOURCE=${SNAPSHOT_SOURCE:-rclone}
+RESTORE_MODE=${RESTORE_MODE:-download}
 
 EXTRACT_DIR=${EXTRACT_DIR:-/scratch}
 DATA_DIR=${DATA_DIR:-/data}
@@ -36,11 +47,28 @@ cleanup() {
 }
 trap cleanup EXIT
 
+# Reports the progress of the restore as a JSON line, read by the controller: report_phase <phase> [bytesTotal]
+report_phase() {
+    printf '{"phase":"%s","fileName":"%s","bytesDone":0,"bytesTotal":%s}\n' "$1" "$PATHFINDER_FILE_NAME" "${2:-0}"
+}
+
 create_config() {
     echo "Creating configuration..."
-    if [ -z "$RSYNC_CONFIG" ]; then
-        # Add your configuration creation logic here
-        tee /app/rclone.conf <<EOF
+    case "$SNAPSHOT_SOURCE" in
+    rclone)
+        # Default to the pathfinder snapshot service, the credentials must be provided
+        S3_PROVIDER=${S3_PROVIDER:-Cloudflare}
+        S3_BUCKET_NAME=${S3_BUCKET_NAME:-"pathfinder-snapshots"}
+        S3_ENDPOINT_URL=${S3_ENDPOINT_URL:-"https://cbf011119e7864a873158d83f3304e27.r2.cloudflarestorage.com"}
+        REMOTE_PATH="pathfinder-snapshots:$S3_BUCKET_NAME"
+
+        if [ -n "$RCLONE_CONFIG_FILE" ]; then
+            cp "$RCLONE_CONFIG_FILE" /app/rclone.conf
+        elif [ -n "$RSYNC_CONFIG" ]; then
+            echo "$RSYNC_CONFIG" > /app/rclone.conf
+        elif [ -n "$S3_ACCESS_KEY_ID" ] && [ -n "$S3_SECRET_ACCESS_KEY" ]; then
+            # The configuration holds the credentials, it must not be printed
+            cat > /app/rclone.conf <<EOF
 [pathfinder-snapshots]
 type = s3
 provider = $S3_PROVIDER
@@ -50,24 +78,152 @@ secret_access_key = $S3_SECRET_ACCESS_KEY
 endpoint = $S3_ENDPOINT_URL
 acl = private
 EOF
-    else
-        echo "$RSYNC_CONFIG" > /app/rclone.conf
+        else
+            echo "No rclone configuration: set RCLONE_CONFIG_FILE, RSYNC_CONFIG, or S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY"
+            exit 1
+        fi
+        ;;
+    s3)
+        REMOTE_PATH="pathfinder-snapshots:$S3_BUCKET_NAME/$S3_PATH"
+        cat > /app/rclone.conf <<EOF
+[pathfinder-snapshots]
+type = s3
+provider = ${S3_PROVIDER:-Other}
+endpoint = $S3_ENDPOINT_URL
+region = $S3_REGION
+acl = private
+EOF
+        if [ -n "$S3_ACCESS_KEY_ID" ]; then
+            cat >> /app/rclone.conf <<EOF
+env_auth = false
+access_key_id = $S3_ACCESS_KEY_ID
+secret_access_key = $S3_SECRET_ACCESS_KEY
+EOF
+        else
+            echo "env_auth = true" >> /app/rclone.conf
+        fi
+        ;;
+    gcs)
+        REMOTE_PATH="pathfinder-snapshots:$GCS_BUCKET_NAME/$GCS_PATH"
+        cat > /app/rclone.conf <<EOF
+[pathfinder-snapshots]
+type = google cloud storage
+bucket_policy_only = true
+EOF
+        if [ -n "$GCS_CREDENTIALS_FILE" ]; then
+            echo "service_account_file = $GCS_CREDENTIALS_FILE" >> /app/rclone.conf
+        else
+            echo "env_auth = true" >> /app/rclone.conf
+        fi
+        ;;
+    esac
+}
+
+# Sets ARCHIVE to the path of the snapshot file, downloading it to the scratch space if needed
+fetch_snapshot() {
+    case "$SNAPSHOT_SOURCE" in
+    rclone | s3 | gcs)
+        create_config
+        echo "Downloading snapshot: $PATHFINDER_FILE_NAME from remote server"
+        rclone copy -P --config /app/rclone.conf "${REMOTE_PATH%/}/$PATHFINDER_FILE_NAME" $EXTRACT_DIR/
+        ARCHIVE=$EXTRACT_DIR/$PATHFINDER_FILE_NAME
+        ;;
+    http)
+        echo "Downloading snapshot: $PATHFINDER_FILE_NAME from $SNAPSHOT_URL"
+        curl --fail --location --retry 5 --output "$EXTRACT_DIR/$PATHFINDER_FILE_NAME" "$SNAPSHOT_URL"
+        ARCHIVE=$EXTRACT_DIR/$PATHFINDER_FILE_NAME
+        ;;
+    pvc)
+        echo "Reading snapshot: $PATHFINDER_FILE_NAME from $SNAPSHOT_DIR"
+        ARCHIVE=$SNAPSHOT_DIR/$PATHFINDER_FILE_NAME
+        if [ ! -f "$ARCHIVE" ]; then
+            echo "Snapshot not found at $ARCHIVE"
+            exit 1
+        fi
+        ;;
+    *)
+        echo "Unknown snapshot source: $SNAPSHOT_SOURCE"
+        exit 1
+        ;;
+    esac
+}
+
+# Writes the snapshot file to the standard output, without storing it
+open_snapshot() {
+    case "$SNAPSHOT_SOURCE" in
+    rclone | s3 | gcs)
+        rclone cat --config /app/rclone.conf "${REMOTE_PATH%/}/$PATHFINDER_FILE_NAME"
+        ;;
+    http)
+        curl --fail --location --retry 5 --silent --show-error "$SNAPSHOT_URL"
+        ;;
+    pvc)
+        cat "$SNAPSHOT_DIR/$PATHFINDER_FILE_NAME"
+        ;;
+    *)
+        echo "Unknown snapshot source: $SNAPSHOT_SOURCE" >&2
+        exit 1
+        ;;
+    esac
+}
+
+# Decompresses the snapshot while it is downloaded, hashing it on the way through a fifo
+stream_snapshot() {
+    DATABASE=$DATA_DIR/${PATHFINDER_NETWORK}.sqlite
+    STREAM_DIR=$(mktemp -d)
+    mkfifo "$STREAM_DIR/archive"
+
+    # The configuration must be written before the pipe, as the standard output is the snapshot
+    case "$SNAPSHOT_SOURCE" in
+    rclone | s3 | gcs) create_config ;;
+    esac
+
+    echo "Streaming snapshot: $PATHFINDER_FILE_NAME from $SNAPSHOT_SOURCE"
+    report_phase Downloading
+    sha256sum < "$STREAM_DIR/archive" | cut -d' ' -f1 > "$STREAM_DIR/checksum" &
+    HASH_PID=$!
+
+    # Without pipefail, a failed download is recorded in a file
+    if ! { open_snapshot || touch "$STREAM_DIR/failed"; } | tee "$STREAM_DIR/archive" | zstd -d -f -o "$DATABASE" \
+        || [ -f "$STREAM_DIR/failed" ]; then
+        echo "Failed to stream the snapshot"
+        rm -f "$DATABASE"
+        exit 1
+    fi
+    wait $HASH_PID
+
+    echo "Verifying checksum..."
+    ACTUAL_CHECKSUM=$(cat "$STREAM_DIR/checksum")
+    rm -rf "$STREAM_DIR"
+
+    if [ "$ACTUAL_CHECKSUM" != "$PATHFINDER_CHECKSUM" ]; then
+        echo "Checksum mismatch! Expected: $PATHFINDER_CHECKSUM, Got: $ACTUAL_CHECKSUM"
+        # The database cannot be trusted
+        rm -f "$DATABASE"
+        exit 1
     fi
 }
 
-# Create directories
-mkdir -p $EXTRACT_DIR
 mkdir -p $DATA_DIR
 
-# Create the configuration
-create_config
+if [ "$RESTORE_MODE" = "stream" ]; then
+    stream_snapshot
+    report_phase Completed
+    echo "Snapshot extraction completed successfully."
+    echo "Database file ready at: $DATA_DIR/${PATHFINDER_NETWORK}.sqlite"
+    exit 0
+fi
+
+# Create directories
+mkdir -p $EXTRACT_DIR
 
-echo "Downloading snapshot: $PATHFINDER_FILE_NAME from remote server"
-echo "Disk usage before download:"
-rclone copy -P --config /app/rclone.conf pathfinder-snapshots:$S3_BUCKET_NAME/$PATHFINDER_FILE_NAME $EXTRACT_DIR/
+report_phase Downloading
+fetch_snapshot
+ARCHIVE_SIZE=$(wc -c < "$ARCHIVE" | tr -d ' ')
 
 echo "Verifying checksum..."
-ACTUAL_CHECKSUM=$(sha256sum /scratch/$PATHFINDER_FILE_NAME | cut -d' ' -f1)
+report_phase Verifying "$ARCHIVE_SIZE"
+ACTUAL_CHECKSUM=$(sha256sum "$ARCHIVE" | cut -d' ' -f1)
 
 if [ "$ACTUAL_CHECKSUM" != "$PATHFINDER_CHECKSUM" ]; then
 echo "Checksum mismatch! Expected: $PATHFINDER_CHECKSUM, Got: $ACTUAL_CHECKSUM"
@@ -75,7 +231,10 @@ exit 1
 fi
 
 echo "Checksum verified. Extracting snapshot..."
-zstd -d /scratch/$PATHFINDER_FILE_NAME -o $DATA_DIR/${PATHFINDER_NETWORK}.sqlite
+report_phase Extracting "$ARCHIVE_SIZE"
+# Overwrite the database left by a previous attempt
+zstd -d -f "$ARCHIVE" -o $DATA_DIR/${PATHFINDER_NETWORK}.sqlite
+report_phase Completed
 
 echo "Snapshot extraction completed successfully."
 echo "Database file ready at: $DATA_DIR/${PATHFINDER_NETWORK}.sqlite"
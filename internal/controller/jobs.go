@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// maxFailureReasonLength is the maximum length of a job failure reason recorded in a status
+const maxFailureReasonLength = 1024
+
+// getJobTerminatedContainers returns the terminated containers of the pods of the job
+func getJobTerminatedContainers(ctx context.Context, c client.Reader, job *batchv1.Job) ([]corev1.ContainerStateTerminated, error) {
+	pods := &corev1.PodList{}
+	err := c.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	var terminated []corev1.ContainerStateTerminated
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated != nil {
+				terminated = append(terminated, *status.State.Terminated)
+			}
+		}
+	}
+	return terminated, nil
+}
+
+// getJobResult returns the termination message of the successful container of the job
+func getJobResult(ctx context.Context, c client.Reader, job *batchv1.Job) (string, error) {
+	terminated, err := getJobTerminatedContainers(ctx, c, job)
+	if err != nil {
+		return "", err
+	}
+
+	for _, state := range terminated {
+		if state.ExitCode == 0 {
+			return strings.TrimSpace(state.Message), nil
+		}
+	}
+	return "", fmt.Errorf("no successful container found for job %s", job.Name)
+}
+
+// getJobFailureReason returns the termination message of the failed container of the job,
+// falling back to the failure condition of the job itself
+func getJobFailureReason(ctx context.Context, c client.Reader, job *batchv1.Job) string {
+	terminated, err := getJobTerminatedContainers(ctx, c, job)
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("Failed to list the pods of the job", "job", job.Name, "error", err)
+	}
+
+	for _, state := range terminated {
+		if state.ExitCode == 0 {
+			continue
+		}
+		if message := strings.TrimSpace(state.Message); message != "" {
+			return truncateFailureReason(message)
+		}
+		return fmt.Sprintf("%s (exit code %d)", state.Reason, state.ExitCode)
+	}
+
+	if cond := getJobFailedCondition(job); cond != nil {
+		return truncateFailureReason(fmt.Sprintf("%s: %s", cond.Reason, cond.Message))
+	}
+
+	return "the job failed"
+}
+
+// getJobFailedCondition returns the failure condition of the job, once it failed for good (after its retries)
+func getJobFailedCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		cond := &job.Status.Conditions[i]
+		if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+			return cond
+		}
+	}
+	return nil
+}
+
+// truncateFailureReason keeps the end of the message, where the error usually is
+func truncateFailureReason(message string) string {
+	if len(message) <= maxFailureReasonLength {
+		return message
+	}
+	return "..." + message[len(message)-maxFailureReasonLength:]
+}
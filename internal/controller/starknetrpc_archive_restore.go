@@ -3,6 +3,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
@@ -12,6 +13,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -28,21 +30,23 @@ func (r *StarknetRPCReconciler) ReconcileArchiveRestore(ctx context.Context, clu
 	// If archive is already made, return early
 	if meta.IsStatusConditionTrue(cluster.Status.Conditions, "Restore") {
 		logger.V(1).Info("Archive already made, cleaning up")
-		// Delete the job if it still exists
-		restoreJob := r.GetWantedRestoreJob(cluster)
-
-		deletePropagation := metav1.DeletePropagationBackground
-
-		err := r.Delete(ctx, &restoreJob, &client.DeleteOptions{
-			PropagationPolicy: &deletePropagation,
-		})
-		if client.IgnoreNotFound(err) != nil {
-			return nil, err
+		// Delete the job if it still exists, unless it is kept until its TTL expires
+		if getRestoreJobCleanupPolicy(cluster) != v1alpha1.RestoreJobCleanupKeep {
+			restoreJob := r.GetWantedRestoreJob(cluster)
+
+			deletePropagation := metav1.DeletePropagationBackground
+
+			err := r.Delete(ctx, &restoreJob, &client.DeleteOptions{
+				PropagationPolicy: &deletePropagation,
+			})
+			if client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
 		}
 
 		// Also Delete the PVC if it still exists
 		restorePvc := r.GetWantedRestorePvc(cluster)
-		err = r.Delete(ctx, &restorePvc)
+		err := r.Delete(ctx, &restorePvc)
 		if client.IgnoreNotFound(err) != nil {
 			return nil, err
 		}
@@ -50,6 +54,14 @@ func (r *StarknetRPCReconciler) ReconcileArchiveRestore(ctx context.Context, clu
 		return &ctrl.Result{}, nil
 	}
 
+	// The data volume is seeded by the storage provisioner, there is no archive to download
+	if getVolumeSnapshotSource(cluster) != nil {
+		return r.ReconcileVolumeSnapshotRestore(ctx, cluster)
+	}
+	if getCloneSource(cluster) != "" {
+		return r.ReconcileCloneRestore(ctx, cluster)
+	}
+
 	// If archive is not needed, return early
 	if cluster.Spec.RestoreArchive.Enable != nil && !*cluster.Spec.RestoreArchive.Enable {
 		logger.V(1).Info("Archive restore not enabled")
@@ -60,29 +72,49 @@ func (r *StarknetRPCReconciler) ReconcileArchiveRestore(ctx context.Context, clu
 		return &ctrl.Result{}, nil
 	}
 
-	// Create PVC (if it not already exists)
-	restorePvc := r.GetWantedRestorePvc(cluster)
-	if err := r.Create(ctx, &restorePvc); err != nil && !apierrs.IsAlreadyExists(err) {
-		return nil, err
+	// Check that the snapshot file can be downloaded before starting anything
+	result, err := r.CheckRestoreCredentials(ctx, cluster)
+	if err != nil {
+		return result, err
 	}
 
-	// Fetch the PVC
-	if err := r.Get(ctx, types.NamespacedName{Name: restorePvc.Name, Namespace: restorePvc.Namespace}, &restorePvc); err != nil {
-		if apierrs.IsNotFound(err) {
-			return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
-		}
-		logger.V(1).Error(err, "Error while fetching PVC")
-		return nil, err
+	// Pin the snapshot to restore
+	result, err = r.ResolveSnapshot(ctx, cluster)
+	if err != nil {
+		return result, err
 	}
 
-	if !isReady(&restorePvc) {
-		logger.V(1).Info("Archive PVC is not ready yet", "pvc", restorePvc.Name)
+	// Check that the volumes are large enough before downloading anything
+	result, err = r.CheckRestoreStorage(ctx, cluster)
+	if err != nil {
+		return result, err
+	}
 
-		return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+	// Create the scratch PVC (if it not already exists), unless the snapshot file is read in place or streamed
+	if needsScratchVolume(cluster) {
+		restorePvc := r.GetWantedRestorePvc(cluster)
+		if err := r.Create(ctx, &restorePvc); err != nil && !apierrs.IsAlreadyExists(err) {
+			return nil, err
+		}
+
+		// Fetch the PVC
+		if err := r.Get(ctx, types.NamespacedName{Name: restorePvc.Name, Namespace: restorePvc.Namespace}, &restorePvc); err != nil {
+			if apierrs.IsNotFound(err) {
+				return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+			}
+			logger.V(1).Error(err, "Error while fetching PVC")
+			return nil, err
+		}
+
+		if !isReady(&restorePvc) {
+			logger.V(1).Info("Archive PVC is not ready yet", "pvc", restorePvc.Name)
+
+			return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+		}
 	}
 
 	// Also validate that the base PVC is ready
-	result, err := r.EnsurePvcReady(ctx, cluster)
+	result, err = r.EnsurePvcReady(ctx, cluster)
 	if err != nil {
 		if err == errs.ErrNextLoop {
 			logger.V(1).Info("Base PVC is not ready yet")
@@ -93,17 +125,17 @@ func (r *StarknetRPCReconciler) ReconcileArchiveRestore(ctx context.Context, clu
 		return nil, err
 	}
 
-	// We can now create the job that is going to restore.
-	// Create PVC (if it not already exists)
+	// We can now start the job that is going to restore, unless the latest attempt failed
+	restore := getRestoreStatus(cluster)
+	if restore.Attempts == 0 || restore.FailedAttempts >= restore.Attempts {
+		return r.StartRestoreAttempt(ctx, cluster)
+	}
+
+	// Re-create the job of the current attempt if it went missing
 	restoreJob := r.GetWantedRestoreJob(cluster)
 	err = r.Create(ctx, &restoreJob)
 	if err == nil {
-		logger.V(1).Info("Created restore job")
-		err := condition.SetPhases(ctx, r.Client, cluster, markRestoreAsProgressing)
-		if err != nil {
-			return nil, err
-		}
-		// We just created the job, so early exit
+		logger.Info("Re-created the missing restore job", "job", restoreJob.Name)
 		return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
 	} else if !apierrs.IsAlreadyExists(err) {
 		return nil, err
@@ -116,25 +148,31 @@ func (r *StarknetRPCReconciler) ReconcileArchiveRestore(ctx context.Context, clu
 	}
 
 	if restoreJob.Status.Succeeded > 0 {
-		// Mark the job as completed
-		err := condition.SetPhases(ctx, r.Client, cluster, markArchiveAsFinished)
-		if err != nil {
+		// Tie the data volume to the restored snapshot
+		var pvc corev1.PersistentVolumeClaim
+		if err := r.Get(ctx, r.GetStoragePvcName(cluster), &pvc); err != nil {
+			return nil, err
+		}
+		if err := r.recordRestoredVolume(ctx, cluster, &pvc); err != nil {
 			return nil, err
 		}
 
-		// We just created the job, so early exit
-		return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
-	} else if restoreJob.Status.Failed > 0 {
-		logger.V(1).Info("Restore failed!")
 		// Mark the job as completed
-		err := condition.SetPhases(ctx, r.Client, cluster, markRestoreAsFailed)
+		err := condition.SetPhases(ctx, r.Client, cluster, markArchiveAsFinished, markRestoreProgressAsCompleted)
 		if err != nil {
 			return nil, err
 		}
+
 		// We completed the archive! Let's re-run the loop to continue the setup
-		return nil, errs.ErrTerminateLoop
+		return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+	} else if restoreJob.Status.Failed > 0 {
+		logger.V(1).Info("Restore failed!", "attempt", restore.Attempts)
+		return r.RecordRestoreFailure(ctx, cluster, &restoreJob)
 	} else {
 		logger.V(1).Info("Restore still in progress, waiting for completion")
+		if err := r.ReconcileRestoreProgress(ctx, cluster, &restoreJob); err != nil {
+			return nil, err
+		}
 		// Re-schedule after 30 seconds
 		// The process takes multiple minutes, so we don't want to schedule as frequently
 		return &ctrl.Result{RequeueAfter: time.Duration(30) * time.Second}, errs.ErrNextLoop
@@ -142,6 +180,98 @@ func (r *StarknetRPCReconciler) ReconcileArchiveRestore(ctx context.Context, clu
 
 }
 
+// CheckRestoreStorage checks, when the size of the snapshot is known, that the scratch volume can hold
+// twice the archive (download + decompression buffers), and that the data volume can hold the extracted
+// database (or at least the archive, if the extracted size is unknown).
+func (r *StarknetRPCReconciler) CheckRestoreStorage(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	snapshot := getRestoredSnapshot(cluster)
+	if snapshot.Size == 0 {
+		logger.V(1).Info("Snapshot size is unknown, skipping the storage preflight check")
+		return &ctrl.Result{}, nil
+	}
+
+	var problems []string
+
+	scratch := cluster.Spec.RestoreArchive.Storage.Size
+	scratchRequired := resource.NewQuantity(2*snapshot.Size, resource.BinarySI)
+	if needsScratchVolume(cluster) && scratch.Cmp(*scratchRequired) < 0 {
+		problems = append(problems, fmt.Sprintf("the scratch volume (%s) must be at least twice the size of the archive (%s)",
+			scratch.String(), scratchRequired.String()))
+	}
+
+	dataSize := snapshot.ExtractedSize
+	if dataSize == 0 {
+		dataSize = snapshot.Size
+	}
+	data := cluster.Spec.Storage.Size
+	dataRequired := resource.NewQuantity(dataSize, resource.BinarySI)
+	if data.Cmp(*dataRequired) < 0 {
+		problems = append(problems, fmt.Sprintf("the data volume (%s) cannot hold the extracted database (%s)",
+			data.String(), dataRequired.String()))
+	}
+
+	if len(problems) == 0 {
+		return &ctrl.Result{}, nil
+	}
+
+	message := fmt.Sprintf("Not enough storage to restore snapshot %s: %s", snapshot.FileName, strings.Join(problems, ", "))
+	logger.Info("Restore preflight check failed", "reason", message)
+	r.Recorder.Event(cluster, "Warning", "InsufficientStorage", message)
+	if err := condition.SetPhases(ctx, r.Client, cluster, markRestoreAsInsufficientStorage(message)); err != nil {
+		return nil, err
+	}
+
+	// Wait for the storage configuration to be updated
+	return &ctrl.Result{}, errs.ErrNextLoop
+}
+
+// CheckRestoreCredentials refuses to start the restore from the default source when no credentials are configured.
+//
+// The snapshot service requires credentials: the restore job would fail on every attempt without them.
+func (r *StarknetRPCReconciler) CheckRestoreCredentials(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	if hasArchiveCredentials(cluster) {
+		return &ctrl.Result{}, nil
+	}
+
+	message := "No credentials to download the snapshot from the snapshot service: " +
+		"set restoreArchive.credentialsSecretRef or restoreArchive.configSecretRef"
+	// Only reported when the restore starts waiting for them
+	if getRestoreReason(cluster) != "MissingCredentials" {
+		log.FromContext(ctx).Info("Restore preflight check failed", "reason", message)
+		r.Recorder.Event(cluster, "Warning", "MissingCredentials", message)
+		if err := condition.SetPhases(ctx, r.Client, cluster, markRestoreAsMissingCredentials(message)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Wait for the credentials to be configured
+	return &ctrl.Result{}, errs.ErrNextLoop
+}
+
+func markRestoreAsMissingCredentials(message string) condition.StateTransition {
+	return func(cluster *v1alpha1.StarknetRPC) {
+		meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+			Type:    "Restore",
+			Status:  metav1.ConditionFalse,
+			Reason:  "MissingCredentials",
+			Message: message,
+		})
+	}
+}
+
+func markRestoreAsInsufficientStorage(message string) condition.StateTransition {
+	return func(cluster *v1alpha1.StarknetRPC) {
+		meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+			Type:    "Restore",
+			Status:  metav1.ConditionFalse,
+			Reason:  "InsufficientStorage",
+			Message: message,
+		})
+	}
+}
+
 func markArchiveAsFinished(cluster *v1alpha1.StarknetRPC) {
 	// Modify the state
 	meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
@@ -152,13 +282,15 @@ func markArchiveAsFinished(cluster *v1alpha1.StarknetRPC) {
 	})
 }
 
-func markRestoreAsFailed(cluster *v1alpha1.StarknetRPC) {
-	meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
-		Type:    "Restore",
-		Status:  metav1.ConditionFalse,
-		Reason:  "ArchiveJobFailed",
-		Message: "The archive restore job has failed",
-	})
+func markRestoreAsFailed(message string) condition.StateTransition {
+	return func(cluster *v1alpha1.StarknetRPC) {
+		meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+			Type:    "Restore",
+			Status:  metav1.ConditionFalse,
+			Reason:  "ArchiveJobFailed",
+			Message: message,
+		})
+	}
 }
 
 func markRestoreAsSkipped(cluster *v1alpha1.StarknetRPC) {
@@ -179,22 +311,49 @@ func markRestoreAsProgressing(cluster *v1alpha1.StarknetRPC) {
 	})
 }
 
+// GetRestoreJobName returns the name of the job of the current restore attempt
 func (r *StarknetRPCReconciler) GetRestoreJobName(cluster *v1alpha1.StarknetRPC) types.NamespacedName {
 	return types.NamespacedName{
-		Name:      fmt.Sprintf("%s-archive-restore-job", cluster.Name),
+		Name:      getRestoreJobName(cluster, getRestoreStatus(cluster).Attempts),
 		Namespace: cluster.Namespace,
 	}
 }
 
+func getRestoreJobName(cluster *v1alpha1.StarknetRPC, attempt int32) string {
+	return fmt.Sprintf("%s-archive-restore-%d", cluster.Name, attempt)
+}
+
+const (
+	// rcloneConfigMountPath is where the secret holding the rclone configuration is mounted in the restore job
+	rcloneConfigMountPath = "/etc/rclone"
+	// rcloneConfigFileName is the name of the rclone configuration file in rcloneConfigMountPath
+	rcloneConfigFileName = "rclone.conf"
+)
+
+// defaultSnapshotterImage is the image running the restore, backup and prune scripts of images/snapshotter
+const defaultSnapshotterImage = "ghcr.io/runelabsxyz/pathfinder-snapshotter:latest"
+
 func getImage(snapshot *v1alpha1.ArchiveSnapshot) string {
 	if snapshot.RestoreImage == nil {
-		return "ghcr.io/runelabsxyz/pathfinder-snapshotter:latest"
+		return defaultSnapshotterImage
 	} else {
 		return *snapshot.RestoreImage
 	}
 }
 
+// getRestoredSnapshot returns the snapshot to restore, as resolved in the status (or configured in the spec)
+func getRestoredSnapshot(cluster *v1alpha1.StarknetRPC) v1alpha1.ResolvedSnapshot {
+	if cluster.Status.Snapshot != nil {
+		return *cluster.Status.Snapshot
+	}
+	return v1alpha1.ResolvedSnapshot{
+		FileName: cluster.Spec.RestoreArchive.FileName,
+		Checksum: cluster.Spec.RestoreArchive.Checksum,
+	}
+}
+
 func getEnvVars(cluster *v1alpha1.StarknetRPC) []corev1.EnvVar {
+	snapshot := getRestoredSnapshot(cluster)
 	envVars := []corev1.EnvVar{
 		{
 			Name:  "PATHFINDER_NETWORK",
@@ -202,81 +361,172 @@ func getEnvVars(cluster *v1alpha1.StarknetRPC) []corev1.EnvVar {
 		},
 		{
 			Name:  "PATHFINDER_FILE_NAME",
-			Value: cluster.Spec.RestoreArchive.FileName,
+			Value: snapshot.FileName,
 		},
 		{
 			Name:  "PATHFINDER_CHECKSUM",
-			Value: cluster.Spec.RestoreArchive.Checksum,
+			Value: snapshot.Checksum,
+		},
+	}
+
+	envVars = append(envVars, getSourceEnvVars(cluster, snapshot.FileName)...)
+
+	return envVars
+}
+
+// getRestoreVolumes returns the volumes of the restore job: the data volume, the scratch volume
+// (unless the snapshot file is read in place), and the volumes needed to read the snapshot file
+func (r *StarknetRPCReconciler) getRestoreVolumes(cluster *v1alpha1.StarknetRPC) ([]corev1.Volume, []corev1.VolumeMount) {
+	volumes := []corev1.Volume{
+		{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: r.GetStoragePvcName(cluster).Name,
+				},
+			},
+		},
+	}
+	mounts := []corev1.VolumeMount{
+		{
+			Name:      "data",
+			MountPath: "/data",
 		},
 	}
 
-	if cluster.Spec.RestoreArchive.RsyncConfig != nil {
-		envVars = append(envVars, corev1.EnvVar{
-			Name:  "PATHFINDER_DOWNLOAD_URL",
-			Value: *cluster.Spec.RestoreArchive.RsyncConfig,
+	if needsScratchVolume(cluster) {
+		volumes = append(volumes, corev1.Volume{
+			Name: "snapshot-scratch",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: r.GetRestorePvcName(cluster).Name,
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      "snapshot-scratch",
+			MountPath: "/scratch",
 		})
 	}
 
-	return envVars
+	sourceVolumes, sourceMounts := getSourceVolumes(cluster)
+	volumes = append(volumes, sourceVolumes...)
+	mounts = append(mounts, sourceMounts...)
+
+	return volumes, mounts
 }
 
 func (r *StarknetRPCReconciler) GetWantedRestoreJob(cluster *v1alpha1.StarknetRPC) batchv1.Job {
 
 	nameInfo := r.GetRestoreJobName(cluster)
+	volumes, volumeMounts := r.getRestoreVolumes(cluster)
+	labels := getRestoreJobLabels(cluster)
 	job := batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Labels:      make(map[string]string),
+			Labels:      labels,
 			Annotations: make(map[string]string),
 			Name:        nameInfo.Name,
 			Namespace:   nameInfo.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion:         v1alpha1.GroupVersion.String(),
+					Kind:               "StarknetRPC",
+					Name:               cluster.Name,
+					UID:                cluster.UID,
+					Controller:         &[]bool{true}[0],
+					BlockOwnerDeletion: &[]bool{true}[0],
+				},
+			},
 		},
 		Spec: batchv1.JobSpec{
+			// Failures are retried by the operator, with a new job for each attempt
+			BackoffLimit:            &[]int32{0}[0],
+			TTLSecondsAfterFinished: getRestoreJobTTL(cluster),
 			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
 				Spec: corev1.PodSpec{
-					// TODO: Handle failures ourselves
 					RestartPolicy: corev1.RestartPolicyNever,
 					Containers: []corev1.Container{
 						{
-							Name:  "archive-downloader",
-							Image: getImage(&cluster.Spec.RestoreArchive),
-							Env:   getEnvVars(cluster),
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "snapshot-scratch",
-									MountPath: "/scratch",
-								},
-								{
-									Name:      "data",
-									MountPath: "/data",
-								},
-							},
-						},
-					},
-					Volumes: []corev1.Volume{
-						{
-							Name: "data",
-							VolumeSource: corev1.VolumeSource{
-								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-									ClaimName: r.GetStoragePvcName(cluster).Name,
-								},
-							},
-						},
-						{
-							Name: "snapshot-scratch",
-							VolumeSource: corev1.VolumeSource{
-								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-									ClaimName: r.GetRestorePvcName(cluster).Name,
-								},
-							},
+							Name:    restoreContainerName,
+							Image:   getImage(&cluster.Spec.RestoreArchive),
+							Env:     getEnvVars(cluster),
+							EnvFrom: getEnvFromSources(cluster),
+							// The end of the logs is used as the failure reason of the attempt
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							VolumeMounts:             volumeMounts,
 						},
 					},
+					Volumes: volumes,
 				},
 			},
 		},
 	}
+
+	if r.useRestoreCommand(cluster) {
+		container := &job.Spec.Template.Spec.Containers[0]
+		container.Image = r.RestorerImage
+		container.Command = []string{"/manager", "restore"}
+		// The operator image runs as non-root, while the data volume is written as root by the snapshotter image
+		container.SecurityContext = &corev1.SecurityContext{
+			RunAsUser:    &[]int64{0}[0],
+			RunAsNonRoot: &[]bool{false}[0],
+		}
+	}
 	return job
 }
 
+func getRestoreJobLabels(cluster *v1alpha1.StarknetRPC) map[string]string {
+	return map[string]string{
+		"rpc.runelabs.xyz/type": "starknet",
+		"rpc.runelabs.xyz/name": cluster.Name,
+		"runelabs.xyz/network":  cluster.Spec.Network,
+	}
+}
+
+const (
+	// defaultRestoreJobTTL is how long the finished restore jobs are kept by default, in seconds
+	defaultRestoreJobTTL int32 = 24 * 60 * 60
+	// minRestoreJobTTL is how long the finished restore jobs are kept at least, in seconds: a job deleted
+	// before its outcome is recorded would be run again, as if it went missing
+	minRestoreJobTTL int32 = 60
+)
+
+// getRestoreJobTTL returns how long the finished restore jobs are kept
+func getRestoreJobTTL(cluster *v1alpha1.StarknetRPC) *int32 {
+	if ttl := cluster.Spec.RestoreArchive.JobTTLSecondsAfterFinished; ttl != nil {
+		// Set before the minimum was validated
+		return &[]int32{max(*ttl, minRestoreJobTTL)}[0]
+	}
+	return &[]int32{defaultRestoreJobTTL}[0]
+}
+
+func getRestoreJobCleanupPolicy(cluster *v1alpha1.StarknetRPC) v1alpha1.RestoreJobCleanupPolicy {
+	if cluster.Spec.RestoreArchive.JobCleanupPolicy == "" {
+		return v1alpha1.RestoreJobCleanupKeepFailed
+	}
+	return cluster.Spec.RestoreArchive.JobCleanupPolicy
+}
+
+// useRestoreCommand returns true if the restore job runs the restore subcommand of the operator image,
+// which does not support the gcs source nor rclone configurations
+func (r *StarknetRPCReconciler) useRestoreCommand(cluster *v1alpha1.StarknetRPC) bool {
+	if r.RestorerImage == "" || cluster.Spec.RestoreArchive.RestoreImage != nil {
+		return false
+	}
+
+	switch getArchiveSourceType(cluster) {
+	case archiveSourceHTTP, archiveSourceS3, archiveSourcePVC:
+		return true
+	case archiveSourceRclone:
+		return cluster.Spec.RestoreArchive.ConfigSecretRef == nil && cluster.Spec.RestoreArchive.RsyncConfig == nil
+	default:
+		return false
+	}
+}
+
 func (r *StarknetRPCReconciler) GetRestorePvcName(cluster *v1alpha1.StarknetRPC) types.NamespacedName {
 	return types.NamespacedName{
 		Name:      fmt.Sprintf("%s-archive-restore", cluster.Name),
@@ -307,10 +557,10 @@ func (r *StarknetRPCReconciler) GetWantedRestorePvc(cluster *v1alpha1.StarknetRP
 			AccessModes: []corev1.PersistentVolumeAccessMode{
 				corev1.ReadWriteOnce,
 			},
-			StorageClassName: &cluster.Spec.Storage.Class,
+			StorageClassName: getStorageClassName(&cluster.Spec.RestoreArchive.Storage),
 			Resources: corev1.VolumeResourceRequirements{
 				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: cluster.Spec.Storage.Size,
+					corev1.ResourceStorage: cluster.Spec.RestoreArchive.Storage.Size,
 				},
 			},
 		},
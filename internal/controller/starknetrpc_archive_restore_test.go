@@ -0,0 +1,529 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/podlogs"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPC archive restore", func() {
+	Context("When preparing the volumes of the restore", func() {
+		const (
+			resourceName = "test-starknet-rpc-restore"
+			namespace    = "default"
+			network      = "mainnet"
+		)
+
+		var (
+			ctx         context.Context
+			starknetRPC *v1alpha1.StarknetRPC
+			reconciler  *StarknetRPCReconciler
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			starknetRPC.Spec.RestoreArchive.Enable = &[]bool{true}[0]
+			starknetRPC.Spec.RestoreArchive.Storage.Class = "scratch-class"
+			createTestStarknetRPC(ctx, starknetRPC)
+
+			reconciler = &StarknetRPCReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
+			}
+		})
+
+		AfterEach(func() {
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		setSnapshot := func(size, extractedSize int64) {
+			starknetRPC.Status.Snapshot = &v1alpha1.ResolvedSnapshot{
+				FileName:      "test-snapshot.tar",
+				Checksum:      "test-checksum",
+				Size:          size,
+				ExtractedSize: extractedSize,
+			}
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).To(Succeed())
+		}
+
+		It("Should use the restore storage template for the scratch volume", func() {
+			pvc := reconciler.GetWantedRestorePvc(starknetRPC)
+
+			Expect(pvc.Spec.Resources.Requests[corev1.ResourceStorage]).To(Equal(resource.MustParse("10Gi")))
+			Expect(pvc.Spec.StorageClassName).To(Equal(&[]string{"scratch-class"}[0]))
+
+			// The data volume uses the default storage class
+			Expect(reconciler.GetWantedPvc(starknetRPC).Spec.StorageClassName).To(BeNil())
+		})
+
+		It("Should skip the preflight check when the snapshot size is unknown", func() {
+			_, err := reconciler.CheckRestoreStorage(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should accept volumes large enough for the snapshot", func() {
+			setSnapshot(4<<30, 90<<30)
+
+			_, err := reconciler.CheckRestoreStorage(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should refuse a scratch volume smaller than twice the archive", func() {
+			setSnapshot(6<<30, 0)
+
+			_, err := reconciler.CheckRestoreStorage(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			restore := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Restore")
+			Expect(restore).NotTo(BeNil())
+			Expect(restore.Status).To(Equal(metav1.ConditionFalse))
+			Expect(restore.Reason).To(Equal("InsufficientStorage"))
+			Expect(restore.Message).To(ContainSubstring("scratch volume"))
+		})
+
+		It("Should refuse a data volume too small for the extracted database", func() {
+			setSnapshot(4<<30, 120<<30)
+
+			_, err := reconciler.CheckRestoreStorage(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			restore := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Restore")
+			Expect(restore.Reason).To(Equal("InsufficientStorage"))
+			Expect(restore.Message).To(ContainSubstring("data volume"))
+		})
+
+		It("Should not start the restore from the snapshot service without credentials", func() {
+			_, err := reconciler.CheckRestoreCredentials(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			restore := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Restore")
+			Expect(restore).NotTo(BeNil())
+			Expect(restore.Status).To(Equal(metav1.ConditionFalse))
+			Expect(restore.Reason).To(Equal("MissingCredentials"))
+
+			// The missing credentials are only reported once
+			recorder := reconciler.Recorder.(*record.FakeRecorder)
+			Expect(recorder.Events).To(HaveLen(1))
+			_, err = reconciler.CheckRestoreCredentials(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(recorder.Events).To(HaveLen(1))
+
+			starknetRPC.Spec.RestoreArchive.CredentialsSecretRef = &corev1.LocalObjectReference{Name: "snapshots-credentials"}
+			_, err = reconciler.CheckRestoreCredentials(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			// The other sources carry their own credentials
+			starknetRPC.Spec.RestoreArchive.CredentialsSecretRef = nil
+			starknetRPC.Spec.RestoreArchive.Source = &v1alpha1.ArchiveSource{
+				HTTP: &v1alpha1.HTTPArchiveSource{URL: "https://snapshots.example.com/mainnet"},
+			}
+			_, err = reconciler.CheckRestoreCredentials(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should mount the rclone configuration secret in the restore job", func() {
+			starknetRPC.Spec.RestoreArchive.ConfigSecretRef = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "snapshots-rclone-config"},
+				Key:                  "config",
+			}
+
+			job := reconciler.GetWantedRestoreJob(starknetRPC)
+			container := job.Spec.Template.Spec.Containers[0]
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "RCLONE_CONFIG_FILE", Value: "/etc/rclone/rclone.conf"}))
+			Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "rclone-config", MountPath: "/etc/rclone", ReadOnly: true}))
+
+			volume := job.Spec.Template.Spec.Volumes[2]
+			Expect(volume.Secret.SecretName).To(Equal("snapshots-rclone-config"))
+			Expect(volume.Secret.Items).To(Equal([]corev1.KeyToPath{{Key: "config", Path: "rclone.conf"}}))
+		})
+
+		It("Should expose the S3 credentials secret to the restore job", func() {
+			starknetRPC.Spec.RestoreArchive.CredentialsSecretRef = &corev1.LocalObjectReference{Name: "snapshots-credentials"}
+
+			container := reconciler.GetWantedRestoreJob(starknetRPC).Spec.Template.Spec.Containers[0]
+			Expect(container.EnvFrom).To(HaveLen(1))
+			Expect(container.EnvFrom[0].SecretRef.Name).To(Equal("snapshots-credentials"))
+		})
+
+		It("Should forward the deprecated inline configuration as RSYNC_CONFIG", func() {
+			starknetRPC.Spec.RestoreArchive.RsyncConfig = &[]string{"[pathfinder-snapshots]"}[0]
+
+			container := reconciler.GetWantedRestoreJob(starknetRPC).Spec.Template.Spec.Containers[0]
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "RSYNC_CONFIG", Value: "[pathfinder-snapshots]"}))
+		})
+
+		It("Should refuse both the inline configuration and the configuration secret", func() {
+			invalid := starknetRPC.DeepCopy()
+			invalid.ObjectMeta = metav1.ObjectMeta{Name: resourceName + "-invalid", Namespace: namespace}
+			invalid.Spec.RestoreArchive.RsyncConfig = &[]string{"[pathfinder-snapshots]"}[0]
+			invalid.Spec.RestoreArchive.ConfigSecretRef = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "snapshots-rclone-config"},
+				Key:                  "config",
+			}
+			Expect(k8sClient.Create(ctx, invalid)).NotTo(Succeed())
+		})
+
+		It("Should download the snapshot from an HTTP(S) mirror", func() {
+			starknetRPC.Spec.RestoreArchive.Source = &v1alpha1.ArchiveSource{
+				HTTP: &v1alpha1.HTTPArchiveSource{URL: "https://mirror.example.com/pathfinder/"},
+			}
+
+			container := reconciler.GetWantedRestoreJob(starknetRPC).Spec.Template.Spec.Containers[0]
+			Expect(container.Env).To(ContainElements(
+				corev1.EnvVar{Name: "SNAPSHOT_SOURCE", Value: "http"},
+				corev1.EnvVar{Name: "SNAPSHOT_URL", Value: "https://mirror.example.com/pathfinder/test-snapshot.tar"},
+			))
+		})
+
+		It("Should download the snapshot from an S3-compatible bucket", func() {
+			starknetRPC.Spec.RestoreArchive.Source = &v1alpha1.ArchiveSource{
+				S3: &v1alpha1.S3ArchiveSource{
+					Bucket:               "snapshots",
+					Path:                 "mainnet",
+					Endpoint:             "https://minio.example.com",
+					CredentialsSecretRef: &corev1.LocalObjectReference{Name: "minio-credentials"},
+				},
+			}
+
+			container := reconciler.GetWantedRestoreJob(starknetRPC).Spec.Template.Spec.Containers[0]
+			Expect(container.Env).To(ContainElements(
+				corev1.EnvVar{Name: "SNAPSHOT_SOURCE", Value: "s3"},
+				corev1.EnvVar{Name: "S3_BUCKET_NAME", Value: "snapshots"},
+				corev1.EnvVar{Name: "S3_PATH", Value: "mainnet"},
+				corev1.EnvVar{Name: "S3_ENDPOINT_URL", Value: "https://minio.example.com"},
+				corev1.EnvVar{Name: "S3_PROVIDER", Value: "Other"},
+			))
+			Expect(container.EnvFrom[0].SecretRef.Name).To(Equal("minio-credentials"))
+		})
+
+		It("Should download the snapshot from a GCS bucket", func() {
+			starknetRPC.Spec.RestoreArchive.Source = &v1alpha1.ArchiveSource{
+				GCS: &v1alpha1.GCSArchiveSource{
+					Bucket: "snapshots",
+					CredentialsSecretRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "gcs-service-account"},
+						Key:                  "key.json",
+					},
+				},
+			}
+
+			job := reconciler.GetWantedRestoreJob(starknetRPC)
+			container := job.Spec.Template.Spec.Containers[0]
+			Expect(container.Env).To(ContainElements(
+				corev1.EnvVar{Name: "SNAPSHOT_SOURCE", Value: "gcs"},
+				corev1.EnvVar{Name: "GCS_BUCKET_NAME", Value: "snapshots"},
+				corev1.EnvVar{Name: "GCS_CREDENTIALS_FILE", Value: "/etc/gcs/credentials.json"},
+			))
+			Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "gcs-credentials", MountPath: "/etc/gcs", ReadOnly: true}))
+		})
+
+		It("Should read the snapshot in place from an existing volume", func() {
+			starknetRPC.Spec.RestoreArchive.Source = &v1alpha1.ArchiveSource{
+				PVC: &v1alpha1.PVCArchiveSource{ClaimName: "snapshots-mirror", Path: "mainnet"},
+			}
+			Expect(needsScratchVolume(starknetRPC)).To(BeFalse())
+
+			job := reconciler.GetWantedRestoreJob(starknetRPC)
+			container := job.Spec.Template.Spec.Containers[0]
+			Expect(container.Env).To(ContainElements(
+				corev1.EnvVar{Name: "SNAPSHOT_SOURCE", Value: "pvc"},
+				corev1.EnvVar{Name: "SNAPSHOT_DIR", Value: "/snapshots/mainnet"},
+			))
+			Expect(container.VolumeMounts).To(ConsistOf(
+				corev1.VolumeMount{Name: "data", MountPath: "/data"},
+				corev1.VolumeMount{Name: "snapshot-source", MountPath: "/snapshots", ReadOnly: true},
+			))
+			Expect(job.Spec.Template.Spec.Volumes[1].PersistentVolumeClaim.ClaimName).To(Equal("snapshots-mirror"))
+
+			// The scratch volume is not needed
+			setSnapshot(60<<30, 90<<30)
+			_, err := reconciler.CheckRestoreStorage(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should stream the snapshot to the data volume without a scratch volume", func() {
+			starknetRPC.Spec.RestoreArchive.Mode = v1alpha1.RestoreModeStream
+			Expect(needsScratchVolume(starknetRPC)).To(BeFalse())
+
+			container := reconciler.GetWantedRestoreJob(starknetRPC).Spec.Template.Spec.Containers[0]
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "RESTORE_MODE", Value: "stream"}))
+			Expect(container.VolumeMounts).To(ConsistOf(corev1.VolumeMount{Name: "data", MountPath: "/data"}))
+
+			// Only the data volume must hold the database
+			setSnapshot(60<<30, 90<<30)
+			_, err := reconciler.CheckRestoreStorage(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should run the restore subcommand of the operator image when configured", func() {
+			reconciler.RestorerImage = "ghcr.io/runelabsxyz/starknet-operators:latest"
+			starknetRPC.Spec.RestoreArchive.Source = &v1alpha1.ArchiveSource{
+				HTTP: &v1alpha1.HTTPArchiveSource{URL: "https://mirror.example.com/pathfinder/"},
+			}
+
+			container := reconciler.GetWantedRestoreJob(starknetRPC).Spec.Template.Spec.Containers[0]
+			Expect(container.Image).To(Equal("ghcr.io/runelabsxyz/starknet-operators:latest"))
+			Expect(container.Command).To(Equal([]string{"/manager", "restore"}))
+
+			// The GCS source is only supported by the snapshotter image
+			starknetRPC.Spec.RestoreArchive.Source = &v1alpha1.ArchiveSource{
+				GCS: &v1alpha1.GCSArchiveSource{Bucket: "snapshots"},
+			}
+			container = reconciler.GetWantedRestoreJob(starknetRPC).Spec.Template.Spec.Containers[0]
+			Expect(container.Image).To(Equal(defaultSnapshotterImage))
+			Expect(container.Command).To(BeEmpty())
+		})
+
+		It("Should refuse more than one source", func() {
+			invalid := starknetRPC.DeepCopy()
+			invalid.ObjectMeta = metav1.ObjectMeta{Name: resourceName + "-invalid", Namespace: namespace}
+			invalid.Spec.RestoreArchive.Source = &v1alpha1.ArchiveSource{
+				HTTP: &v1alpha1.HTTPArchiveSource{URL: "https://mirror.example.com/pathfinder"},
+				PVC:  &v1alpha1.PVCArchiveSource{ClaimName: "snapshots-mirror"},
+			}
+			Expect(k8sClient.Create(ctx, invalid)).NotTo(Succeed())
+		})
+	})
+
+	Context("When retrying failed restores", func() {
+		const (
+			resourceName = "test-starknet-rpc-restore-retry"
+			namespace    = "default"
+			network      = "mainnet"
+		)
+
+		var (
+			ctx         context.Context
+			starknetRPC *v1alpha1.StarknetRPC
+			reconciler  *StarknetRPCReconciler
+		)
+
+		failJob := func(name string) *batchv1.Job {
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, job)).To(Succeed())
+			now := metav1.Now()
+			job.Status.StartTime = &now
+			job.Status.Failed = 1
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+			return job
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			starknetRPC.Spec.RestoreArchive.Enable = &[]bool{true}[0]
+			starknetRPC.Spec.RestoreArchive.RetryPolicy = &v1alpha1.RestoreRetryPolicy{
+				MaxAttempts:    &[]int32{2}[0],
+				InitialBackoff: &metav1.Duration{Duration: time.Millisecond},
+			}
+			createTestStarknetRPC(ctx, starknetRPC)
+
+			reconciler = &StarknetRPCReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(20),
+			}
+		})
+
+		AfterEach(func() {
+			deletePropagation := metav1.DeletePropagationBackground
+			for attempt := int32(1); attempt <= 2; attempt++ {
+				_ = k8sClient.Delete(ctx, &batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{Name: getRestoreJobName(starknetRPC, attempt), Namespace: namespace},
+				}, &client.DeleteOptions{PropagationPolicy: &deletePropagation})
+			}
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should start a uniquely named job for each attempt", func() {
+			_, err := reconciler.StartRestoreAttempt(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			Expect(starknetRPC.Status.Restore).NotTo(BeNil())
+			Expect(starknetRPC.Status.Restore.Attempts).To(Equal(int32(1)))
+			Expect(starknetRPC.Status.Restore.JobName).To(Equal(resourceName + "-archive-restore-1"))
+			Expect(starknetRPC.Status.Restore.LastAttemptTime).NotTo(BeNil())
+
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-archive-restore-1", Namespace: namespace}, job)).To(Succeed())
+			Expect(*job.Spec.BackoffLimit).To(Equal(int32(0)))
+			Expect(job.Spec.Template.Spec.Containers[0].TerminationMessagePolicy).To(Equal(corev1.TerminationMessageFallbackToLogsOnError))
+		})
+
+		It("Should record the failure and retry with a new job", func() {
+			_, err := reconciler.StartRestoreAttempt(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			job := failJob(resourceName + "-archive-restore-1")
+			_, err = reconciler.RecordRestoreFailure(ctx, starknetRPC, job)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			Expect(starknetRPC.Status.Restore.FailedAttempts).To(Equal(int32(1)))
+			Expect(starknetRPC.Status.Restore.LastFailureTime).NotTo(BeNil())
+			Expect(starknetRPC.Status.Restore.LastFailureReason).NotTo(BeEmpty())
+			restore := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Restore")
+			Expect(restore.Reason).To(Equal("ArchiveJobFailed"))
+			Expect(restore.Message).To(ContainSubstring("1/2"))
+
+			time.Sleep(10 * time.Millisecond)
+			_, err = reconciler.StartRestoreAttempt(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(starknetRPC.Status.Restore.Attempts).To(Equal(int32(2)))
+			Expect(starknetRPC.Status.Restore.JobName).To(Equal(resourceName + "-archive-restore-2"))
+		})
+
+		It("Should stop retrying after the maximum number of attempts", func() {
+			for attempt := 1; attempt <= 2; attempt++ {
+				time.Sleep(10 * time.Millisecond)
+				_, err := reconciler.StartRestoreAttempt(ctx, starknetRPC)
+				Expect(err).To(Equal(errs.ErrNextLoop))
+
+				job := failJob(fmt.Sprintf("%s-archive-restore-%d", resourceName, attempt))
+				_, err = reconciler.RecordRestoreFailure(ctx, starknetRPC, job)
+				Expect(err).To(Equal(errs.ErrNextLoop))
+			}
+
+			result, err := reconciler.StartRestoreAttempt(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(starknetRPC.Status.Restore.Attempts).To(Equal(int32(2)))
+		})
+
+		It("Should back off exponentially between attempts", func() {
+			starknetRPC.Spec.RestoreArchive.RetryPolicy = &v1alpha1.RestoreRetryPolicy{
+				InitialBackoff: &metav1.Duration{Duration: 30 * time.Second},
+				MaxBackoff:     &metav1.Duration{Duration: 100 * time.Second},
+			}
+
+			Expect(getRestoreBackoff(starknetRPC, 1)).To(Equal(30 * time.Second))
+			Expect(getRestoreBackoff(starknetRPC, 2)).To(Equal(60 * time.Second))
+			Expect(getRestoreBackoff(starknetRPC, 3)).To(Equal(100 * time.Second))
+			Expect(getRestoreBackoff(starknetRPC, 10)).To(Equal(100 * time.Second))
+		})
+
+		It("Should keep the finished restore jobs long enough to record their outcome", func() {
+			starknetRPC.Spec.RestoreArchive.JobTTLSecondsAfterFinished = &[]int32{0}[0]
+			Expect(*getRestoreJobTTL(starknetRPC)).To(Equal(minRestoreJobTTL))
+
+			starknetRPC.Spec.RestoreArchive.JobTTLSecondsAfterFinished = &[]int32{3600}[0]
+			Expect(*getRestoreJobTTL(starknetRPC)).To(Equal(int32(3600)))
+		})
+
+		It("Should own and label the restore job, and expire it once finished", func() {
+			_, err := reconciler.StartRestoreAttempt(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-archive-restore-1", Namespace: namespace}, job)).To(Succeed())
+			Expect(job.OwnerReferences).To(HaveLen(1))
+			Expect(job.OwnerReferences[0].Kind).To(Equal("StarknetRPC"))
+			Expect(job.OwnerReferences[0].UID).To(Equal(starknetRPC.UID))
+			Expect(*job.OwnerReferences[0].Controller).To(BeTrue())
+			Expect(job.Labels).To(HaveKeyWithValue("rpc.runelabs.xyz/name", resourceName))
+			Expect(job.Spec.Template.Labels).To(HaveKeyWithValue("rpc.runelabs.xyz/name", resourceName))
+			Expect(*job.Spec.TTLSecondsAfterFinished).To(Equal(defaultRestoreJobTTL))
+		})
+
+		It("Should keep the jobs of the failed attempts by default", func() {
+			_, err := reconciler.StartRestoreAttempt(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			_, err = reconciler.RecordRestoreFailure(ctx, starknetRPC, failJob(resourceName+"-archive-restore-1"))
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			time.Sleep(10 * time.Millisecond)
+			_, err = reconciler.StartRestoreAttempt(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-archive-restore-1", Namespace: namespace}, job)).To(Succeed())
+		})
+
+		It("Should delete the jobs of the failed attempts with the Delete policy", func() {
+			starknetRPC.Spec.RestoreArchive.JobCleanupPolicy = v1alpha1.RestoreJobCleanupDelete
+
+			_, err := reconciler.StartRestoreAttempt(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			_, err = reconciler.RecordRestoreFailure(ctx, starknetRPC, failJob(resourceName+"-archive-restore-1"))
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			time.Sleep(10 * time.Millisecond)
+			_, err = reconciler.StartRestoreAttempt(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			job := &batchv1.Job{}
+			err = k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-archive-restore-1", Namespace: namespace}, job)
+			Expect(apierrs.IsNotFound(err) || job.DeletionTimestamp != nil).To(BeTrue())
+		})
+
+		It("Should report the progress of the running restore job in the status", func() {
+			_, err := reconciler.StartRestoreAttempt(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(starknetRPC.Status.Restore.Snapshot).To(Equal("test-snapshot.tar"))
+			Expect(starknetRPC.Status.Restore.StartTime).NotTo(BeNil())
+
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-archive-restore-1", Namespace: namespace}, job)).To(Succeed())
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName + "-archive-restore-1-pod",
+					Namespace: namespace,
+					Labels:    map[string]string{batchv1.JobNameLabel: job.Name},
+				},
+				Spec: *job.Spec.Template.Spec.DeepCopy(),
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			DeferCleanup(func() { _ = k8sClient.Delete(ctx, pod) })
+			pod.Status.Phase = corev1.PodRunning
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+
+			logReader := podlogs.NewFakeReader()
+			logReader.SetLogs(pod.Name, `Starting snapshot download and extraction process...
+{"phase":"Downloading","fileName":"test-snapshot.tar","bytesDone":0,"bytesTotal":1000}
+{"phase":"Downloading","fileName":"test-snapshot.tar","bytesDone":400,"bytesTotal":1000}
+Transferred: 400 B / 1000 B, 40%
+`)
+			reconciler.LogReader = logReader
+
+			Expect(reconciler.ReconcileRestoreProgress(ctx, starknetRPC, job)).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			Expect(starknetRPC.Status.Restore.Phase).To(Equal(v1alpha1.RestorePhaseDownloading))
+			Expect(starknetRPC.Status.Restore.BytesDone).To(Equal(int64(400)))
+			Expect(starknetRPC.Status.Restore.BytesTotal).To(Equal(int64(1000)))
+			Expect(starknetRPC.Status.Restore.LastProgressTime).NotTo(BeNil())
+			Expect(starknetRPC.Status.Restore.CompletionTime).To(BeNil())
+
+			// The progress is not lost when the logs cannot be read
+			logReader.Err = fmt.Errorf("container is terminated")
+			Expect(reconciler.ReconcileRestoreProgress(ctx, starknetRPC, job)).To(Succeed())
+			Expect(starknetRPC.Status.Restore.BytesDone).To(Equal(int64(400)))
+
+			markRestoreProgressAsCompleted(starknetRPC)
+			Expect(starknetRPC.Status.Restore.Phase).To(Equal(v1alpha1.RestorePhaseCompleted))
+			Expect(starknetRPC.Status.Restore.BytesDone).To(Equal(int64(1000)))
+			Expect(starknetRPC.Status.Restore.CompletionTime).NotTo(BeNil())
+		})
+	})
+})
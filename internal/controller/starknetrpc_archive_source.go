@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"path"
+	"strings"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The source types understood by the restore script, through SNAPSHOT_SOURCE
+const (
+	archiveSourceRclone = "rclone"
+	archiveSourceHTTP   = "http"
+	archiveSourceS3     = "s3"
+	archiveSourceGCS    = "gcs"
+	archiveSourcePVC    = "pvc"
+)
+
+const (
+	// gcsCredentialsMountPath is where the service account key of the GCS source is mounted in the restore job
+	gcsCredentialsMountPath = "/etc/gcs"
+	// gcsCredentialsFileName is the name of the service account key in gcsCredentialsMountPath
+	gcsCredentialsFileName = "credentials.json"
+	// snapshotSourceMountPath is where the volume of the PVC source is mounted in the restore job
+	snapshotSourceMountPath = "/snapshots"
+)
+
+// getArchiveSourceType returns the type of the source the snapshot file is read from
+func getArchiveSourceType(cluster *v1alpha1.StarknetRPC) string {
+	source := cluster.Spec.RestoreArchive.Source
+	switch {
+	case source == nil:
+		return archiveSourceRclone
+	case source.HTTP != nil:
+		return archiveSourceHTTP
+	case source.S3 != nil:
+		return archiveSourceS3
+	case source.GCS != nil:
+		return archiveSourceGCS
+	case source.PVC != nil:
+		return archiveSourcePVC
+	default:
+		return archiveSourceRclone
+	}
+}
+
+// hasArchiveCredentials returns false when the snapshot file is downloaded from the default source,
+// the snapshot service, without any configuration nor credentials
+func hasArchiveCredentials(cluster *v1alpha1.StarknetRPC) bool {
+	archive := cluster.Spec.RestoreArchive
+	if getArchiveSourceType(cluster) != archiveSourceRclone {
+		return true
+	}
+	return archive.ConfigSecretRef != nil || archive.CredentialsSecretRef != nil || archive.RsyncConfig != nil
+}
+
+// getRestoreMode returns how the snapshot file is restored, defaulting to Download
+func getRestoreMode(cluster *v1alpha1.StarknetRPC) v1alpha1.RestoreMode {
+	if cluster.Spec.RestoreArchive.Mode == "" {
+		return v1alpha1.RestoreModeDownload
+	}
+	return cluster.Spec.RestoreArchive.Mode
+}
+
+// needsScratchVolume returns false when the snapshot file is read in place or streamed,
+// without being downloaded first
+func needsScratchVolume(cluster *v1alpha1.StarknetRPC) bool {
+	return getArchiveSourceType(cluster) != archiveSourcePVC && getRestoreMode(cluster) != v1alpha1.RestoreModeStream
+}
+
+// getSourceEnvVars returns the environment variables telling the restore script where to read the snapshot file from
+func getSourceEnvVars(cluster *v1alpha1.StarknetRPC, fileName string) []corev1.EnvVar {
+	sourceType := getArchiveSourceType(cluster)
+	envVars := []corev1.EnvVar{
+		{
+			Name:  "SNAPSHOT_SOURCE",
+			Value: sourceType,
+		},
+		{
+			Name:  "RESTORE_MODE",
+			Value: strings.ToLower(string(getRestoreMode(cluster))),
+		},
+	}
+
+	source := cluster.Spec.RestoreArchive.Source
+	switch sourceType {
+	case archiveSourceRclone:
+		if cluster.Spec.RestoreArchive.ConfigSecretRef != nil {
+			envVars = append(envVars, corev1.EnvVar{
+				Name:  "RCLONE_CONFIG_FILE",
+				Value: rcloneConfigMountPath + "/" + rcloneConfigFileName,
+			})
+		} else if cluster.Spec.RestoreArchive.RsyncConfig != nil {
+			envVars = append(envVars, corev1.EnvVar{
+				Name:  "RSYNC_CONFIG",
+				Value: *cluster.Spec.RestoreArchive.RsyncConfig,
+			})
+		}
+	case archiveSourceHTTP:
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "SNAPSHOT_URL",
+			Value: strings.TrimSuffix(source.HTTP.URL, "/") + "/" + fileName,
+		})
+	case archiveSourceS3:
+		envVars = append(envVars,
+			corev1.EnvVar{Name: "S3_BUCKET_NAME", Value: source.S3.Bucket},
+			corev1.EnvVar{Name: "S3_PATH", Value: source.S3.Path},
+			corev1.EnvVar{Name: "S3_ENDPOINT_URL", Value: source.S3.Endpoint},
+			corev1.EnvVar{Name: "S3_REGION", Value: source.S3.Region},
+			corev1.EnvVar{Name: "S3_PROVIDER", Value: getS3Provider(source.S3)},
+		)
+	case archiveSourceGCS:
+		envVars = append(envVars,
+			corev1.EnvVar{Name: "GCS_BUCKET_NAME", Value: source.GCS.Bucket},
+			corev1.EnvVar{Name: "GCS_PATH", Value: source.GCS.Path},
+		)
+		if source.GCS.CredentialsSecretRef != nil {
+			envVars = append(envVars, corev1.EnvVar{
+				Name:  "GCS_CREDENTIALS_FILE",
+				Value: gcsCredentialsMountPath + "/" + gcsCredentialsFileName,
+			})
+		}
+	case archiveSourcePVC:
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "SNAPSHOT_DIR",
+			Value: path.Join(snapshotSourceMountPath, source.PVC.Path),
+		})
+	}
+
+	return envVars
+}
+
+func getS3Provider(source *v1alpha1.S3ArchiveSource) string {
+	if source.Provider == "" {
+		return "Other"
+	}
+	return source.Provider
+}
+
+// getEnvFromSources returns the secrets exposed as environment variables to the restore job
+func getEnvFromSources(cluster *v1alpha1.StarknetRPC) []corev1.EnvFromSource {
+	credentials := cluster.Spec.RestoreArchive.CredentialsSecretRef
+	if source := cluster.Spec.RestoreArchive.Source; source != nil && source.S3 != nil {
+		credentials = source.S3.CredentialsSecretRef
+	}
+	if credentials == nil {
+		return nil
+	}
+
+	return []corev1.EnvFromSource{
+		{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: *credentials,
+			},
+		},
+	}
+}
+
+// getSourceVolumes returns the volumes of the restore job needed to read the snapshot file:
+// the rclone configuration or GCS credentials stored in a secret, or the volume holding the file
+func getSourceVolumes(cluster *v1alpha1.StarknetRPC) ([]corev1.Volume, []corev1.VolumeMount) {
+	var (
+		volumes []corev1.Volume
+		mounts  []corev1.VolumeMount
+	)
+
+	addSecret := func(name string, ref *corev1.SecretKeySelector, mountPath string, fileName string) {
+		volumes = append(volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: ref.Name,
+					Items: []corev1.KeyToPath{
+						{
+							Key:  ref.Key,
+							Path: fileName,
+						},
+					},
+					Optional: ref.Optional,
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: mountPath,
+			ReadOnly:  true,
+		})
+	}
+
+	source := cluster.Spec.RestoreArchive.Source
+	switch getArchiveSourceType(cluster) {
+	case archiveSourceRclone:
+		if ref := cluster.Spec.RestoreArchive.ConfigSecretRef; ref != nil {
+			addSecret("rclone-config", ref, rcloneConfigMountPath, rcloneConfigFileName)
+		}
+	case archiveSourceGCS:
+		if ref := source.GCS.CredentialsSecretRef; ref != nil {
+			addSecret("gcs-credentials", ref, gcsCredentialsMountPath, gcsCredentialsFileName)
+		}
+	case archiveSourcePVC:
+		volumes = append(volumes, corev1.Volume{
+			Name: "snapshot-source",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: source.PVC.ClaimName,
+					ReadOnly:  true,
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      "snapshot-source",
+			MountPath: snapshotSourceMountPath,
+			ReadOnly:  true,
+		})
+	}
+
+	return volumes, mounts
+}
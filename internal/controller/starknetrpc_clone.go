@@ -0,0 +1,521 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blang/semver/v4"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// ClonedFromAnnotation is set on the data volume, with the name of the node it was cloned from
+	ClonedFromAnnotation = "pathfinder.runelabs.xyz/cloned-from"
+
+	// cloneQuiescePrefix prefixes the quiesce annotation set on a node whose database is being copied
+	cloneQuiescePrefix = "starknetrpc/"
+	// cloneTimeout is how long the storage driver has to clone the volume, before falling back to a copy
+	cloneTimeout = 5 * time.Minute
+	// clonePollInterval is the interval between two checks of a clone in progress
+	clonePollInterval = 10 * time.Second
+)
+
+// CheckCloneSource checks that the node to clone the data volume from can be used, before the
+// data volume is created: it must be restored, run the same network, with a pathfinder version that
+// is not newer, and its volume must fit in the data volume.
+//
+// The volume is copied by a job when the storage classes differ, as CSI cloning is only
+// supported within a storage class.
+func (r *StarknetRPCReconciler) CheckCloneSource(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	sourceName := getCloneSource(cluster)
+	source := &v1alpha1.StarknetRPC{}
+	err := r.Get(ctx, types.NamespacedName{Name: sourceName, Namespace: cluster.Namespace}, source)
+	if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+
+	var waiting string
+	if apierrs.IsNotFound(err) {
+		waiting = fmt.Sprintf("StarknetRPC %s not found", sourceName)
+	} else if !meta.IsStatusConditionTrue(source.Status.Conditions, string(starknetrpc.StarknetRPCRestoreCondition)) {
+		waiting = fmt.Sprintf("The database of StarknetRPC %s is not restored yet", sourceName)
+	}
+	if waiting != "" {
+		logger.V(1).Info("Waiting for the clone source", "source", sourceName, "reason", waiting)
+		if err := condition.SetPhases(ctx, r.Client, cluster, markRestoreAsWaitingForSource(waiting)); err != nil {
+			return nil, err
+		}
+		return &ctrl.Result{RequeueAfter: 30 * time.Second}, errs.ErrNextLoop
+	}
+
+	if err := checkCloneCompatibility(source, cluster); err != nil {
+		message := fmt.Sprintf("Cannot clone StarknetRPC %s: %s", sourceName, err)
+		logger.Info("Incompatible clone source", "source", sourceName, "reason", err)
+		r.Recorder.Event(cluster, "Warning", "IncompatibleSource", message)
+		if err := condition.SetPhases(ctx, r.Client, cluster, markRestoreAsIncompatibleSource(message)); err != nil {
+			return nil, err
+		}
+		// Wait for either node to be updated
+		return &ctrl.Result{RequeueAfter: time.Minute}, errs.ErrNextLoop
+	}
+
+	if getCloneMethod(cluster) == "" {
+		method := v1alpha1.CloneMethodClone
+		if source.Spec.Storage.Class != cluster.Spec.Storage.Class {
+			method = v1alpha1.CloneMethodCopy
+		}
+		if err := condition.SetPhases(ctx, r.Client, cluster, setCloneMethod(method)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ctrl.Result{}, nil
+}
+
+// ReconcileCloneRestore waits for the data volume to be cloned by the storage driver, or copies the
+// database of the source node with a job.
+//
+// A clone that is not bound within cloneTimeout is considered unsupported by the driver: the volume is
+// re-created empty, and the database copied instead.
+func (r *StarknetRPCReconciler) ReconcileCloneRestore(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	sourceName := getCloneSource(cluster)
+
+	var pvc corev1.PersistentVolumeClaim
+	if err := r.Get(ctx, r.GetStoragePvcName(cluster), &pvc); err != nil {
+		if apierrs.IsNotFound(err) {
+			return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+		}
+		return nil, err
+	}
+	if pvc.DeletionTimestamp != nil {
+		return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+	}
+
+	if err := r.markCloneAsRestoring(ctx, cluster, sourceName); err != nil {
+		return nil, err
+	}
+
+	// The volume was created empty: the database is copied by a job
+	if pvc.Spec.DataSource == nil {
+		if getCloneMethod(cluster) != v1alpha1.CloneMethodCopy {
+			if err := condition.SetPhases(ctx, r.Client, cluster, setCloneMethod(v1alpha1.CloneMethodCopy)); err != nil {
+				return nil, err
+			}
+		}
+		return r.reconcileCloneCopy(ctx, cluster, &pvc)
+	}
+
+	if isReady(&pvc) {
+		return r.finishClone(ctx, cluster, &pvc)
+	}
+
+	if time.Since(pvc.CreationTimestamp.Time) < cloneTimeout {
+		logger.V(1).Info("Waiting for the storage driver to clone the volume", "pvc", pvc.Name, "source", sourceName)
+		return &ctrl.Result{RequeueAfter: clonePollInterval}, errs.ErrNextLoop
+	}
+
+	message := fmt.Sprintf("The volume of StarknetRPC %s was not cloned within %s, copying the database instead", sourceName, cloneTimeout)
+	logger.Info("Volume clone timed out, falling back to a copy", "pvc", pvc.Name, "source", sourceName)
+	r.Recorder.Event(cluster, "Warning", "CloneFallback", message)
+	if err := condition.SetPhases(ctx, r.Client, cluster, setCloneMethod(v1alpha1.CloneMethodCopy)); err != nil {
+		return nil, err
+	}
+
+	// The data volume is re-created without data source
+	if err := r.Delete(ctx, &pvc); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+}
+
+// reconcileCloneCopy stops the source node, and copies its database to the data volume with a job
+func (r *StarknetRPCReconciler) reconcileCloneCopy(ctx context.Context, cluster *v1alpha1.StarknetRPC, pvc *corev1.PersistentVolumeClaim) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	source := &v1alpha1.StarknetRPC{}
+	if err := r.Get(ctx, types.NamespacedName{Name: getCloneSource(cluster), Namespace: cluster.Namespace}, source); err != nil {
+		if apierrs.IsNotFound(err) {
+			// Checked again before the volume is re-created
+			return &ctrl.Result{RequeueAfter: 30 * time.Second}, errs.ErrNextLoop
+		}
+		return nil, err
+	}
+
+	job := r.GetWantedCloneJob(cluster, source)
+	err := r.Get(ctx, client.ObjectKeyFromObject(&job), &job)
+	if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+
+	if apierrs.IsNotFound(err) {
+		// 1. Stop the source node, unless something else already holds it
+		holder := cluster.Name
+		if current := source.Annotations[QuiesceAnnotation]; current != "" && current != cloneQuiescePrefix+holder {
+			logger.V(1).Info("Waiting for the source node to be released", "source", source.Name, "holder", current)
+			return &ctrl.Result{RequeueAfter: 30 * time.Second}, errs.ErrNextLoop
+		} else if current == "" {
+			original := source.DeepCopy()
+			if source.Annotations == nil {
+				source.Annotations = make(map[string]string)
+			}
+			source.Annotations[QuiesceAnnotation] = cloneQuiescePrefix + holder
+			if err := r.Patch(ctx, source, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+				return nil, err
+			}
+			logger.Info("Stopping the source node to copy its database", "source", source.Name)
+			r.Recorder.Event(cluster, "Normal", "Quiescing", fmt.Sprintf("Stopping StarknetRPC %s", source.Name))
+		}
+
+		// 2. Wait for the source node to be stopped
+		err := r.Get(ctx, r.GetPodName(source), &corev1.Pod{})
+		if err == nil {
+			logger.V(1).Info("Waiting for the source node to be stopped", "source", source.Name)
+			return &ctrl.Result{RequeueAfter: 5 * time.Second}, errs.ErrNextLoop
+		} else if !apierrs.IsNotFound(err) {
+			return nil, err
+		}
+
+		// 3. Copy the database
+		if err := r.Create(ctx, &job); err != nil && !apierrs.IsAlreadyExists(err) {
+			return nil, err
+		}
+		logger.Info("Created the copy job", "job", job.Name)
+		r.Recorder.Event(cluster, "Normal", "CopyStarted",
+			fmt.Sprintf("Copying the database of StarknetRPC %s with job %s", source.Name, job.Name))
+		err = condition.SetPhases(ctx, r.Client, cluster, starknetrpc.StarknetRPCRestoreStatusRestoring.Apply(), func(rpc *v1alpha1.StarknetRPC) {
+			restore := getRestoreStatus(rpc).DeepCopy()
+			restore.Attempts++
+			restore.JobName = job.Name
+			now := metav1.Now()
+			restore.LastAttemptTime = &now
+			rpc.Status.Restore = restore
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &ctrl.Result{RequeueAfter: clonePollInterval}, errs.ErrNextLoop
+	}
+
+	if job.Status.Succeeded == 0 && job.Status.Failed == 0 {
+		logger.V(1).Info("Copy still in progress, waiting for completion", "job", job.Name)
+		return &ctrl.Result{RequeueAfter: clonePollInterval}, errs.ErrNextLoop
+	}
+
+	// The source node can be restarted, whatever the outcome of the copy
+	if err := releaseQuiescedNode(ctx, r.Client, source, cloneQuiescePrefix+cluster.Name); err != nil {
+		return nil, err
+	}
+
+	if job.Status.Failed > 0 {
+		return r.retryCloneCopy(ctx, cluster, source, &job)
+	}
+
+	deletePropagation := metav1.DeletePropagationBackground
+	if err := r.Delete(ctx, &job, &client.DeleteOptions{PropagationPolicy: &deletePropagation}); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+
+	return r.finishClone(ctx, cluster, pvc)
+}
+
+// retryCloneCopy records the failure of the copy job, and deletes it once the backoff of the restore retry policy
+// elapsed, which starts a new copy. The job is kept once the maximum number of attempts is reached.
+func (r *StarknetRPCReconciler) retryCloneCopy(ctx context.Context, cluster *v1alpha1.StarknetRPC, source *v1alpha1.StarknetRPC, job *batchv1.Job) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	maxAttempts := getRestoreMaxAttempts(cluster)
+	restore := getRestoreStatus(cluster)
+	// The jobs created before the attempts were counted have no attempt recorded
+	if restore.Attempts == 0 || restore.FailedAttempts < restore.Attempts {
+		reason := getJobFailureReason(ctx, r.Client, job)
+		next := restore.DeepCopy()
+		next.Attempts = max(next.Attempts, 1)
+		next.FailedAttempts = next.Attempts
+		now := metav1.Now()
+		next.LastFailureTime = &now
+		next.LastFailureReason = reason
+
+		message := fmt.Sprintf("Copy attempt %d/%d of the database of StarknetRPC %s failed: %s",
+			next.Attempts, maxAttempts, source.Name, reason)
+		if next.FailedAttempts >= maxAttempts {
+			message += fmt.Sprintf(". Not retrying until the retry policy is updated, or job %s is deleted", job.Name)
+		}
+		err := condition.SetPhases(ctx, r.Client, cluster, markCloneAsFailed(message), func(rpc *v1alpha1.StarknetRPC) {
+			rpc.Status.Restore = next
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Info("Copy failed", "job", job.Name, "attempt", next.Attempts, "reason", reason)
+		r.Recorder.Event(cluster, "Warning", "CopyFailed", message)
+		restore = next
+	}
+
+	if restore.FailedAttempts >= maxAttempts {
+		logger.V(1).Info("Copy failed too many times, not retrying", "attempts", restore.Attempts, "maxAttempts", maxAttempts)
+		return &ctrl.Result{}, errs.ErrNextLoop
+	}
+
+	if restore.LastFailureTime != nil {
+		wait := time.Until(restore.LastFailureTime.Add(getRestoreBackoff(cluster, restore.FailedAttempts)))
+		if wait > 0 {
+			logger.V(1).Info("Waiting before retrying the copy", "wait", wait)
+			return &ctrl.Result{RequeueAfter: wait}, errs.ErrNextLoop
+		}
+	}
+
+	// Deleting the job starts a new copy
+	deletePropagation := metav1.DeletePropagationBackground
+	if err := r.Delete(ctx, job, &client.DeleteOptions{PropagationPolicy: &deletePropagation}); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	logger.Info("Retrying the copy", "job", job.Name, "attempt", restore.Attempts+1, "maxAttempts", maxAttempts)
+	return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+}
+
+// finishClone ties the data volume to its source node, and marks the restore as successful
+func (r *StarknetRPCReconciler) finishClone(ctx context.Context, cluster *v1alpha1.StarknetRPC, pvc *corev1.PersistentVolumeClaim) (*ctrl.Result, error) {
+	if err := r.recordRestoredVolume(ctx, cluster, pvc); err != nil {
+		return nil, err
+	}
+
+	log.FromContext(ctx).Info("Data volume cloned", "pvc", pvc.Name, "source", getCloneSource(cluster), "method", getCloneMethod(cluster))
+	r.Recorder.Event(cluster, "Normal", "RestoreFinished",
+		fmt.Sprintf("Data volume cloned from StarknetRPC %s", getCloneSource(cluster)))
+	if err := condition.SetPhases(ctx, r.Client, cluster, starknetrpc.StarknetRPCRestoreStatusSuccess.Apply()); err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+}
+
+// markCloneAsRestoring moves the restore to Restoring, unless it is already there or failed
+func (r *StarknetRPCReconciler) markCloneAsRestoring(ctx context.Context, cluster *v1alpha1.StarknetRPC, sourceName string) error {
+	switch getRestoreReason(cluster) {
+	case string(starknetrpc.StarknetRPCRestoreStatusRestoring), string(starknetrpc.StarknetRPCRestoreStatusFailed):
+		return nil
+	}
+
+	r.Recorder.Event(cluster, "Normal", "RestoreStarted",
+		fmt.Sprintf("Cloning the data volume of StarknetRPC %s", sourceName))
+	return condition.SetPhases(ctx, r.Client, cluster, starknetrpc.StarknetRPCRestoreStatusRestoring.Apply())
+}
+
+// checkCloneCompatibility checks that the database of the source node can be opened by the target node
+func checkCloneCompatibility(source *v1alpha1.StarknetRPC, target *v1alpha1.StarknetRPC) error {
+	if source.Spec.Network != target.Spec.Network {
+		return fmt.Errorf("the source node runs on network %s, not %s", source.Spec.Network, target.Spec.Network)
+	}
+
+	if target.Spec.Storage.Size.Cmp(source.Spec.Storage.Size) < 0 {
+		return fmt.Errorf("the data volume (%s) is smaller than the volume of the source node (%s)",
+			target.Spec.Storage.Size.String(), source.Spec.Storage.Size.String())
+	}
+
+	sourceImage, targetImage := getPodImage(source), getPodImage(target)
+	if sourceImage == targetImage {
+		return nil
+	}
+	sourceVersion, sourceErr := getImageVersion(sourceImage)
+	targetVersion, targetErr := getImageVersion(targetImage)
+	if sourceErr != nil || targetErr != nil {
+		return fmt.Errorf("the versions of images %s and %s cannot be compared", sourceImage, targetImage)
+	}
+	// Pathfinder migrates the database forward, but cannot open a database of a newer version
+	if targetVersion.LT(sourceVersion) {
+		return fmt.Errorf("pathfinder %s cannot open the database of pathfinder %s", targetVersion, sourceVersion)
+	}
+
+	return nil
+}
+
+// getImageVersion returns the version of the tag of an image (e.g. eqlabs/pathfinder:v0.20.0)
+func getImageVersion(image string) (semver.Version, error) {
+	image, _, _ = strings.Cut(image, "@")
+	index := strings.LastIndex(image, ":")
+	if index < 0 || strings.Contains(image[index:], "/") {
+		return semver.Version{}, fmt.Errorf("image %s has no tag", image)
+	}
+	return semver.ParseTolerant(image[index+1:])
+}
+
+// GetWantedCloneJob returns the job copying the database of the source node to the data volume
+func (r *StarknetRPCReconciler) GetWantedCloneJob(cluster *v1alpha1.StarknetRPC, source *v1alpha1.StarknetRPC) batchv1.Job {
+	labels := map[string]string{
+		"rpc.runelabs.xyz/type": "starknet",
+		"rpc.runelabs.xyz/name": cluster.Name,
+		"runelabs.xyz/network":  cluster.Spec.Network,
+	}
+
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:    labels,
+			Name:      fmt.Sprintf("%s-clone", cluster.Name),
+			Namespace: cluster.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion:         v1alpha1.GroupVersion.String(),
+					Kind:               "StarknetRPC",
+					Name:               cluster.Name,
+					UID:                cluster.UID,
+					Controller:         &[]bool{true}[0],
+					BlockOwnerDeletion: &[]bool{true}[0],
+				},
+			},
+		},
+		Spec: batchv1.JobSpec{
+			// The source node is stopped during the copy, a failed copy is not retried
+			BackoffLimit: &[]int32{0}[0],
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "database-copier",
+							Image:   getImage(&cluster.Spec.RestoreArchive),
+							Command: []string{"cp", "-a", "/source/.", "/data/"},
+							// The end of the logs is used as the failure reason of the copy
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "source",
+									MountPath: "/source",
+									ReadOnly:  true,
+								},
+								{
+									Name:      "data",
+									MountPath: "/data",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "source",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: r.GetStoragePvcName(source).Name,
+									ReadOnly:  true,
+								},
+							},
+						},
+						{
+							Name: "data",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: r.GetStoragePvcName(cluster).Name,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// getCloneDataSource returns the data source of the data volume, if it is cloned from another node by the
+// storage driver: the volume of the active color of the source node, which changes with its blue/green upgrades.
+// A source node that does not exist anymore gives no data source.
+func (r *StarknetRPCReconciler) getCloneDataSource(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*corev1.TypedLocalObjectReference, error) {
+	sourceName := getCloneSource(cluster)
+	if sourceName == "" || getCloneMethod(cluster) == v1alpha1.CloneMethodCopy {
+		return nil, nil
+	}
+
+	source := &v1alpha1.StarknetRPC{}
+	if err := r.Get(ctx, types.NamespacedName{Name: sourceName, Namespace: cluster.Namespace}, source); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return &corev1.TypedLocalObjectReference{
+		Kind: "PersistentVolumeClaim",
+		Name: r.GetStoragePvcName(source).Name,
+	}, nil
+}
+
+// getCloneSource returns the name of the node the data volume is cloned from, if any
+func getCloneSource(cluster *v1alpha1.StarknetRPC) string {
+	if cluster.Spec.RestoreFrom == nil {
+		return ""
+	}
+	return cluster.Spec.RestoreFrom.StarknetRPC
+}
+
+func getCloneMethod(cluster *v1alpha1.StarknetRPC) v1alpha1.CloneMethod {
+	if cluster.Status.Restore == nil {
+		return ""
+	}
+	return cluster.Status.Restore.CloneMethod
+}
+
+func getRestoreReason(cluster *v1alpha1.StarknetRPC) string {
+	restoreCondition := meta.FindStatusCondition(cluster.Status.Conditions, string(starknetrpc.StarknetRPCRestoreCondition))
+	if restoreCondition == nil {
+		return ""
+	}
+	return restoreCondition.Reason
+}
+
+func setCloneMethod(method v1alpha1.CloneMethod) condition.StateTransition {
+	return func(cluster *v1alpha1.StarknetRPC) {
+		if cluster.Status.Restore == nil {
+			cluster.Status.Restore = &v1alpha1.RestoreStatus{}
+		}
+		cluster.Status.Restore.CloneMethod = method
+	}
+}
+
+func markRestoreAsWaitingForSource(message string) condition.StateTransition {
+	return func(cluster *v1alpha1.StarknetRPC) {
+		meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+			Type:    "Restore",
+			Status:  metav1.ConditionFalse,
+			Reason:  "WaitingForSource",
+			Message: message,
+		})
+	}
+}
+
+func markRestoreAsIncompatibleSource(message string) condition.StateTransition {
+	return func(cluster *v1alpha1.StarknetRPC) {
+		meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+			Type:    "Restore",
+			Status:  metav1.ConditionFalse,
+			Reason:  "IncompatibleSource",
+			Message: message,
+		})
+	}
+}
+
+func markCloneAsFailed(message string) condition.StateTransition {
+	return func(cluster *v1alpha1.StarknetRPC) {
+		meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+			Type:    "Restore",
+			Status:  metav1.ConditionFalse,
+			Reason:  string(starknetrpc.StarknetRPCRestoreStatusFailed),
+			Message: message,
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPC clone", func() {
+	newNode := func(name string, network string) *v1alpha1.StarknetRPC {
+		node := newTestStarknetRPC(name)
+		node.Spec.Network = network
+		node.Spec.Image = &[]string{"eqlabs/pathfinder:v0.20.0"}[0]
+		return node
+	}
+
+	Context("When checking the compatibility of the clone source", func() {
+		It("Should accept a node of the same network and version", func() {
+			Expect(checkCloneCompatibility(newNode("source", "mainnet"), newNode("target", "mainnet"))).To(Succeed())
+		})
+
+		It("Should reject a node of another network", func() {
+			Expect(checkCloneCompatibility(newNode("source", "testnet-sepolia"), newNode("target", "mainnet"))).NotTo(Succeed())
+		})
+
+		It("Should only accept a newer pathfinder version", func() {
+			source, target := newNode("source", "mainnet"), newNode("target", "mainnet")
+			target.Spec.Image = &[]string{"eqlabs/pathfinder:v0.21.1"}[0]
+			Expect(checkCloneCompatibility(source, target)).To(Succeed())
+
+			target.Spec.Image = &[]string{"eqlabs/pathfinder:v0.19.0"}[0]
+			Expect(checkCloneCompatibility(source, target)).NotTo(Succeed())
+
+			target.Spec.Image = &[]string{"eqlabs/pathfinder:latest"}[0]
+			Expect(checkCloneCompatibility(source, target)).NotTo(Succeed())
+		})
+
+		It("Should reject a data volume smaller than the source volume", func() {
+			source, target := newNode("source", "mainnet"), newNode("target", "mainnet")
+			target.Spec.Storage.Size = resource.MustParse("50Gi")
+			Expect(checkCloneCompatibility(source, target)).NotTo(Succeed())
+		})
+	})
+
+	Context("When cloning the data volume of another node", func() {
+		const (
+			sourceName   = "test-starknet-rpc-clone-source"
+			resourceName = "test-starknet-rpc-clone"
+			namespace    = "default"
+		)
+
+		var (
+			ctx         context.Context
+			source      *v1alpha1.StarknetRPC
+			starknetRPC *v1alpha1.StarknetRPC
+			reconciler  *StarknetRPCReconciler
+		)
+
+		restoreReason := func() string {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			restore := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Restore")
+			Expect(restore).NotTo(BeNil())
+			return restore.Reason
+		}
+
+		getPvc := func() *corev1.PersistentVolumeClaim {
+			pvc := &corev1.PersistentVolumeClaim{}
+			Expect(k8sClient.Get(ctx, reconciler.GetStoragePvcName(starknetRPC), pvc)).To(Succeed())
+			return pvc
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			source = newNode(sourceName, "mainnet")
+			createTestStarknetRPC(ctx, source)
+			source.Status.Conditions = []metav1.Condition{}
+			markArchiveAsFinished(source)
+			Expect(k8sClient.Status().Update(ctx, source)).Should(Succeed())
+
+			starknetRPC = newNode(resourceName, "mainnet")
+			starknetRPC.Spec.RestoreFrom = &v1alpha1.RestoreSource{StarknetRPC: sourceName}
+			createTestStarknetRPC(ctx, starknetRPC)
+			starknetRPC.Status.Conditions = []metav1.Condition{}
+			starknetrpc.StarknetRPCRestoreStatusPending.Apply()(starknetRPC)
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).Should(Succeed())
+
+			reconciler = &StarknetRPCReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(20),
+			}
+		})
+
+		AfterEach(func() {
+			deletePropagation := metav1.DeletePropagationBackground
+			_ = k8sClient.Delete(ctx, &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-clone", Namespace: namespace},
+			}, &client.DeleteOptions{PropagationPolicy: &deletePropagation})
+			pvc := &corev1.PersistentVolumeClaim{}
+			if err := k8sClient.Get(ctx, reconciler.GetStoragePvcName(starknetRPC), pvc); err == nil {
+				pvc.Finalizers = nil
+				_ = k8sClient.Update(ctx, pvc)
+				_ = k8sClient.Delete(ctx, pvc)
+			}
+			_ = k8sClient.Delete(ctx, starknetRPC)
+			_ = k8sClient.Delete(ctx, source)
+		})
+
+		It("Should clone the volume of the source node through the storage driver", func() {
+			_, err := reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			pvc := getPvc()
+			Expect(pvc.Spec.DataSource).NotTo(BeNil())
+			Expect(pvc.Spec.DataSource.Kind).To(Equal("PersistentVolumeClaim"))
+			Expect(pvc.Spec.DataSource.Name).To(Equal(sourceName + "-storage"))
+
+			_, err = reconciler.ReconcileArchiveRestore(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusRestoring)))
+
+			pvc.Status.Phase = corev1.ClaimBound
+			Expect(k8sClient.Status().Update(ctx, pvc)).To(Succeed())
+
+			_, err = reconciler.ReconcileArchiveRestore(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusSuccess)))
+			Expect(getPvc().Annotations).To(HaveKeyWithValue(ClonedFromAnnotation, sourceName))
+		})
+
+		It("Should not need the source node once the volume is cloned", func() {
+			_, err := reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			pvc := getPvc()
+			pvc.Status.Phase = corev1.ClaimBound
+			Expect(k8sClient.Status().Update(ctx, pvc)).To(Succeed())
+
+			_, err = reconciler.ReconcileArchiveRestore(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			_, err = reconciler.ReconcileArchiveRestore(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusSuccess)))
+
+			Expect(k8sClient.Delete(ctx, source)).To(Succeed())
+
+			_, err = reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should clone the volume of the active color of the source node", func() {
+			// The source node was upgraded blue/green: its Blue volume is gone
+			source.Status.ActiveColor = v1alpha1.NodeColorGreen
+			Expect(k8sClient.Status().Update(ctx, source)).To(Succeed())
+
+			_, err := reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			pvc := getPvc()
+			Expect(pvc.Spec.DataSource).NotTo(BeNil())
+			Expect(pvc.Spec.DataSource.Kind).To(Equal("PersistentVolumeClaim"))
+			Expect(pvc.Spec.DataSource.Name).To(Equal(sourceName + "-storage-green"))
+		})
+
+		It("Should not create the volume from an incompatible node", func() {
+			starknetRPC.Spec.Network = "testnet-sepolia"
+			Expect(k8sClient.Update(ctx, starknetRPC)).To(Succeed())
+
+			_, err := reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(restoreReason()).To(Equal("IncompatibleSource"))
+			Expect(k8sClient.Get(ctx, reconciler.GetStoragePvcName(starknetRPC), &corev1.PersistentVolumeClaim{})).NotTo(Succeed())
+		})
+
+		It("Should copy the database with a job when the volume cannot be cloned", func() {
+			// Volumes cannot be cloned across storage classes
+			starknetRPC.Spec.Storage.Class = "another-class"
+			Expect(k8sClient.Update(ctx, starknetRPC)).To(Succeed())
+
+			_, err := reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getPvc().Spec.DataSource).To(BeNil())
+
+			_, err = reconciler.ReconcileArchiveRestore(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(starknetRPC.Status.Restore.CloneMethod).To(Equal(v1alpha1.CloneMethodCopy))
+
+			// The source node is stopped while its database is copied
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(source), source)).To(Succeed())
+			Expect(source.Annotations).To(HaveKeyWithValue(QuiesceAnnotation, "starknetrpc/"+resourceName))
+
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Name: resourceName + "-clone", Namespace: namespace}, job)).To(Succeed())
+			Expect(job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal(sourceName + "-storage"))
+			Expect(job.Spec.Template.Spec.Volumes[1].PersistentVolumeClaim.ClaimName).To(Equal(resourceName + "-storage"))
+
+			startTime := metav1.Now()
+			job.Status.StartTime = &startTime
+			job.Status.Succeeded = 1
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+
+			_, err = reconciler.ReconcileArchiveRestore(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusSuccess)))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(source), source)).To(Succeed())
+			Expect(source.Annotations).NotTo(HaveKey(QuiesceAnnotation))
+		})
+
+		It("Should retry a failed copy once the backoff elapsed", func() {
+			starknetRPC.Spec.Storage.Class = "another-class"
+			Expect(k8sClient.Update(ctx, starknetRPC)).To(Succeed())
+
+			_, err := reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = reconciler.ReconcileArchiveRestore(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			jobKey := client.ObjectKey{Name: resourceName + "-clone", Namespace: namespace}
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, jobKey, job)).To(Succeed())
+			startTime := metav1.Now()
+			job.Status.StartTime = &startTime
+			job.Status.Failed = 1
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+
+			// The failed job is kept during the backoff
+			result, err := reconciler.ReconcileArchiveRestore(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusFailed)))
+			Expect(starknetRPC.Status.Restore.Attempts).To(Equal(int32(1)))
+			Expect(starknetRPC.Status.Restore.FailedAttempts).To(Equal(int32(1)))
+			Expect(k8sClient.Get(ctx, jobKey, &batchv1.Job{})).To(Succeed())
+
+			// The source node is restarted in the meantime
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(source), source)).To(Succeed())
+			Expect(source.Annotations).NotTo(HaveKey(QuiesceAnnotation))
+
+			// Then deleted, and a new copy started
+			lastFailure := metav1.NewTime(time.Now().Add(-time.Hour))
+			starknetRPC.Status.Restore.LastFailureTime = &lastFailure
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).To(Succeed())
+
+			_, err = reconciler.ReconcileArchiveRestore(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(apierrs.IsNotFound(k8sClient.Get(ctx, jobKey, &batchv1.Job{}))).To(BeTrue())
+
+			_, err = reconciler.ReconcileArchiveRestore(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(k8sClient.Get(ctx, jobKey, &batchv1.Job{})).To(Succeed())
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusRestoring)))
+			Expect(starknetRPC.Status.Restore.Attempts).To(Equal(int32(2)))
+		})
+	})
+})
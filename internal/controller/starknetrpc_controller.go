@@ -21,6 +21,7 @@ import (
 	"time"
 
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -28,13 +29,19 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
 	rpccondition "github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/podlogs"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
 
 	pathfinderv1alpha1 "github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
 	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/snapshot"
 )
 
 // +kubebuilder:rbac:groups=pathfinder.runelabs.xyz,resources=starknetrpcs,verbs=get;list;watch;create;update;patch;delete
@@ -43,8 +50,13 @@ import (
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods/proxy,verbs=get;create
+// +kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups=core,resources=pods/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
 // +kubebuilder:rbac:groups=monitoring.coreos.com,resources=podmonitors,verbs=get;list;watch;create;update;patch;delete
 
 // StarknetRPCReconciler reconciles a StarknetRPC object
@@ -53,6 +65,16 @@ type StarknetRPCReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+
+	// HealthClient is used to query the nodes. If not set, it goes through the pods/proxy subresource.
+	HealthClient proxy.NodeHealthClient
+	// SnapshotResolver is used to look up the snapshots to restore. If not set, the index is fetched over HTTP.
+	SnapshotResolver snapshot.Resolver
+	// RestorerImage is the operator image, whose restore subcommand runs the archive restores if set.
+	// Otherwise, or for the sources it does not support, the snapshotter image is used.
+	RestorerImage string
+	// LogReader is used to read the progress of the restore jobs. If not set, it goes through the pods/log subresource.
+	LogReader podlogs.Reader
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -81,8 +103,29 @@ func (r *StarknetRPCReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
-	// 2. We need to setup the main PVC
-	result, err := r.ReconcilePvc(ctx, rpc)
+	// Wipe the node when a reset is requested
+	result, err := r.ReconcileReset(ctx, rpc)
+	if err != nil {
+		if err == errs.ErrNextLoop {
+			logger.V(1).Info("ReconcileReset re-scheduled", "error", err)
+			return *result, nil
+		}
+		logger.Error(err, "Error while resetting the node")
+		return ctrl.Result{}, err
+	}
+
+	// 2. We need to setup the main PVC, making sure it still holds the restored database
+	result, err = r.CheckDataVolume(ctx, rpc)
+	if err != nil {
+		if err == errs.ErrNextLoop {
+			logger.V(1).Info("CheckDataVolume re-scheduled", "error", err)
+			return *result, nil
+		}
+		logger.Error(err, "Error while checking the data volume")
+		return ctrl.Result{}, err
+	}
+
+	result, err = r.ReconcilePvc(ctx, rpc)
 	if err != nil {
 		if err == errs.ErrNextLoop {
 			logger.V(1).Info("ReconcilePvc re-scheduled", "error", err)
@@ -92,6 +135,16 @@ func (r *StarknetRPCReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
+	// 3. Expose the node through a Service
+	result, err = r.ReconcileService(ctx, rpc)
+	if err != nil {
+		if err == errs.ErrNextLoop {
+			return *result, nil
+		}
+		logger.Error(err, "Error while reconciling Service")
+		return ctrl.Result{}, err
+	}
+
 	// Wait for the archival to complete (if enabled)
 	result, err = r.ReconcileArchiveRestore(ctx, rpc)
 	if err != nil {
@@ -108,12 +161,42 @@ func (r *StarknetRPCReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{RequeueAfter: time.Duration(30) * time.Second}, nil
 	}
 
-	result, err = r.ReconcilePod(ctx, rpc)
+	// Stop the node while it is being backed up
+	quiesced, err := r.ReconcileQuiesce(ctx, rpc)
+	if err != nil {
+		logger.Error(err, "Error while reconciling quiesce")
+		return ctrl.Result{}, err
+	}
+	if quiesced {
+		return ctrl.Result{RequeueAfter: time.Duration(30) * time.Second}, nil
+	}
+
+	// Back up the database before a new image migrates it
+	result, err = r.ReconcileUpgradeBackup(ctx, rpc)
+	if err != nil {
+		if err == errs.ErrNextLoop {
+			return *result, nil
+		}
+		logger.Error(err, "Error while reconciling the backup before the upgrade")
+		return ctrl.Result{}, err
+	}
+
+	// Roll out a new image next to the node, with the BlueGreen strategy
+	result, err = r.ReconcileUpgrade(ctx, rpc)
 	if err != nil {
 		if err == errs.ErrNextLoop {
 			return *result, nil
 		}
-		logger.Error(err, "Error while reconciling pod")
+		logger.Error(err, "Error while reconciling upgrade")
+		return ctrl.Result{}, err
+	}
+
+	podResult, err := r.ReconcileNode(ctx, rpc)
+	if err != nil {
+		if err == errs.ErrNextLoop {
+			return *podResult, nil
+		}
+		logger.Error(err, "Error while reconciling the node")
 		return ctrl.Result{}, err
 	}
 
@@ -128,20 +211,40 @@ func (r *StarknetRPCReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		// as it's not critical for the RPC functionality
 	}
 
-	// If the archive was restored correctly, we can finally create the pod.
-	// TODO: Monitor the sync status
-	// TODO: If the status is ready, change the syncstatus condition to true
-	// TODO: Re-create the pod if it is missing, and reset the status conditions
+	// Record that the current spec has been fully reconciled
+	if rpc.Status.ObservedGeneration != rpc.Generation {
+		err := condition.SetPhases(ctx, r.Client, rpc, func(rpc *pathfinderv1alpha1.StarknetRPC) {
+			rpc.Status.ObservedGeneration = rpc.Generation
+		})
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
-	return ctrl.Result{}, nil
+	// Keep polling the sync status of the node
+	return *podResult, nil
+}
+
+// getHealthClient returns the client used to query the health of the nodes
+func (r *StarknetRPCReconciler) getHealthClient() proxy.NodeHealthClient {
+	if r.HealthClient == nil {
+		r.HealthClient = proxy.NewNodeHealthClient(r.Interface)
+	}
+	return r.HealthClient
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *StarknetRPCReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	builder := ctrl.NewControllerManagedBy(mgr).
-		For(&pathfinderv1alpha1.StarknetRPC{}).
+		// Status updates (e.g. the block height) must not trigger a new reconciliation
+		For(&pathfinderv1alpha1.StarknetRPC{}, ctrlbuilder.WithPredicates(
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}, predicate.LabelChangedPredicate{}),
+		)).
 		Owns(&corev1.Pod{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&corev1.Service{}).
 		Owns(&batchv1.Job{}).
+		Owns(&pathfinderv1alpha1.StarknetRPCBackup{}).
 		Owns(&corev1.PersistentVolumeClaim{})
 
 	// Only watch PodMonitor if the CRD is available
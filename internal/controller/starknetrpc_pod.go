@@ -2,7 +2,11 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
 	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
@@ -10,17 +14,35 @@ import (
 	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
 	"github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// PodSpecHashAnnotation is set on the pod, with the hash of the spec it was created from
+const PodSpecHashAnnotation = "pathfinder.runelabs.xyz/spec-hash"
+
+const (
+	// ComponentLabel is set on the pods of the operator, with their role. Only the node pods are selected by the
+	// Service: the jobs of a node carry its name too.
+	ComponentLabel = "rpc.runelabs.xyz/component"
+	// ComponentNode is the role of the pods running the node
+	ComponentNode = "node"
 )
 
 func (r *StarknetRPCReconciler) ReconcilePod(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
 	// Create PVC (if it not already exists)
 	pod := r.GetWantedPod(cluster)
+	wantedHash := pod.Annotations[PodSpecHashAnnotation]
 
 	created, err := reconciler.CreateOrReconcile(ctx, r.Client, &pod,
-		ImageReconciler(cluster),
+		SpecHashReconciler(pod.DeepCopy()),
 	)
 	if err != nil {
 		return nil, err
@@ -34,47 +56,142 @@ func (r *StarknetRPCReconciler) ReconcilePod(ctx context.Context, cluster *v1alp
 		}
 	}
 
-	if shouldPodGetRecreated(&pod) {
-		// It should immediately reconcile
-		if err := r.Delete(ctx, &pod); err != nil {
-			return nil, err
+	// Most of the pod spec is immutable: the pod is re-created when it drifted from the wanted one
+	if currentHash := pod.Annotations[PodSpecHashAnnotation]; currentHash != wantedHash {
+		if pod.DeletionTimestamp != nil {
+			// Wait for the previous pod to be gone
+			return &ctrl.Result{RequeueAfter: time.Second}, reconciler.ErrNextLoop
 		}
 
-		return &ctrl.Result{Requeue: true}, reconciler.ErrNextLoop
+		logger.Info("Pod spec changed, re-creating the pod", "pod", pod.Name, "current", currentHash, "wanted", wantedHash)
+		r.Recorder.Event(cluster, "Normal", "PodSpecChanged",
+			fmt.Sprintf("The spec of pod %s changed, re-creating it", pod.Name))
+		if err := r.Delete(ctx, &pod); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
 
-	}
-	// Try to make a request to the pod
-	if ok, err := proxy.IsReady(ctx, r.Interface, cluster, &pod); err == nil && ok {
 		err := condition.SetPhases(ctx, r.Client, cluster,
-			starknetrpc.StarknetRPCAvailableStatusCatchingUp.Apply(),
+			starknetrpc.StarknetRPCAvailableStatusCreating.Apply(),
 		)
 		if err != nil {
 			return nil, err
 		}
+
+		return &ctrl.Result{RequeueAfter: time.Second}, reconciler.ErrNextLoop
 	}
 
-	// For now, stop here.
-	// TODO: Check for the sync status
+	// A node that has been unresponsive for too long gets a new pod
+	if shouldPodGetRecreated(&pod) || getAvailableStatus(cluster) == starknetrpc.StarknetRPCAvailableStatusFailed {
+		r.Recorder.Event(cluster, "Warning", "PodRecreated",
+			fmt.Sprintf("Pod %s is unhealthy, re-creating it", pod.Name))
+		// It should immediately reconcile
+		if err := r.Delete(ctx, &pod); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
 
-	return &ctrl.Result{}, nil
+		return &ctrl.Result{Requeue: true}, reconciler.ErrNextLoop
+
+	}
+
+	// Track the sync status of the node
+	return r.ReconcileSyncStatus(ctx, cluster, &pod)
 }
 
-func ImageReconciler(rpc *v1alpha1.StarknetRPC) reconciler.ObjectReconcilier[*corev1.Pod] {
+// SpecHashReconciler records the spec hash on the pods created before it was recorded, when they still match
+// the wanted pod, so that they are only re-created once their spec actually changes. The other ones are left
+// without a hash, and re-created.
+func SpecHashReconciler(wanted *corev1.Pod) reconciler.ObjectReconcilier[*corev1.Pod] {
 	return reconciler.ObjectReconcilier[*corev1.Pod]{
-		Name: "ImageReconciler",
+		Name: "SpecHashReconciler",
 		IsUpToDate: func(pod *corev1.Pod) bool {
-			return pod.Spec.Containers[0].Image == getPodImage(rpc)
+			return pod.Annotations[PodSpecHashAnnotation] != "" || !isPodRenderedFrom(pod, wanted)
 		},
 		Update: func(pod *corev1.Pod) error {
-			pod.Spec.Containers[0].Image = getPodImage(rpc)
+			if pod.Annotations == nil {
+				pod.Annotations = make(map[string]string)
+			}
+			pod.Annotations[PodSpecHashAnnotation] = wanted.Annotations[PodSpecHashAnnotation]
 			return nil
 		},
 	}
 }
 
+// isPodRenderedFrom checks that a running pod has the fields rendered in the wanted pod. The fields defaulted
+// by the API server (protocols, probe timeouts, tolerations...) are ignored.
+func isPodRenderedFrom(pod *corev1.Pod, wanted *corev1.Pod) bool {
+	for key, value := range wanted.Labels {
+		if pod.Labels[key] != value {
+			return false
+		}
+	}
+	if !equality.Semantic.DeepEqual(pod.Spec.ReadinessGates, wanted.Spec.ReadinessGates) ||
+		len(pod.Spec.Containers) != len(wanted.Spec.Containers) {
+		return false
+	}
+
+	claims := map[string]string{}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			claims[volume.Name] = volume.PersistentVolumeClaim.ClaimName
+		}
+	}
+	for _, volume := range wanted.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil && claims[volume.Name] != volume.PersistentVolumeClaim.ClaimName {
+			return false
+		}
+	}
+
+	for i, container := range wanted.Spec.Containers {
+		current := pod.Spec.Containers[i]
+		if current.Name != container.Name || current.Image != container.Image ||
+			!equality.Semantic.DeepEqual(current.Env, container.Env) ||
+			!equality.Semantic.DeepEqual(current.Resources, container.Resources) ||
+			getProbePath(current.StartupProbe) != getProbePath(container.StartupProbe) ||
+			getProbePath(current.ReadinessProbe) != getProbePath(container.ReadinessProbe) ||
+			len(current.Ports) != len(container.Ports) {
+			return false
+		}
+		for j, port := range container.Ports {
+			if current.Ports[j].Name != port.Name || current.Ports[j].ContainerPort != port.ContainerPort {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func getProbePath(probe *corev1.Probe) string {
+	if probe == nil || probe.HTTPGet == nil {
+		return ""
+	}
+	return probe.HTTPGet.Path
+}
+
+// getPodSpecHash returns the hash of the labels and spec of the pod.
+// The image is part of it: the pod is re-created when it changes, once getPodImage lets it change.
+func getPodSpecHash(pod *corev1.Pod) string {
+	// Marshalling a pod spec cannot fail, and the keys of the maps are sorted
+	data, _ := json.Marshal(struct {
+		Labels map[string]string `json:"labels"`
+		Spec   *corev1.PodSpec   `json:"spec"`
+	}{pod.Labels, &pod.Spec})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
 func (r *StarknetRPCReconciler) GetPodName(cluster *v1alpha1.StarknetRPC) types.NamespacedName {
+	return getNodePodName(cluster)
+}
+
+// getNodePodName returns the name of the pod running the node, which is the first (and only)
+// replica of the StatefulSet when the node runs in a StatefulSet
+func getNodePodName(cluster *v1alpha1.StarknetRPC) types.NamespacedName {
+	name := fmt.Sprintf("%s-rpc%s", cluster.Name, getColorSuffix(getActiveColor(cluster)))
+	if isStatefulSetWorkload(cluster) {
+		name = fmt.Sprintf("%s-0", getStatefulSetName(cluster).Name)
+	}
 	return types.NamespacedName{
-		Name:      fmt.Sprintf("%s-rpc", cluster.Name),
+		Name:      name,
 		Namespace: cluster.Namespace,
 	}
 }
@@ -101,13 +218,45 @@ func shouldPodGetRecreated(pod *corev1.Pod) bool {
 	return false
 }
 
+func getHealthProbeHandler(path string) corev1.ProbeHandler {
+	return corev1.ProbeHandler{
+		HTTPGet: &corev1.HTTPGetAction{
+			Path: path,
+			Port: intstr.FromString(proxy.MonitoringPortName),
+		},
+	}
+}
+
+// getPodImage returns the image run by the node: the node keeps running the previous image
+// while its database is backed up before an upgrade, while a blue/green upgrade is in progress
+// (even if the image changed again in the meantime), or once it was rolled back
 func getPodImage(rpc *v1alpha1.StarknetRPC) string {
+	if isUpgradeBackupPending(rpc) {
+		return rpc.Status.UpgradeBackup.FromImage
+	}
+
+	if upgrade := rpc.Status.Upgrade; upgrade != nil {
+		switch upgrade.Phase {
+		case v1alpha1.UpgradePhaseCloning, v1alpha1.UpgradePhaseSyncing:
+			return upgrade.FromImage
+		case v1alpha1.UpgradePhaseRolledBack:
+			if upgrade.ToImage == getSpecImage(rpc) {
+				return upgrade.FromImage
+			}
+		}
+	}
+	return getSpecImage(rpc)
+}
+
+// getSpecImage returns the image of the spec of the node
+func getSpecImage(rpc *v1alpha1.StarknetRPC) string {
 	if rpc.Spec.Image != nil {
 		return *rpc.Spec.Image
 	} else {
 		return "eqlabs/pathfinder:v0.20.0"
 	}
 }
+
 func (r *StarknetRPCReconciler) GetWantedPod(cluster *v1alpha1.StarknetRPC) corev1.Pod {
 	var userId int64 = 1000
 
@@ -115,6 +264,11 @@ func (r *StarknetRPCReconciler) GetWantedPod(cluster *v1alpha1.StarknetRPC) core
 		"rpc.runelabs.xyz/type": "starknet",
 		"rpc.runelabs.xyz/name": cluster.Name,
 		"runelabs.xyz/network":  cluster.Spec.Network,
+		ComponentLabel:          ComponentNode,
+	}
+	// The Service only selects the active color during blue/green upgrades
+	if isBlueGreenUpgrade(cluster) {
+		labels[ColorLabel] = getColorLabelValue(getActiveColor(cluster))
 	}
 
 	nameInfo := r.GetPodName(cluster)
@@ -176,11 +330,11 @@ func (r *StarknetRPCReconciler) GetWantedPod(cluster *v1alpha1.StarknetRPC) core
 					Resources: cluster.Spec.Resources,
 					Ports: []corev1.ContainerPort{
 						{
-							Name:          "rpc",
+							Name:          proxy.RPCPortName,
 							ContainerPort: 9545,
 						},
 						{
-							Name:          "monitoring",
+							Name:          proxy.MonitoringPortName,
 							ContainerPort: 9000,
 						},
 					},
@@ -190,6 +344,25 @@ func (r *StarknetRPCReconciler) GetWantedPod(cluster *v1alpha1.StarknetRPC) core
 							MountPath: "/usr/share/pathfinder/data",
 						},
 					},
+					// Opening the database (and running migrations) can take a long time
+					StartupProbe: &corev1.Probe{
+						ProbeHandler:     getHealthProbeHandler("/ready"),
+						PeriodSeconds:    10,
+						FailureThreshold: 360,
+					},
+					// `/ready/synced` is not probed here: the readiness gate checks it (or the block lag, when
+					// maxBlockLag is set), and a probe on it would hold back a node within the configured lag
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler:     getHealthProbeHandler("/ready"),
+						PeriodSeconds:    10,
+						FailureThreshold: 3,
+					},
+				},
+			},
+			// The operator only marks the pod as ready once the node caught up with the chain
+			ReadinessGates: []corev1.PodReadinessGate{
+				{
+					ConditionType: SyncedReadinessGate,
 				},
 			},
 			Volumes: []corev1.Volume{
@@ -212,6 +385,7 @@ func (r *StarknetRPCReconciler) GetWantedPod(cluster *v1alpha1.StarknetRPC) core
 			},
 		},
 	}
+	pod.Annotations[PodSpecHashAnnotation] = getPodSpecHash(&pod)
 
 	return pod
 }
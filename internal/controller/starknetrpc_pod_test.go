@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPC pod", func() {
+	Context("When the spec of the node changes", func() {
+		const (
+			resourceName = "test-starknet-rpc-pod"
+			namespace    = "default"
+			network      = "mainnet"
+		)
+
+		var (
+			ctx         context.Context
+			starknetRPC *v1alpha1.StarknetRPC
+			pod         *corev1.Pod
+			reconciler  *StarknetRPCReconciler
+		)
+
+		updateSpec := func(update func(spec *v1alpha1.StarknetRPCSpec)) {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			update(&starknetRPC.Spec)
+			Expect(k8sClient.Update(ctx, starknetRPC)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			createTestStarknetRPC(ctx, starknetRPC)
+
+			reconciler = &StarknetRPCReconciler{
+				Client:       k8sClient,
+				Scheme:       k8sClient.Scheme(),
+				Recorder:     record.NewFakeRecorder(10),
+				HealthClient: proxy.NewFakeNodeHealthClient(100, 1000),
+			}
+
+			wanted := reconciler.GetWantedPod(starknetRPC)
+			pod = &wanted
+			Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+
+			starknetrpc.StarknetRPCAvailableStatusReady.Apply()(starknetRPC)
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			_ = k8sClient.Delete(ctx, pod)
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should record the spec hash on the pod", func() {
+			Expect(pod.Annotations).To(HaveKey(PodSpecHashAnnotation))
+			other := reconciler.GetWantedPod(starknetRPC)
+			Expect(other.Annotations[PodSpecHashAnnotation]).To(Equal(pod.Annotations[PodSpecHashAnnotation]))
+		})
+
+		It("Should re-create the pod when its image changes", func() {
+			updateSpec(func(spec *v1alpha1.StarknetRPCSpec) {
+				spec.Image = &[]string{"eqlabs/pathfinder:v0.21.0"}[0]
+			})
+
+			_, err := reconciler.ReconcilePod(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})
+			Expect(apierrs.IsNotFound(err)).To(BeTrue())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			available := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Available")
+			Expect(available.Reason).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusCreating)))
+
+			By("Creating the pod with the new image")
+			_, err = reconciler.ReconcilePod(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			current := &corev1.Pod{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), current)).To(Succeed())
+			Expect(current.Spec.Containers[0].Image).To(Equal("eqlabs/pathfinder:v0.21.0"))
+		})
+
+		It("Should re-create the pod when its resources change", func() {
+			updateSpec(func(spec *v1alpha1.StarknetRPCSpec) {
+				spec.Resources = corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("16Gi")},
+				}
+			})
+
+			_, err := reconciler.ReconcilePod(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})
+			Expect(apierrs.IsNotFound(err)).To(BeTrue())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			available := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Available")
+			Expect(available.Reason).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusCreating)))
+
+			By("Creating the pod with the new spec")
+			_, err = reconciler.ReconcilePod(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			current := &corev1.Pod{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), current)).To(Succeed())
+			Expect(current.Spec.Containers[0].Resources.Limits.Memory().String()).To(Equal("16Gi"))
+		})
+
+		It("Should adopt a pod created before the spec hash was recorded", func() {
+			delete(pod.Annotations, PodSpecHashAnnotation)
+			Expect(k8sClient.Update(ctx, pod)).To(Succeed())
+
+			_, err := reconciler.ReconcilePod(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			current := &corev1.Pod{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), current)).To(Succeed())
+			Expect(current.UID).To(Equal(pod.UID))
+			Expect(current.Annotations).To(HaveKey(PodSpecHashAnnotation))
+		})
+
+		It("Should re-create a pod created before the spec hash was recorded, when it drifted", func() {
+			delete(pod.Annotations, PodSpecHashAnnotation)
+			Expect(k8sClient.Update(ctx, pod)).To(Succeed())
+
+			updateSpec(func(spec *v1alpha1.StarknetRPCSpec) {
+				spec.Image = &[]string{"eqlabs/pathfinder:v0.21.0"}[0]
+			})
+
+			_, err := reconciler.ReconcilePod(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})
+			Expect(apierrs.IsNotFound(err)).To(BeTrue())
+		})
+	})
+})
@@ -9,7 +9,6 @@ import (
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
@@ -34,40 +33,11 @@ var _ = Describe("StarknetRPC PodMonitor Controller", func() {
 			ctx = context.Background()
 
 			// Create a StarknetRPC resource
-			starknetRPC = &v1alpha1.StarknetRPC{
-				TypeMeta: metav1.TypeMeta{
-					APIVersion: "pathfinder.runelabs.xyz/v1alpha1",
-					Kind:       "StarknetRPC",
-				},
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      resourceName,
-					Namespace: namespace,
-				},
-				Spec: v1alpha1.StarknetRPCSpec{
-					Network: network,
-					RestoreArchive: v1alpha1.ArchiveSnapshot{
-						Enable:   &[]bool{false}[0],
-						FileName: "test-snapshot.tar",
-						Checksum: "test-checksum",
-						Storage: v1alpha1.StorageTemplate{
-							Size: resource.MustParse("10Gi"),
-						},
-					},
-					Storage: v1alpha1.StorageTemplate{
-						Size: resource.MustParse("100Gi"),
-					},
-					Layer1RpcSecret: corev1.SecretKeySelector{
-						LocalObjectReference: corev1.LocalObjectReference{
-							Name: "l1-rpc-secret",
-						},
-						Key: "url",
-					},
-					PodMonitor: &v1alpha1.PodMonitor{
-						Enabled: true,
-					},
-				},
+			starknetRPC = newTestStarknetRPC(resourceName)
+			starknetRPC.Spec.PodMonitor = &v1alpha1.PodMonitor{
+				Enabled: true,
 			}
-			Expect(k8sClient.Create(ctx, starknetRPC)).Should(Succeed())
+			createTestStarknetRPC(ctx, starknetRPC)
 
 			// Create the Pod that the PodMonitor will target
 			pod = &corev1.Pod{
@@ -8,28 +8,56 @@ import (
 	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
 	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
 	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
 	reconcilier "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
 	corev1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+const (
+	// SnapshotAnnotation is set on the data volume, with the name of the snapshot it was seeded from
+	SnapshotAnnotation = "pathfinder.runelabs.xyz/snapshot"
+	// SnapshotChecksumAnnotation is set on the data volume, with the checksum of the snapshot it was seeded from
+	SnapshotChecksumAnnotation = "pathfinder.runelabs.xyz/snapshot-checksum"
+	// emptyVolumeBlockMargin is how far below the block of the restored snapshot a node can be,
+	// before its data volume is considered as empty
+	emptyVolumeBlockMargin int64 = 1000
+)
+
 func (r *StarknetRPCReconciler) ReconcilePvc(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
 	contextLogger := log.FromContext(ctx)
+
+	// A volume cloned from another node can only be created once the source is known to be compatible.
+	// Once the clone is restored, the source is not needed anymore, and may be deleted
+	cloning := getCloneSource(cluster) != "" && !meta.IsStatusConditionTrue(cluster.Status.Conditions, string(starknetrpc.StarknetRPCRestoreCondition))
+	if cloning {
+		result, err := r.CheckCloneSource(ctx, cluster)
+		if err != nil {
+			return result, err
+		}
+	}
+
 	// Create PVC (if it not already exists)
 	pvc := r.GetWantedPvc(cluster)
+	if pvc.Spec.DataSource == nil && cloning {
+		dataSource, err := r.getCloneDataSource(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		pvc.Spec.DataSource = dataSource
+	}
 	err := r.Create(ctx, &pvc)
 	if err == nil {
 		contextLogger.V(1).Info("PVC created", "name", pvc.Name)
 
 		// We need to reset the archive status!
-		err := condition.SetPhases(ctx, r.Client, cluster,
-			starknetrpc.StarknetRPCRestoreStatusPending.Apply(),
-		)
-		if err != nil {
+		if err := r.resetRestore(ctx, cluster); err != nil {
 			return nil, err
 		}
 
@@ -38,7 +66,157 @@ func (r *StarknetRPCReconciler) ReconcilePvc(ctx context.Context, cluster *v1alp
 		return nil, err
 	}
 
-	return &ctrl.Result{}, nil
+	// Expand the PVC when the requested size grows
+	return r.ReconcilePvcSize(ctx, cluster)
+}
+
+// CheckDataVolume ensures that the data volume still holds the restored database.
+//
+// When the volume was deleted, replaced, or lost by its storage, the pod is torn down
+// and the restore is reset, so that pathfinder does not silently sync from genesis.
+// A volume emptied under the same claim is detected once the node runs on it, see isDataVolumeEmpty.
+func (r *StarknetRPCReconciler) CheckDataVolume(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	contextLogger := log.FromContext(ctx)
+
+	// Only a restored volume needs to be checked
+	if !isVolumeRestored(cluster) {
+		return &ctrl.Result{}, nil
+	}
+
+	var pvc corev1.PersistentVolumeClaim
+	err := r.Get(ctx, r.GetStoragePvcName(cluster), &pvc)
+	if err != nil && !apierrs.IsNotFound(err) {
+		return nil, err
+	}
+
+	var lost string
+	switch {
+	case apierrs.IsNotFound(err):
+		lost = "was deleted"
+	case pvc.DeletionTimestamp != nil:
+		lost = "is being deleted"
+	case pvc.Status.Phase == corev1.ClaimLost:
+		lost = "lost its volume"
+		// The claim cannot be bound anymore, it needs to be re-created
+		if err := r.Delete(ctx, &pvc); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	case cluster.Status.Restore == nil || cluster.Status.Restore.VolumeUID == "":
+		// Restored before the volume was recorded: adopt the current volume
+		contextLogger.Info("Recording the restored data volume", "pvc", pvc.Name, "uid", pvc.UID)
+		return &ctrl.Result{}, r.recordRestoredVolume(ctx, cluster, &pvc)
+	case pvc.UID != cluster.Status.Restore.VolumeUID:
+		lost = "was replaced"
+	default:
+		block, empty, err := r.isDataVolumeEmpty(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		if !empty {
+			return &ctrl.Result{}, nil
+		}
+		lost = fmt.Sprintf("is empty (the node is at block %d, the snapshot at block %d)", block, cluster.Status.Snapshot.BlockHeight)
+	}
+
+	message := fmt.Sprintf("The data volume %s %s, restoring the snapshot again", r.GetStoragePvcName(cluster).Name, lost)
+	contextLogger.Info("Data volume lost", "reason", lost)
+	r.Recorder.Event(cluster, "Warning", "DataVolumeLost", message)
+
+	if err := r.resetRestore(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{RequeueAfter: time.Second}, reconcilier.ErrNextLoop
+}
+
+// isDataVolumeEmpty returns true when the node catching up is far below the block of the restored snapshot:
+// its volume was re-provisioned empty under the same claim, and the node syncs from genesis.
+//
+// Only the volumes restored from a snapshot of known block height can be checked. The node is not
+// queried while it is synced, nor when it does not answer: the volume is then assumed to be intact.
+func (r *StarknetRPCReconciler) isDataVolumeEmpty(ctx context.Context, cluster *v1alpha1.StarknetRPC) (int64, bool, error) {
+	snapshot := cluster.Status.Snapshot
+	if snapshot == nil || snapshot.BlockHeight <= emptyVolumeBlockMargin ||
+		getAvailableStatus(cluster) != starknetrpc.StarknetRPCAvailableStatusCatchingUp {
+		return 0, false, nil
+	}
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, r.GetPodName(cluster), pod); err != nil {
+		return 0, false, client.IgnoreNotFound(err)
+	}
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return 0, false, nil
+	}
+
+	block, err := proxy.BlockNumber(ctx, r.getHealthClient(), pod)
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("Failed to fetch the block of the node", "error", err)
+		return 0, false, nil
+	}
+	return block, block < snapshot.BlockHeight-emptyVolumeBlockMargin, nil
+}
+
+// isVolumeRestored returns true if the data volume was restored from a snapshot (and not skipped)
+func isVolumeRestored(cluster *v1alpha1.StarknetRPC) bool {
+	restoreCondition := meta.FindStatusCondition(cluster.Status.Conditions, string(starknetrpc.StarknetRPCRestoreCondition))
+	if restoreCondition == nil || restoreCondition.Status != metav1.ConditionTrue {
+		return false
+	}
+	return restoreCondition.Reason == "ArchiveJobFinished" ||
+		restoreCondition.Reason == string(starknetrpc.StarknetRPCRestoreStatusSuccess)
+}
+
+// resetRestore tears down the pod, and resets the restore so that it runs again on the data volume
+func (r *StarknetRPCReconciler) resetRestore(ctx context.Context, cluster *v1alpha1.StarknetRPC, transitions ...condition.StateTransition) error {
+	// The node must not run on a volume that does not hold the restored database
+	if err := r.deleteNode(ctx, cluster); err != nil {
+		return err
+	}
+
+	// The attempts are counted again, the jobs of the previous ones must not be mistaken for the new ones
+	if err := r.deleteRestoreJobs(ctx, cluster); err != nil {
+		return err
+	}
+
+	transitions = append([]condition.StateTransition{
+		starknetrpc.StarknetRPCRestoreStatusPending.Apply(),
+		starknetrpc.StarknetRPCAvailableStatusPending.Apply(),
+		func(rpc *v1alpha1.StarknetRPC) {
+			rpc.Status.Restore = nil
+			// Resolve the snapshot again, to restore the most recent one
+			rpc.Status.Snapshot = nil
+		},
+	}, transitions...)
+	return condition.SetPhases(ctx, r.Client, cluster, transitions...)
+}
+
+// recordRestoredVolume annotates the data volume with the snapshot it was seeded from,
+// and records its UID in the status
+func (r *StarknetRPCReconciler) recordRestoredVolume(ctx context.Context, cluster *v1alpha1.StarknetRPC, pvc *corev1.PersistentVolumeClaim) error {
+	original := pvc.DeepCopy()
+	if pvc.Annotations == nil {
+		pvc.Annotations = make(map[string]string)
+	}
+	if source := getVolumeSnapshotSource(cluster); source != nil {
+		pvc.Annotations[VolumeSnapshotAnnotation] = source.Name
+	} else if source := getCloneSource(cluster); source != "" {
+		pvc.Annotations[ClonedFromAnnotation] = source
+	} else {
+		snapshot := getRestoredSnapshot(cluster)
+		pvc.Annotations[SnapshotAnnotation] = snapshot.FileName
+		pvc.Annotations[SnapshotChecksumAnnotation] = snapshot.Checksum
+	}
+	if err := r.Patch(ctx, pvc, client.MergeFrom(original)); err != nil {
+		return err
+	}
+
+	return condition.SetPhases(ctx, r.Client, cluster, func(rpc *v1alpha1.StarknetRPC) {
+		if rpc.Status.Restore == nil {
+			rpc.Status.Restore = &v1alpha1.RestoreStatus{}
+		}
+		rpc.Status.Restore.VolumeUID = pvc.UID
+	})
 }
 
 func (r *StarknetRPCReconciler) EnsurePvcReady(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
@@ -52,7 +230,7 @@ func (r *StarknetRPCReconciler) EnsurePvcReady(ctx context.Context, cluster *v1a
 		return nil, err
 	}
 
-	if !isReady(&pvc) {
+	if !isReady(&pvc) || pvc.DeletionTimestamp != nil {
 		contextLogger.V(10).Info("PVC is not ready yet", "pvc", pvc.Name)
 
 		return &ctrl.Result{RequeueAfter: time.Second}, reconcilier.ErrNextLoop
@@ -65,9 +243,22 @@ func isReady(pvc *corev1.PersistentVolumeClaim) bool {
 	return pvc.Status.Phase == corev1.ClaimBound
 }
 
+// getStorageClassName returns the storage class of the template, or nil to use the default storage class
+func getStorageClassName(storage *v1alpha1.StorageTemplate) *string {
+	if storage.Class == "" {
+		return nil
+	}
+	return &storage.Class
+}
+
 func (r *StarknetRPCReconciler) GetStoragePvcName(cluster *v1alpha1.StarknetRPC) types.NamespacedName {
+	return getStoragePvcName(cluster)
+}
+
+// getStoragePvcName returns the name of the data volume of the active color of the node
+func getStoragePvcName(cluster *v1alpha1.StarknetRPC) types.NamespacedName {
 	return types.NamespacedName{
-		Name:      fmt.Sprintf("%s-storage", cluster.Name),
+		Name:      fmt.Sprintf("%s-storage%s", cluster.Name, getColorSuffix(getActiveColor(cluster))),
 		Namespace: cluster.Namespace,
 	}
 }
@@ -95,7 +286,8 @@ func (r *StarknetRPCReconciler) GetWantedPvc(cluster *v1alpha1.StarknetRPC) core
 			AccessModes: []corev1.PersistentVolumeAccessMode{
 				corev1.ReadWriteOnce,
 			},
-			StorageClassName: &cluster.Spec.Storage.Class,
+			StorageClassName: getStorageClassName(&cluster.Spec.Storage),
+			DataSource:       getPvcDataSource(cluster),
 			Resources: corev1.VolumeResourceRequirements{
 				Requests: corev1.ResourceList{
 					corev1.ResourceStorage: cluster.Spec.Storage.Size,
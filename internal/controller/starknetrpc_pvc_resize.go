@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// resizePollInterval is the interval between two checks of a data volume being expanded
+	resizePollInterval = 30 * time.Second
+	// fileSystemResizeGracePeriod is how long the kubelet has to resize the filesystem of a mounted volume,
+	// before the pod is restarted for the filesystem to be resized when the volume is mounted again
+	fileSystemResizeGracePeriod = 5 * time.Minute
+)
+
+// ReconcilePvcSize expands the data volume when the size requested in the spec grows.
+//
+// The storage class must allow volume expansion. Volumes cannot be shrunk: a smaller size is refused and reported.
+// Once the storage driver expanded the volume, the filesystem is resized by the kubelet. Storage drivers that do
+// not support online expansion only resize it when the volume is mounted: the pod is then restarted.
+func (r *StarknetRPCReconciler) ReconcilePvcSize(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var pvc corev1.PersistentVolumeClaim
+	if err := r.Get(ctx, r.GetStoragePvcName(cluster), &pvc); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	// Only a bound volume can be expanded
+	if pvc.DeletionTimestamp != nil || !isReady(&pvc) {
+		return &ctrl.Result{}, nil
+	}
+
+	wanted := cluster.Spec.Storage.Size
+	requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+
+	switch wanted.Cmp(requested) {
+	case -1:
+		if getStorageStatus(cluster) != starknetrpc.StarknetRPCStorageStatusShrinkRefused {
+			logger.Info("Refusing to shrink the data volume", "pvc", pvc.Name, "size", requested.String(), "wanted", wanted.String())
+			r.Recorder.Event(cluster, "Warning", "ShrinkRefused",
+				fmt.Sprintf("The data volume %s cannot be shrunk from %s to %s", pvc.Name, requested.String(), wanted.String()))
+		}
+		return &ctrl.Result{}, r.setStorageStatus(ctx, cluster, starknetrpc.StarknetRPCStorageStatusShrinkRefused)
+	case 1:
+		return r.expandPvc(ctx, cluster, &pvc, wanted)
+	}
+
+	// The volume is being expanded, or was expanded
+	if isPvcConditionTrue(&pvc, corev1.PersistentVolumeClaimControllerResizeError) ||
+		isPvcConditionTrue(&pvc, corev1.PersistentVolumeClaimNodeResizeError) {
+		if getStorageStatus(cluster) != starknetrpc.StarknetRPCStorageStatusResizeFailed {
+			r.Recorder.Event(cluster, "Warning", "ResizeFailed",
+				fmt.Sprintf("Failed to expand the data volume %s: %s", pvc.Name, getPvcResizeError(&pvc)))
+		}
+		return &ctrl.Result{RequeueAfter: resizePollInterval}, r.setStorageStatus(ctx, cluster, starknetrpc.StarknetRPCStorageStatusResizeFailed)
+	}
+
+	if pending := findPvcCondition(&pvc, corev1.PersistentVolumeClaimFileSystemResizePending); pending != nil && pending.Status == corev1.ConditionTrue {
+		if err := r.setStorageStatus(ctx, cluster, starknetrpc.StarknetRPCStorageStatusFileSystemResizePending); err != nil {
+			return nil, err
+		}
+		if err := r.restartPodForFileSystemResize(ctx, cluster, pending); err != nil {
+			return nil, err
+		}
+		return &ctrl.Result{RequeueAfter: resizePollInterval}, nil
+	}
+
+	capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+	if isPvcConditionTrue(&pvc, corev1.PersistentVolumeClaimResizing) || capacity.Cmp(requested) < 0 {
+		return &ctrl.Result{RequeueAfter: resizePollInterval}, r.setStorageStatus(ctx, cluster, starknetrpc.StarknetRPCStorageStatusResizing)
+	}
+
+	current := getStorageStatus(cluster)
+	if current != "" && current != starknetrpc.StarknetRPCStorageStatusReady {
+		logger.Info("Data volume expanded", "pvc", pvc.Name, "size", capacity.String())
+		r.Recorder.Event(cluster, "Normal", "Resized", fmt.Sprintf("Data volume %s expanded to %s", pvc.Name, capacity.String()))
+	}
+	return &ctrl.Result{}, r.setStorageStatus(ctx, cluster, starknetrpc.StarknetRPCStorageStatusReady)
+}
+
+// expandPvc raises the storage request of the data volume, if its storage class allows it
+func (r *StarknetRPCReconciler) expandPvc(ctx context.Context, cluster *v1alpha1.StarknetRPC, pvc *corev1.PersistentVolumeClaim, size resource.Quantity) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+
+	expandable, err := r.isPvcExpandable(ctx, pvc)
+	if err != nil {
+		return nil, err
+	}
+	if !expandable {
+		if getStorageStatus(cluster) != starknetrpc.StarknetRPCStorageStatusResizeNotSupported {
+			logger.Info("The storage class of the data volume does not allow volume expansion", "pvc", pvc.Name)
+			r.Recorder.Event(cluster, "Warning", "ResizeNotSupported",
+				fmt.Sprintf("The storage class of the data volume %s does not allow its expansion to %s", pvc.Name, size.String()))
+		}
+		return &ctrl.Result{}, r.setStorageStatus(ctx, cluster, starknetrpc.StarknetRPCStorageStatusResizeNotSupported)
+	}
+
+	original := pvc.DeepCopy()
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = size
+	if err := r.Patch(ctx, pvc, client.MergeFrom(original)); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Expanding the data volume", "pvc", pvc.Name, "from", requested.String(), "to", size.String())
+	r.Recorder.Event(cluster, "Normal", "Resizing",
+		fmt.Sprintf("Expanding the data volume %s from %s to %s", pvc.Name, requested.String(), size.String()))
+	return &ctrl.Result{RequeueAfter: resizePollInterval}, r.setStorageStatus(ctx, cluster, starknetrpc.StarknetRPCStorageStatusResizing)
+}
+
+// isPvcExpandable returns true if the storage class of the volume allows volume expansion
+func (r *StarknetRPCReconciler) isPvcExpandable(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return false, nil
+	}
+
+	var storageClass storagev1.StorageClass
+	err := r.Get(ctx, client.ObjectKey{Name: *pvc.Spec.StorageClassName}, &storageClass)
+	if apierrs.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return storageClass.AllowVolumeExpansion != nil && *storageClass.AllowVolumeExpansion, nil
+}
+
+// restartPodForFileSystemResize deletes the pod of the node when the kubelet did not resize the filesystem
+// of the mounted volume in time. The pod is only restarted once: a pod started after the expansion
+// already mounted the expanded volume.
+func (r *StarknetRPCReconciler) restartPodForFileSystemResize(ctx context.Context, cluster *v1alpha1.StarknetRPC, pending *corev1.PersistentVolumeClaimCondition) error {
+	if time.Since(pending.LastTransitionTime.Time) < fileSystemResizeGracePeriod {
+		return nil
+	}
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, r.GetPodName(cluster), pod); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if pod.DeletionTimestamp != nil || !pod.CreationTimestamp.Before(&pending.LastTransitionTime) {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Restarting the node to resize the filesystem of the data volume", "pod", pod.Name)
+	r.Recorder.Event(cluster, "Normal", "PodRestarted",
+		fmt.Sprintf("Restarting pod %s to resize the filesystem of the data volume", pod.Name))
+	if err := r.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	return condition.SetPhases(ctx, r.Client, cluster, starknetrpc.StarknetRPCAvailableStatusCreating.Apply())
+}
+
+// setStorageStatus sets the Storage condition, if it changed
+func (r *StarknetRPCReconciler) setStorageStatus(ctx context.Context, cluster *v1alpha1.StarknetRPC, status starknetrpc.StarknetRPCStorageStatus) error {
+	if getStorageStatus(cluster) == status {
+		return nil
+	}
+	return condition.SetPhases(ctx, r.Client, cluster, status.Apply())
+}
+
+// getStorageStatus returns the reason of the Storage condition, or an empty status if it is not set
+func getStorageStatus(cluster *v1alpha1.StarknetRPC) starknetrpc.StarknetRPCStorageStatus {
+	storageCondition := meta.FindStatusCondition(cluster.Status.Conditions, string(starknetrpc.StarknetRPCStorageCondition))
+	if storageCondition == nil {
+		return ""
+	}
+	return starknetrpc.StarknetRPCStorageStatus(storageCondition.Reason)
+}
+
+func findPvcCondition(pvc *corev1.PersistentVolumeClaim, conditionType corev1.PersistentVolumeClaimConditionType) *corev1.PersistentVolumeClaimCondition {
+	for i := range pvc.Status.Conditions {
+		if pvc.Status.Conditions[i].Type == conditionType {
+			return &pvc.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func isPvcConditionTrue(pvc *corev1.PersistentVolumeClaim, conditionType corev1.PersistentVolumeClaimConditionType) bool {
+	pvcCondition := findPvcCondition(pvc, conditionType)
+	return pvcCondition != nil && pvcCondition.Status == corev1.ConditionTrue
+}
+
+// getPvcResizeError returns the message of the resize error reported on the volume
+func getPvcResizeError(pvc *corev1.PersistentVolumeClaim) string {
+	for _, conditionType := range []corev1.PersistentVolumeClaimConditionType{
+		corev1.PersistentVolumeClaimControllerResizeError,
+		corev1.PersistentVolumeClaimNodeResizeError,
+	} {
+		if pvcCondition := findPvcCondition(pvc, conditionType); pvcCondition != nil && pvcCondition.Status == corev1.ConditionTrue {
+			return pvcCondition.Message
+		}
+	}
+	return ""
+}
@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPC data volume", func() {
+	Context("When checking that the data volume holds the restored database", func() {
+		const (
+			resourceName = "test-starknet-rpc-volume"
+			namespace    = "default"
+			network      = "mainnet"
+		)
+
+		var (
+			ctx         context.Context
+			starknetRPC *v1alpha1.StarknetRPC
+			pvc         *corev1.PersistentVolumeClaim
+			reconciler  *StarknetRPCReconciler
+		)
+
+		restoreReason := func() string {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			restore := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Restore")
+			Expect(restore).NotTo(BeNil())
+			return restore.Reason
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			starknetRPC.Spec.RestoreArchive.Enable = &[]bool{true}[0]
+			createTestStarknetRPC(ctx, starknetRPC)
+
+			reconciler = &StarknetRPCReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
+			}
+
+			wanted := reconciler.GetWantedPvc(starknetRPC)
+			pvc = &wanted
+			Expect(k8sClient.Create(ctx, pvc)).Should(Succeed())
+
+			// The snapshot was restored on the volume
+			markArchiveAsFinished(starknetRPC)
+			starknetrpc.StarknetRPCAvailableStatusReady.Apply()(starknetRPC)
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).Should(Succeed())
+			Expect(reconciler.recordRestoredVolume(ctx, starknetRPC, pvc)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			current := &corev1.PersistentVolumeClaim{}
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(pvc), current); err == nil {
+				current.Finalizers = nil
+				_ = k8sClient.Update(ctx, current)
+				_ = k8sClient.Delete(ctx, current)
+			}
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should annotate the volume with the restored snapshot", func() {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pvc), pvc)).To(Succeed())
+			Expect(pvc.Annotations).To(HaveKeyWithValue(SnapshotAnnotation, "test-snapshot.tar"))
+			Expect(pvc.Annotations).To(HaveKeyWithValue(SnapshotChecksumAnnotation, "test-checksum"))
+			Expect(starknetRPC.Status.Restore.VolumeUID).To(Equal(pvc.UID))
+		})
+
+		It("Should keep an untouched volume", func() {
+			_, err := reconciler.CheckDataVolume(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restoreReason()).To(Equal("ArchiveJobFinished"))
+		})
+
+		It("Should reset the restore when the volume was replaced", func() {
+			starknetRPC.Status.Restore.VolumeUID = "a-previous-volume"
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).To(Succeed())
+
+			_, err := reconciler.CheckDataVolume(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusPending)))
+			Expect(starknetRPC.Status.Restore).To(BeNil())
+			available := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Available")
+			Expect(available.Reason).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusPending)))
+		})
+
+		It("Should reset the restore when the volume is deleted", func() {
+			Expect(k8sClient.Delete(ctx, pvc)).To(Succeed())
+
+			_, err := reconciler.CheckDataVolume(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusPending)))
+		})
+
+		It("Should reset the restore when the node syncs far below the snapshot", func() {
+			healthClient := proxy.NewFakeNodeHealthClient(499500, 500100)
+			reconciler.HealthClient = healthClient
+
+			starknetRPC.Status.Snapshot = &v1alpha1.ResolvedSnapshot{
+				FileName:    "test-snapshot.tar",
+				Checksum:    "test-checksum",
+				BlockHeight: 500000,
+			}
+			starknetrpc.StarknetRPCAvailableStatusCatchingUp.Apply()(starknetRPC)
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).To(Succeed())
+
+			pod := reconciler.GetWantedPod(starknetRPC)
+			Expect(k8sClient.Create(ctx, &pod)).To(Succeed())
+			DeferCleanup(func() { _ = k8sClient.Delete(ctx, &pod) })
+			pod.Status.Phase = corev1.PodRunning
+			Expect(k8sClient.Status().Update(ctx, &pod)).To(Succeed())
+
+			// The node resumes from the snapshot
+			_, err := reconciler.CheckDataVolume(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restoreReason()).To(Equal("ArchiveJobFinished"))
+
+			// The volume was re-provisioned empty, the node syncs from genesis
+			healthClient.SetSyncStatus(10, 500100)
+			_, err = reconciler.CheckDataVolume(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusPending)))
+		})
+
+		It("Should adopt the volume of a node restored before the volume was recorded", func() {
+			starknetRPC.Status.Restore = nil
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).To(Succeed())
+
+			_, err := reconciler.CheckDataVolume(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(restoreReason()).To(Equal("ArchiveJobFinished"))
+			Expect(starknetRPC.Status.Restore.VolumeUID).To(Equal(pvc.UID))
+		})
+	})
+
+	Context("When the requested size of the data volume changes", func() {
+		const (
+			resourceName = "test-starknet-rpc-volume-resize"
+			namespace    = "default"
+			network      = "mainnet"
+		)
+
+		var (
+			ctx          context.Context
+			starknetRPC  *v1alpha1.StarknetRPC
+			pvc          *corev1.PersistentVolumeClaim
+			storageClass *storagev1.StorageClass
+			reconciler   *StarknetRPCReconciler
+		)
+
+		storageReason := func() string {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			storage := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Storage")
+			Expect(storage).NotTo(BeNil())
+			return storage.Reason
+		}
+
+		requestedSize := func() string {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pvc), pvc)).To(Succeed())
+			return pvc.Spec.Resources.Requests.Storage().String()
+		}
+
+		setSize := func(size string) {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			starknetRPC.Spec.Storage.Size = resource.MustParse(size)
+			Expect(k8sClient.Update(ctx, starknetRPC)).To(Succeed())
+		}
+
+		// setVolumeStatus reports the capacity and the conditions of the volume, as done by the storage driver
+		setVolumeStatus := func(capacity string, conditions ...corev1.PersistentVolumeClaimCondition) {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pvc), pvc)).To(Succeed())
+			pvc.Status.Phase = corev1.ClaimBound
+			pvc.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(capacity)}
+			pvc.Status.Conditions = conditions
+			Expect(k8sClient.Status().Update(ctx, pvc)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			storageClass = &storagev1.StorageClass{
+				ObjectMeta:           metav1.ObjectMeta{Name: "test-expandable"},
+				Provisioner:          "test.csi.k8s.io",
+				AllowVolumeExpansion: &[]bool{true}[0],
+			}
+			Expect(k8sClient.Create(ctx, storageClass)).Should(Succeed())
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			starknetRPC.Spec.RestoreArchive.Enable = &[]bool{true}[0]
+			starknetRPC.Spec.Storage.Class = storageClass.Name
+			createTestStarknetRPC(ctx, starknetRPC)
+
+			reconciler = &StarknetRPCReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
+			}
+
+			wanted := reconciler.GetWantedPvc(starknetRPC)
+			pvc = &wanted
+			Expect(k8sClient.Create(ctx, pvc)).Should(Succeed())
+			setVolumeStatus("100Gi")
+		})
+
+		AfterEach(func() {
+			current := &corev1.PersistentVolumeClaim{}
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(pvc), current); err == nil {
+				current.Finalizers = nil
+				_ = k8sClient.Update(ctx, current)
+				_ = k8sClient.Delete(ctx, current)
+			}
+			_ = k8sClient.Delete(ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: reconciler.GetPodName(starknetRPC).Name, Namespace: namespace},
+			})
+			_ = k8sClient.Delete(ctx, storageClass)
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should report a volume with the requested size as ready", func() {
+			_, err := reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(storageReason()).To(Equal(string(starknetrpc.StarknetRPCStorageStatusReady)))
+		})
+
+		It("Should expand the volume when the requested size grows", func() {
+			setSize("200Gi")
+			_, err := reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requestedSize()).To(Equal("200Gi"))
+			Expect(storageReason()).To(Equal(string(starknetrpc.StarknetRPCStorageStatusResizing)))
+
+			By("Waiting for the filesystem to be resized")
+			setVolumeStatus("200Gi", corev1.PersistentVolumeClaimCondition{
+				Type:               corev1.PersistentVolumeClaimFileSystemResizePending,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: metav1.Now(),
+			})
+			_, err = reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(storageReason()).To(Equal(string(starknetrpc.StarknetRPCStorageStatusFileSystemResizePending)))
+
+			By("Reporting the expanded volume")
+			setVolumeStatus("200Gi")
+			_, err = reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(storageReason()).To(Equal(string(starknetrpc.StarknetRPCStorageStatusReady)))
+		})
+
+		It("Should not restart a pod started after the volume was expanded", func() {
+			setSize("200Gi")
+			_, err := reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			setVolumeStatus("200Gi", corev1.PersistentVolumeClaimCondition{
+				Type:               corev1.PersistentVolumeClaimFileSystemResizePending,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(time.Now().Add(-2 * fileSystemResizeGracePeriod)),
+			})
+			pod := reconciler.GetWantedPod(starknetRPC)
+			Expect(k8sClient.Create(ctx, &pod)).To(Succeed())
+
+			_, err = reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(&pod), &pod)).To(Succeed())
+			Expect(pod.DeletionTimestamp).To(BeNil())
+		})
+
+		It("Should refuse to shrink the volume", func() {
+			setSize("50Gi")
+			_, err := reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requestedSize()).To(Equal("100Gi"))
+			Expect(storageReason()).To(Equal(string(starknetrpc.StarknetRPCStorageStatusShrinkRefused)))
+		})
+
+		It("Should not expand a volume whose storage class does not allow it", func() {
+			storageClass.AllowVolumeExpansion = &[]bool{false}[0]
+			Expect(k8sClient.Update(ctx, storageClass)).To(Succeed())
+
+			setSize("200Gi")
+			_, err := reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requestedSize()).To(Equal("100Gi"))
+			Expect(storageReason()).To(Equal(string(starknetrpc.StarknetRPCStorageStatusResizeNotSupported)))
+		})
+	})
+})
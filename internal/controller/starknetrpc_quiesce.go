@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// QuiesceAnnotation is set on a StarknetRPC by the backup holding it, with the name of the backup,
+// or by the node copying its database, with `starknetrpc/<name>`.
+// The node is stopped as long as the annotation is set.
+const QuiesceAnnotation = "pathfinder.runelabs.xyz/quiesced-by"
+
+// ReconcileQuiesce stops the node while a backup (or a copy) holds it, and returns true while it is stopped.
+//
+// The annotation is removed when the backup holding the node is finished or deleted,
+// so that a node is never left stopped by a backup that is gone.
+func (r *StarknetRPCReconciler) ReconcileQuiesce(ctx context.Context, cluster *v1alpha1.StarknetRPC) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	holder, ok := cluster.Annotations[QuiesceAnnotation]
+	if !ok {
+		return false, nil
+	}
+
+	held, err := r.isQuiesceHeld(ctx, cluster, holder)
+	if err != nil {
+		return false, err
+	}
+	if !held {
+		logger.Info("Releasing the node, its holder is finished", "holder", holder)
+		return false, releaseQuiescedNode(ctx, r.Client, cluster, holder)
+	}
+
+	// The database must not be written to while it is being backed up
+	if err := r.deleteNode(ctx, cluster); err != nil {
+		return false, err
+	}
+
+	if getAvailableStatus(cluster) != starknetrpc.StarknetRPCAvailableStatusQuiesced {
+		logger.Info("Stopping the node", "holder", holder)
+		message := fmt.Sprintf("Node stopped while backup %s is running", holder)
+		if target, ok := strings.CutPrefix(holder, cloneQuiescePrefix); ok {
+			message = fmt.Sprintf("Node stopped while StarknetRPC %s copies its database", target)
+		}
+		r.Recorder.Event(cluster, "Normal", string(starknetrpc.StarknetRPCAvailableStatusQuiesced), message)
+		if err := condition.SetPhases(ctx, r.Client, cluster, starknetrpc.StarknetRPCAvailableStatusQuiesced.Apply()); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// isQuiesceHeld returns true while the backup, or the node copying the database, holding the node is running
+func (r *StarknetRPCReconciler) isQuiesceHeld(ctx context.Context, cluster *v1alpha1.StarknetRPC, holder string) (bool, error) {
+	if target, ok := strings.CutPrefix(holder, cloneQuiescePrefix); ok {
+		rpc := &v1alpha1.StarknetRPC{}
+		err := r.Get(ctx, types.NamespacedName{Name: target, Namespace: cluster.Namespace}, rpc)
+		if apierrs.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		// The copy job is only run while the restore of the target is in progress
+		return getRestoreReason(rpc) == string(starknetrpc.StarknetRPCRestoreStatusRestoring), nil
+	}
+
+	backup := &v1alpha1.StarknetRPCBackup{}
+	err := r.Get(ctx, types.NamespacedName{Name: holder, Namespace: cluster.Namespace}, backup)
+	if apierrs.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return !isBackupFinished(backup), nil
+}
+
+// releaseQuiescedNode removes the quiesce annotation of the node, if it is held by the holder
+func releaseQuiescedNode(ctx context.Context, c client.Client, cluster *v1alpha1.StarknetRPC, holder string) error {
+	if cluster.Annotations[QuiesceAnnotation] != holder {
+		return nil
+	}
+
+	original := cluster.DeepCopy()
+	delete(cluster.Annotations, QuiesceAnnotation)
+	return c.Patch(ctx, cluster, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+}
+
+func isBackupFinished(backup *v1alpha1.StarknetRPCBackup) bool {
+	return backup.Status.Phase == v1alpha1.StarknetRPCBackupPhaseCompleted ||
+		backup.Status.Phase == v1alpha1.StarknetRPCBackupPhaseFailed
+}
@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ResetAnnotation requests the reset of the node when set on a StarknetRPC, with a token of the user's choice.
+// The node is stopped, its data volume is re-created and the snapshot is restored again.
+// Each token is only handled once: set a new token to reset the node again.
+const ResetAnnotation = "pathfinder.runelabs.xyz/reset"
+
+// ReconcileReset wipes the data volume of the node when a new reset token is set,
+// and resets the restore so that the whole restore pipeline runs again on a new volume.
+func (r *StarknetRPCReconciler) ReconcileReset(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	token := cluster.Annotations[ResetAnnotation]
+	if token == "" || token == cluster.Status.LastResetToken {
+		return &ctrl.Result{}, nil
+	}
+
+	// The volume must not be deleted while it is being backed up
+	if _, ok := cluster.Annotations[QuiesceAnnotation]; ok {
+		logger.Info("Waiting for the node to be released before resetting it", "token", token)
+		return &ctrl.Result{}, nil
+	}
+
+	// The other color of a blue/green upgrade in progress runs on a copy of the database being reset:
+	// it must not be promoted over the restored database
+	aborted, err := r.abortUpgrade(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if !aborted {
+		logger.V(1).Info("Waiting for the upgrade in progress to be torn down", "token", token)
+		return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+	}
+
+	// Stop everything using the data volume, so that it can be deleted
+	if err := r.deleteNode(ctx, cluster); err != nil {
+		return nil, err
+	}
+	if err := r.deleteRestoreJobs(ctx, cluster); err != nil {
+		return nil, err
+	}
+
+	var pvc corev1.PersistentVolumeClaim
+	err = r.Get(ctx, r.GetStoragePvcName(cluster), &pvc)
+	if err != nil && !apierrs.IsNotFound(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		if pvc.DeletionTimestamp == nil {
+			logger.Info("Resetting the node", "token", token)
+			r.Recorder.Event(cluster, "Normal", "Reset",
+				fmt.Sprintf("Resetting the node (token %s): deleting the data volume %s", token, pvc.Name))
+
+			if err := r.Delete(ctx, &pvc); client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			err := condition.SetPhases(ctx, r.Client, cluster,
+				starknetrpc.StarknetRPCRestoreStatusPending.Apply(),
+				starknetrpc.StarknetRPCAvailableStatusPending.Apply(),
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Wait for the volume to be released by the pod
+		logger.V(1).Info("Waiting for the data volume to be deleted", "pvc", pvc.Name)
+		return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+	}
+
+	// The volume is gone: it is re-created, and restored, by the next reconciliation
+	err = r.resetRestore(ctx, cluster, func(rpc *v1alpha1.StarknetRPC) {
+		rpc.Status.LastResetToken = token
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Node reset, restoring the snapshot again", "token", token)
+
+	return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+}
+
+// abortUpgrade deletes the pod and the data volume of the other color of a blue/green upgrade in progress,
+// and forgets the upgrade. It returns whether no upgrade is in progress anymore.
+func (r *StarknetRPCReconciler) abortUpgrade(ctx context.Context, cluster *v1alpha1.StarknetRPC) (bool, error) {
+	upgrade := cluster.Status.Upgrade
+	if upgrade == nil {
+		return true, nil
+	}
+	switch upgrade.Phase {
+	case v1alpha1.UpgradePhaseCloning, v1alpha1.UpgradePhaseSyncing, v1alpha1.UpgradePhasePromoting:
+	default:
+		return true, nil
+	}
+
+	other := cluster.DeepCopy()
+	other.Status.ActiveColor = getOtherColor(getActiveColor(cluster))
+	deleted, err := r.deleteColor(ctx, other)
+	if err != nil || !deleted {
+		return false, err
+	}
+
+	log.FromContext(ctx).Info("Upgrade aborted by the reset", "image", upgrade.ToImage)
+	r.Recorder.Event(cluster, "Warning", "UpgradeAborted",
+		fmt.Sprintf("Upgrade to %s aborted, the node is reset", upgrade.ToImage))
+	err = condition.SetPhases(ctx, r.Client, cluster, func(rpc *v1alpha1.StarknetRPC) {
+		rpc.Status.Upgrade = nil
+	})
+	return err == nil, err
+}
+
+// deleteRestoreJobs deletes the jobs of all the restore attempts, which are named after the attempt number
+func (r *StarknetRPCReconciler) deleteRestoreJobs(ctx context.Context, cluster *v1alpha1.StarknetRPC) error {
+	deletePropagation := metav1.DeletePropagationBackground
+	for attempt := int32(1); attempt <= getRestoreStatus(cluster).Attempts; attempt++ {
+		err := r.Delete(ctx, &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: getRestoreJobName(cluster, attempt), Namespace: cluster.Namespace},
+		}, &client.DeleteOptions{PropagationPolicy: &deletePropagation})
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
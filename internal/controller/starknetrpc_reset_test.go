@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPC reset", func() {
+	Context("When a reset is requested through the annotation", func() {
+		const (
+			resourceName = "test-starknet-rpc-reset"
+			namespace    = "default"
+			network      = "mainnet"
+		)
+
+		var (
+			ctx         context.Context
+			starknetRPC *v1alpha1.StarknetRPC
+			pvc         *corev1.PersistentVolumeClaim
+			pod         *corev1.Pod
+			reconciler  *StarknetRPCReconciler
+		)
+
+		restoreReason := func() string {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			restore := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Restore")
+			Expect(restore).NotTo(BeNil())
+			return restore.Reason
+		}
+
+		requestReset := func(token string) {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			starknetRPC.Annotations = map[string]string{ResetAnnotation: token}
+			Expect(k8sClient.Update(ctx, starknetRPC)).To(Succeed())
+		}
+
+		// releaseVolume removes the protection of the volume, as done once the pod using it is gone
+		releaseVolume := func() {
+			current := &corev1.PersistentVolumeClaim{}
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(pvc), current); err == nil {
+				current.Finalizers = nil
+				_ = k8sClient.Update(ctx, current)
+			}
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			starknetRPC.Spec.RestoreArchive.Enable = &[]bool{true}[0]
+			createTestStarknetRPC(ctx, starknetRPC)
+
+			reconciler = &StarknetRPCReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
+			}
+
+			wanted := reconciler.GetWantedPvc(starknetRPC)
+			pvc = &wanted
+			Expect(k8sClient.Create(ctx, pvc)).Should(Succeed())
+
+			pod = &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      reconciler.GetPodName(starknetRPC).Name,
+					Namespace: namespace,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "rpc-pathfinder", Image: "eqlabs/pathfinder:v0.20.0"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+
+			// The snapshot was restored on the volume
+			markArchiveAsFinished(starknetRPC)
+			starknetrpc.StarknetRPCAvailableStatusReady.Apply()(starknetRPC)
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).Should(Succeed())
+			Expect(reconciler.recordRestoredVolume(ctx, starknetRPC, pvc)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			releaseVolume()
+			_ = k8sClient.Delete(ctx, pvc)
+			_ = k8sClient.Delete(ctx, pod)
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should do nothing without a reset token", func() {
+			_, err := reconciler.ReconcileReset(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restoreReason()).To(Equal("ArchiveJobFinished"))
+		})
+
+		It("Should wipe the data volume and restore the snapshot again", func() {
+			requestReset("incident-42")
+
+			By("Stopping the node and deleting its data volume")
+			_, err := reconciler.ReconcileReset(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})
+			Expect(apierrs.IsNotFound(err)).To(BeTrue())
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusPending)))
+			Expect(starknetRPC.Status.LastResetToken).To(BeEmpty())
+
+			By("Resetting the restore once the volume is gone")
+			releaseVolume()
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(pvc), &corev1.PersistentVolumeClaim{})
+				return apierrs.IsNotFound(err)
+			}).Should(BeTrue())
+
+			_, err = reconciler.ReconcileReset(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusPending)))
+			Expect(starknetRPC.Status.Restore).To(BeNil())
+			Expect(starknetRPC.Status.LastResetToken).To(Equal("incident-42"))
+
+			By("Handling the token only once")
+			_, err = reconciler.ReconcileReset(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should tear down a blue/green upgrade in progress before wiping the data volume", func() {
+			// The new version runs on a clone of the database
+			candidate := starknetRPC.DeepCopy()
+			candidate.Status.ActiveColor = v1alpha1.NodeColorGreen
+			candidatePvc := reconciler.GetWantedPvc(candidate)
+			Expect(k8sClient.Create(ctx, &candidatePvc)).To(Succeed())
+			candidatePod := pod.DeepCopy()
+			candidatePod.ObjectMeta = metav1.ObjectMeta{Name: reconciler.GetPodName(candidate).Name, Namespace: namespace}
+			Expect(k8sClient.Create(ctx, candidatePod)).To(Succeed())
+			releaseCandidateVolume := func() {
+				current := &corev1.PersistentVolumeClaim{}
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&candidatePvc), current); err == nil {
+					current.Finalizers = nil
+					_ = k8sClient.Update(ctx, current)
+				}
+			}
+			DeferCleanup(func() {
+				releaseCandidateVolume()
+				_ = k8sClient.Delete(ctx, &candidatePvc)
+				_ = k8sClient.Delete(ctx, candidatePod)
+			})
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			starknetRPC.Status.Upgrade = &v1alpha1.UpgradeStatus{
+				Phase:     v1alpha1.UpgradePhaseSyncing,
+				FromImage: "eqlabs/pathfinder:v0.20.0",
+				ToImage:   "eqlabs/pathfinder:v0.21.0",
+				Color:     v1alpha1.NodeColorGreen,
+			}
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).To(Succeed())
+
+			requestReset("incident-43")
+
+			By("Deleting the new version and its cloned volume")
+			_, err := reconciler.ReconcileReset(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			releaseCandidateVolume()
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&candidatePvc), &corev1.PersistentVolumeClaim{})
+				return apierrs.IsNotFound(err)
+			}).Should(BeTrue())
+
+			By("Forgetting the upgrade before wiping the data volume")
+			_, err = reconciler.ReconcileReset(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusPending)))
+			Expect(starknetRPC.Status.Upgrade).To(BeNil())
+
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(candidatePod), &corev1.Pod{})
+			Expect(apierrs.IsNotFound(err)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/snapshotter"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/podlogs"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// restoreContainerName is the name of the container of the restore job
+	restoreContainerName = "archive-downloader"
+	// restoreProgressLines is the number of log lines searched for the latest progress report of the restore job
+	restoreProgressLines = 20
+)
+
+// ReconcileRestoreProgress records in the status the latest progress reported in the logs of the running restore job.
+// The progress is only informative, so failing to read it does not fail the reconciliation.
+func (r *StarknetRPCReconciler) ReconcileRestoreProgress(ctx context.Context, cluster *v1alpha1.StarknetRPC, job *batchv1.Job) error {
+	logger := log.FromContext(ctx)
+
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name})
+	if err != nil {
+		return err
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+
+		logs, err := r.getLogReader().Tail(ctx, pod, restoreContainerName, restoreProgressLines)
+		if err != nil {
+			logger.V(1).Info("Failed to read the logs of the restore job", "pod", pod.Name, "error", err)
+			return nil
+		}
+
+		progress := parseRestoreProgress(logs)
+		if progress == nil || !hasRestoreProgressChanged(getRestoreStatus(cluster), progress) {
+			return nil
+		}
+
+		logger.V(1).Info("Restore progress", "phase", progress.Phase, "bytesDone", progress.BytesDone, "bytesTotal", progress.BytesTotal)
+		return condition.SetPhases(ctx, r.Client, cluster, setRestoreProgress(progress))
+	}
+	return nil
+}
+
+// markRestoreProgressAsCompleted records the end of the restore, once the job succeeded
+func markRestoreProgressAsCompleted(rpc *v1alpha1.StarknetRPC) {
+	next := getRestoreStatus(rpc).DeepCopy()
+	next.Phase = v1alpha1.RestorePhaseCompleted
+	next.BytesDone = next.BytesTotal
+	now := metav1.Now()
+	next.LastProgressTime = &now
+	next.CompletionTime = &now
+	rpc.Status.Restore = next
+}
+
+// parseRestoreProgress returns the latest progress report of the logs, or nil if there is none
+func parseRestoreProgress(logs []byte) *snapshotter.Progress {
+	lines := bytes.Split(logs, []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := bytes.TrimSpace(lines[i])
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+
+		progress := &snapshotter.Progress{}
+		if err := json.Unmarshal(line, progress); err == nil && progress.Phase != "" {
+			return progress
+		}
+	}
+	return nil
+}
+
+func hasRestoreProgressChanged(restore *v1alpha1.RestoreStatus, progress *snapshotter.Progress) bool {
+	return restore.Phase != v1alpha1.RestorePhase(progress.Phase) ||
+		restore.BytesDone != progress.BytesDone ||
+		restore.BytesTotal != progress.BytesTotal
+}
+
+func setRestoreProgress(progress *snapshotter.Progress) condition.StateTransition {
+	return func(rpc *v1alpha1.StarknetRPC) {
+		next := getRestoreStatus(rpc).DeepCopy()
+		next.Phase = v1alpha1.RestorePhase(progress.Phase)
+		next.BytesDone = progress.BytesDone
+		next.BytesTotal = progress.BytesTotal
+		now := metav1.Now()
+		next.LastProgressTime = &now
+		rpc.Status.Restore = next
+	}
+}
+
+// getLogReader returns the reader used to read the progress of the restore jobs
+func (r *StarknetRPCReconciler) getLogReader() podlogs.Reader {
+	if r.LogReader == nil {
+		r.LogReader = podlogs.NewReader(r.Interface)
+	}
+	return r.LogReader
+}
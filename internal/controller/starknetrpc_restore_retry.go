@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	defaultRestoreMaxAttempts    int32 = 3
+	defaultRestoreInitialBackoff       = 30 * time.Second
+	defaultRestoreMaxBackoff           = 10 * time.Minute
+)
+
+// StartRestoreAttempt starts a new restore job, once the backoff of the previous failure elapsed.
+// Nothing is started anymore once the maximum number of attempts is reached.
+func (r *StarknetRPCReconciler) StartRestoreAttempt(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	restore := getRestoreStatus(cluster)
+	maxAttempts := getRestoreMaxAttempts(cluster)
+	if restore.FailedAttempts >= maxAttempts {
+		// Wait for the retry policy to be updated
+		logger.V(1).Info("Restore failed too many times, not retrying", "attempts", restore.Attempts, "maxAttempts", maxAttempts)
+		return &ctrl.Result{}, errs.ErrNextLoop
+	}
+
+	if restore.FailedAttempts > 0 && restore.LastFailureTime != nil {
+		wait := time.Until(restore.LastFailureTime.Add(getRestoreBackoff(cluster, restore.FailedAttempts)))
+		if wait > 0 {
+			logger.V(1).Info("Waiting before retrying the restore", "wait", wait)
+			return &ctrl.Result{RequeueAfter: wait}, errs.ErrNextLoop
+		}
+	}
+
+	// Delete the job of the previous attempt, unless it is kept for its logs
+	if restore.JobName != "" && getRestoreJobCleanupPolicy(cluster) == v1alpha1.RestoreJobCleanupDelete {
+		deletePropagation := metav1.DeletePropagationBackground
+		err := r.Delete(ctx, &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: restore.JobName, Namespace: cluster.Namespace},
+		}, &client.DeleteOptions{PropagationPolicy: &deletePropagation})
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	}
+
+	next := restore.DeepCopy()
+	next.Attempts++
+	next.JobName = getRestoreJobName(cluster, next.Attempts)
+	now := metav1.Now()
+	next.LastAttemptTime = &now
+	if next.StartTime == nil {
+		next.StartTime = &now
+	}
+	// The progress is reported again by the new job
+	next.Snapshot = getRestoredSnapshot(cluster).FileName
+	next.Phase = ""
+	next.BytesDone = 0
+	next.BytesTotal = 0
+	next.LastProgressTime = nil
+	next.CompletionTime = nil
+
+	err := condition.SetPhases(ctx, r.Client, cluster, markRestoreAsProgressing, func(rpc *v1alpha1.StarknetRPC) {
+		rpc.Status.Restore = next
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	restoreJob := r.GetWantedRestoreJob(cluster)
+	if err := r.Create(ctx, &restoreJob); err != nil && !apierrs.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	logger.Info("Started restore attempt", "job", restoreJob.Name, "attempt", next.Attempts, "maxAttempts", maxAttempts)
+	r.Recorder.Event(cluster, "Normal", "RestoreStarted",
+		fmt.Sprintf("Starting restore attempt %d/%d", next.Attempts, maxAttempts))
+	if cluster.Spec.RestoreArchive.RsyncConfig != nil {
+		r.Recorder.Event(cluster, "Warning", "DeprecatedField",
+			"restoreArchive.rsyncConfig is deprecated, store the rclone configuration in a secret referenced by restoreArchive.configSecretRef")
+	}
+
+	// We just created the job, so early exit
+	return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+}
+
+// RecordRestoreFailure records the failure of the current restore attempt, and schedules the next one
+func (r *StarknetRPCReconciler) RecordRestoreFailure(ctx context.Context, cluster *v1alpha1.StarknetRPC, job *batchv1.Job) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	reason := getJobFailureReason(ctx, r.Client, job)
+
+	next := getRestoreStatus(cluster).DeepCopy()
+	next.FailedAttempts = next.Attempts
+	now := metav1.Now()
+	next.LastFailureTime = &now
+	next.LastFailureReason = reason
+
+	maxAttempts := getRestoreMaxAttempts(cluster)
+	message := fmt.Sprintf("Restore attempt %d/%d failed: %s", next.Attempts, maxAttempts, reason)
+
+	err := condition.SetPhases(ctx, r.Client, cluster, markRestoreAsFailed(message), func(rpc *v1alpha1.StarknetRPC) {
+		rpc.Status.Restore = next
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Restore attempt failed", "job", job.Name, "attempt", next.Attempts, "reason", reason)
+	r.Recorder.Event(cluster, "Warning", "RestoreFailed", message)
+
+	if next.FailedAttempts >= maxAttempts {
+		r.Recorder.Event(cluster, "Warning", "RestoreGaveUp",
+			fmt.Sprintf("Restore failed %d times, not retrying until the retry policy is updated", next.FailedAttempts))
+		return &ctrl.Result{}, errs.ErrNextLoop
+	}
+
+	return &ctrl.Result{RequeueAfter: getRestoreBackoff(cluster, next.FailedAttempts)}, errs.ErrNextLoop
+}
+
+// getRestoreBackoff returns the delay to wait after the given number of failures
+func getRestoreBackoff(cluster *v1alpha1.StarknetRPC, failures int32) time.Duration {
+	initial, maximum := defaultRestoreInitialBackoff, defaultRestoreMaxBackoff
+	if policy := cluster.Spec.RestoreArchive.RetryPolicy; policy != nil {
+		if policy.InitialBackoff != nil {
+			initial = policy.InitialBackoff.Duration
+		}
+		if policy.MaxBackoff != nil {
+			maximum = policy.MaxBackoff.Duration
+		}
+	}
+
+	backoff := initial
+	for i := int32(1); i < failures && backoff < maximum; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maximum)
+}
+
+func getRestoreMaxAttempts(cluster *v1alpha1.StarknetRPC) int32 {
+	policy := cluster.Spec.RestoreArchive.RetryPolicy
+	if policy == nil || policy.MaxAttempts == nil {
+		return defaultRestoreMaxAttempts
+	}
+	return *policy.MaxAttempts
+}
+
+func getRestoreStatus(cluster *v1alpha1.StarknetRPC) *v1alpha1.RestoreStatus {
+	if cluster.Status.Restore == nil {
+		return &v1alpha1.RestoreStatus{}
+	}
+	return cluster.Status.Restore
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ReconcileService reconciles the Service exposing the RPC and WebSocket APIs of the node
+func (r *StarknetRPCReconciler) ReconcileService(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	contextLogger := log.FromContext(ctx)
+
+	service := r.GetWantedService(cluster)
+
+	created, err := reconciler.CreateOrReconcile(ctx, r.Client, &service,
+		ServiceSpecReconciler(cluster),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if created {
+		contextLogger.Info("Service created", "name", service.Name)
+		r.Recorder.Event(cluster, "Normal", "ServiceCreated",
+			fmt.Sprintf("Service %s created", service.Name))
+	}
+
+	return &ctrl.Result{}, nil
+}
+
+// ServiceSpecReconciler ensures the Service spec is up to date
+func ServiceSpecReconciler(rpc *v1alpha1.StarknetRPC) reconciler.ObjectReconcilier[*corev1.Service] {
+	contextLogger := log.Log
+	return reconciler.ObjectReconcilier[*corev1.Service]{
+		Name: "ServiceSpecReconciler",
+		IsUpToDate: func(service *corev1.Service) bool {
+			if service.Spec.Type != getServiceType(rpc) {
+				contextLogger.V(1).Info("Service type mismatch", "current", service.Spec.Type, "expected", getServiceType(rpc))
+				return false
+			}
+
+			if !equality.Semantic.DeepEqual(service.Spec.Selector, getServiceSelector(rpc)) {
+				contextLogger.V(1).Info("Service selector mismatch", "current", service.Spec.Selector, "expected", getServiceSelector(rpc))
+				return false
+			}
+
+			expectedPorts := getServicePorts(rpc)
+			if len(service.Spec.Ports) != len(expectedPorts) {
+				contextLogger.V(1).Info("Service ports len mismatch", "current", service.Spec.Ports, "expected", expectedPorts)
+				return false
+			}
+			for i, want := range expectedPorts {
+				if !isServicePortUpToDate(service.Spec.Ports[i], want) {
+					contextLogger.V(1).Info("Service port mismatch", "current", service.Spec.Ports[i], "expected", want)
+					return false
+				}
+			}
+
+			for k, v := range getServiceLabels(rpc) {
+				if service.Labels[k] != v {
+					contextLogger.V(1).Info("Service label mismatch", "key", k, "current", service.Labels[k], "expected", v)
+					return false
+				}
+			}
+			for k, v := range getServiceAnnotations(rpc) {
+				if service.Annotations[k] != v {
+					contextLogger.V(1).Info("Service annotation mismatch", "key", k, "current", service.Annotations[k], "expected", v)
+					return false
+				}
+			}
+
+			return true
+		},
+		Update: func(service *corev1.Service) error {
+			serviceType := getServiceType(rpc)
+
+			// Keep the node ports allocated by the API server, unless they are not allowed anymore
+			nodePorts := make(map[string]int32, len(service.Spec.Ports))
+			for _, port := range service.Spec.Ports {
+				nodePorts[port.Name] = port.NodePort
+			}
+			ports := getServicePorts(rpc)
+			for i := range ports {
+				if ports[i].NodePort == 0 && serviceType != corev1.ServiceTypeClusterIP {
+					ports[i].NodePort = nodePorts[ports[i].Name]
+				}
+			}
+
+			service.Spec.Type = serviceType
+			service.Spec.Selector = getServiceSelector(rpc)
+			service.Spec.Ports = ports
+
+			if service.Labels == nil {
+				service.Labels = make(map[string]string)
+			}
+			maps.Copy(service.Labels, getServiceLabels(rpc))
+			if service.Annotations == nil {
+				service.Annotations = make(map[string]string)
+			}
+			maps.Copy(service.Annotations, getServiceAnnotations(rpc))
+			return nil
+		},
+	}
+}
+
+// isServicePortUpToDate compares the fields of the port we manage, ignoring the ones defaulted by the API server
+func isServicePortUpToDate(current corev1.ServicePort, want corev1.ServicePort) bool {
+	protocol := want.Protocol
+	if protocol == "" {
+		protocol = corev1.ProtocolTCP
+	}
+	targetPort := want.TargetPort
+	if targetPort.IntVal == 0 && targetPort.StrVal == "" {
+		targetPort = intstr.FromInt32(want.Port)
+	}
+
+	return current.Name == want.Name &&
+		current.Port == want.Port &&
+		current.Protocol == protocol &&
+		current.TargetPort == targetPort &&
+		(want.NodePort == 0 || current.NodePort == want.NodePort)
+}
+
+// GetServiceName returns the name and namespace for the Service
+func (r *StarknetRPCReconciler) GetServiceName(cluster *v1alpha1.StarknetRPC) types.NamespacedName {
+	return types.NamespacedName{
+		Name:      fmt.Sprintf("%s-rpc", cluster.Name),
+		Namespace: cluster.Namespace,
+	}
+}
+
+func getServiceType(cluster *v1alpha1.StarknetRPC) corev1.ServiceType {
+	if cluster.Spec.Service == nil || cluster.Spec.Service.Type == "" {
+		return corev1.ServiceTypeClusterIP
+	}
+	return cluster.Spec.Service.Type
+}
+
+// getServiceSelector returns the labels selecting the RPC pod of the node
+func getServiceSelector(cluster *v1alpha1.StarknetRPC) map[string]string {
+	selector := map[string]string{
+		"rpc.runelabs.xyz/name": cluster.Name,
+		ComponentLabel:          ComponentNode,
+	}
+	if isBlueGreenUpgrade(cluster) {
+		selector[ColorLabel] = getColorLabelValue(getActiveColor(cluster))
+	}
+	return selector
+}
+
+// getServicePorts returns the `rpc` port, followed by the additional ports of the configuration
+func getServicePorts(cluster *v1alpha1.StarknetRPC) []corev1.ServicePort {
+	ports := []corev1.ServicePort{
+		{
+			// Pathfinder serves the WebSocket API on the same port as the JSON-RPC API
+			Name:       proxy.RPCPortName,
+			Port:       9545,
+			TargetPort: intstr.FromString(proxy.RPCPortName),
+			Protocol:   corev1.ProtocolTCP,
+		},
+	}
+
+	if cluster.Spec.Service != nil {
+		for _, port := range cluster.Spec.Service.AdditionalPorts {
+			ports = append(ports, *port.DeepCopy())
+		}
+	}
+
+	return ports
+}
+
+// getServiceLabels returns the labels for the Service resource
+func getServiceLabels(cluster *v1alpha1.StarknetRPC) map[string]string {
+	labels := map[string]string{
+		"rpc.runelabs.xyz/type":        "starknet",
+		"rpc.runelabs.xyz/name":        cluster.Name,
+		"runelabs.xyz/network":         cluster.Spec.Network,
+		"app.kubernetes.io/name":       "starknet-rpc",
+		"app.kubernetes.io/instance":   cluster.Name,
+		"app.kubernetes.io/managed-by": "starknet-operator",
+	}
+
+	if cluster.Spec.Service != nil {
+		maps.Copy(labels, cluster.Spec.Service.Labels)
+	}
+
+	return labels
+}
+
+// getServiceAnnotations returns the annotations for the Service resource
+func getServiceAnnotations(cluster *v1alpha1.StarknetRPC) map[string]string {
+	annotations := make(map[string]string)
+	if cluster.Spec.Service != nil {
+		maps.Copy(annotations, cluster.Spec.Service.Annotations)
+	}
+	return annotations
+}
+
+// GetWantedService returns the desired Service resource
+func (r *StarknetRPCReconciler) GetWantedService(cluster *v1alpha1.StarknetRPC) corev1.Service {
+	nameInfo := r.GetServiceName(cluster)
+
+	service := corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      getServiceLabels(cluster),
+			Annotations: getServiceAnnotations(cluster),
+			Name:        nameInfo.Name,
+			Namespace:   nameInfo.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion:         cluster.APIVersion,
+					Kind:               cluster.Kind,
+					Name:               cluster.Name,
+					UID:                cluster.UID,
+					Controller:         &[]bool{true}[0],
+					BlockOwnerDeletion: &[]bool{true}[0],
+				},
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     getServiceType(cluster),
+			Selector: getServiceSelector(cluster),
+			Ports:    getServicePorts(cluster),
+		},
+	}
+
+	return service
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPC Service Controller", func() {
+	Context("When reconciling the Service of a StarknetRPC resource", func() {
+		const (
+			resourceName = "test-starknet-rpc-service"
+			namespace    = "default"
+			network      = "mainnet"
+		)
+
+		var (
+			ctx         context.Context
+			starknetRPC *v1alpha1.StarknetRPC
+			reconciler  *StarknetRPCReconciler
+			serviceName types.NamespacedName
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			createTestStarknetRPC(ctx, starknetRPC)
+
+			reconciler = &StarknetRPCReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
+			}
+			serviceName = types.NamespacedName{
+				Name:      fmt.Sprintf("%s-rpc", resourceName),
+				Namespace: namespace,
+			}
+		})
+
+		AfterEach(func() {
+			_ = k8sClient.Delete(ctx, &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: serviceName.Name, Namespace: serviceName.Namespace},
+			})
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should create a ClusterIP Service exposing the rpc port by default", func() {
+			_, err := reconciler.ReconcileService(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, serviceName, service)).To(Succeed())
+
+			Expect(service.Spec.Type).To(Equal(corev1.ServiceTypeClusterIP))
+			Expect(service.Spec.Selector).To(Equal(map[string]string{
+				"rpc.runelabs.xyz/name": resourceName,
+				ComponentLabel:          ComponentNode,
+			}))
+			Expect(service.Spec.Ports).To(HaveLen(1))
+			Expect(service.Spec.Ports[0].Name).To(Equal("rpc"))
+			Expect(service.Spec.Ports[0].Port).To(Equal(int32(9545)))
+			Expect(service.Spec.Ports[0].TargetPort).To(Equal(intstr.FromString("rpc")))
+
+			Expect(service.OwnerReferences).To(HaveLen(1))
+			Expect(service.OwnerReferences[0].Name).To(Equal(resourceName))
+			Expect(service.OwnerReferences[0].Kind).To(Equal("StarknetRPC"))
+		})
+
+		It("Should apply the service configuration of the spec", func() {
+			starknetRPC.Spec.Service = &v1alpha1.ServiceTemplate{
+				Type:        corev1.ServiceTypeNodePort,
+				Annotations: map[string]string{"example.com/lb": "internal"},
+				AdditionalPorts: []corev1.ServicePort{
+					{
+						Name: "monitoring",
+						Port: 9000,
+					},
+				},
+			}
+
+			_, err := reconciler.ReconcileService(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, serviceName, service)).To(Succeed())
+
+			Expect(service.Spec.Type).To(Equal(corev1.ServiceTypeNodePort))
+			Expect(service.Annotations).To(HaveKeyWithValue("example.com/lb", "internal"))
+			Expect(service.Spec.Ports).To(HaveLen(2))
+			Expect(service.Spec.Ports[1].Name).To(Equal("monitoring"))
+			Expect(service.Spec.Ports[1].Port).To(Equal(int32(9000)))
+		})
+
+		It("Should correct a drifted Service", func() {
+			_, err := reconciler.ReconcileService(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			// Modify the Service to simulate drift
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, serviceName, service)).To(Succeed())
+			service.Spec.Selector = map[string]string{"app": "something-else"}
+			service.Spec.Ports[0].Port = 8080
+			Expect(k8sClient.Update(ctx, service)).To(Succeed())
+
+			_, err = reconciler.ReconcileService(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, serviceName, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(Equal(map[string]string{
+				"rpc.runelabs.xyz/name": resourceName,
+				ComponentLabel:          ComponentNode,
+			}))
+			Expect(service.Spec.Ports[0].Port).To(Equal(int32(9545)))
+		})
+
+		It("Should only select the pod of the node, not the pods of its jobs", func() {
+			_, err := reconciler.ReconcileService(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, serviceName, service)).To(Succeed())
+			selector := labels.SelectorFromSet(service.Spec.Selector)
+
+			pod := reconciler.GetWantedPod(starknetRPC)
+			Expect(selector.Matches(labels.Set(pod.Labels))).To(BeTrue())
+
+			// The restore, backup and clone jobs carry the name of the node too
+			jobPod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("%s-restore", resourceName),
+					Namespace: namespace,
+					Labels:    getRestoreJobLabels(starknetRPC),
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "restore", Image: "busybox"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, jobPod)).To(Succeed())
+			defer func() { _ = k8sClient.Delete(ctx, jobPod) }()
+
+			pods := &corev1.PodList{}
+			Expect(k8sClient.List(ctx, pods,
+				client.InNamespace(namespace),
+				client.MatchingLabels(service.Spec.Selector),
+			)).To(Succeed())
+			for _, p := range pods.Items {
+				Expect(p.Name).NotTo(Equal(jobPod.Name))
+			}
+		})
+	})
+})
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/snapshot"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// snapshotResolveRetryInterval is the interval between two attempts to resolve the snapshot from the index
+const snapshotResolveRetryInterval = time.Minute
+
+// ResolveSnapshot pins the snapshot to restore in the status, either from the spec,
+// or by looking up the most recent matching snapshot in the index.
+//
+// The snapshot is only resolved once, so that a new snapshot being published in the
+// index does not change the restore that is in progress.
+func (r *StarknetRPCReconciler) ResolveSnapshot(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if cluster.Status.Snapshot != nil {
+		return &ctrl.Result{}, nil
+	}
+
+	archive := &cluster.Spec.RestoreArchive
+	resolved := &v1alpha1.ResolvedSnapshot{
+		FileName: archive.FileName,
+		Checksum: archive.Checksum,
+	}
+
+	if archive.FileName == "" || archive.Checksum == "" {
+		if archive.Index == nil {
+			err := fmt.Errorf("no snapshot index configured: set restoreArchive.index, or both fileName and checksum")
+			logger.Info("Cannot resolve the snapshot to restore", "reason", err.Error())
+			r.Recorder.Event(cluster, "Warning", "SnapshotResolutionFailed", err.Error())
+			if err := condition.SetPhases(ctx, r.Client, cluster, markSnapshotResolutionAsFailed(err)); err != nil {
+				return nil, err
+			}
+			// Wait for the spec to be fixed
+			return &ctrl.Result{}, errs.ErrNextLoop
+		}
+
+		found, err := r.getSnapshotResolver().Resolve(ctx, archive.Index.URL, cluster.Spec.Network, archive.Index.Version)
+		if err != nil {
+			logger.Error(err, "Failed to resolve the snapshot to restore", "index", archive.Index.URL)
+			r.Recorder.Event(cluster, "Warning", "SnapshotResolutionFailed", err.Error())
+			if err := condition.SetPhases(ctx, r.Client, cluster, markSnapshotResolutionAsFailed(err)); err != nil {
+				return nil, err
+			}
+			return &ctrl.Result{RequeueAfter: snapshotResolveRetryInterval}, errs.ErrNextLoop
+		}
+
+		resolved = &v1alpha1.ResolvedSnapshot{
+			FileName:      found.FileName,
+			Checksum:      found.Checksum,
+			Size:          found.Size,
+			ExtractedSize: found.ExtractedSize,
+			BlockHeight:   found.BlockHeight,
+			Version:       found.Version,
+		}
+		logger.Info("Resolved the snapshot to restore", "fileName", found.FileName, "blockHeight", found.BlockHeight)
+		r.Recorder.Event(cluster, "Normal", "SnapshotResolved",
+			fmt.Sprintf("Restoring snapshot %s at block %d", found.FileName, found.BlockHeight))
+	}
+
+	err := condition.SetPhases(ctx, r.Client, cluster, func(rpc *v1alpha1.StarknetRPC) {
+		rpc.Status.Snapshot = resolved
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ctrl.Result{}, nil
+}
+
+func markSnapshotResolutionAsFailed(cause error) condition.StateTransition {
+	return func(cluster *v1alpha1.StarknetRPC) {
+		meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+			Type:    "Restore",
+			Status:  metav1.ConditionFalse,
+			Reason:  "SnapshotResolutionFailed",
+			Message: fmt.Sprintf("Failed to resolve the snapshot to restore: %s", cause),
+		})
+	}
+}
+
+// getSnapshotResolver returns the resolver used to look up the snapshots in the index
+func (r *StarknetRPCReconciler) getSnapshotResolver() snapshot.Resolver {
+	if r.SnapshotResolver == nil {
+		r.SnapshotResolver = snapshot.NewResolver(nil)
+	}
+	return r.SnapshotResolver
+}
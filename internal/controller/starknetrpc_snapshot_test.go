@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/snapshot"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPC snapshot resolution", func() {
+	Context("When resolving the snapshot to restore", func() {
+		const (
+			resourceName = "test-starknet-rpc-snapshot"
+			namespace    = "default"
+			network      = "mainnet"
+			indexURL     = "https://snapshots.example.com/index.json"
+		)
+
+		var (
+			ctx         context.Context
+			starknetRPC *v1alpha1.StarknetRPC
+			resolver    *snapshot.FakeResolver
+			reconciler  *StarknetRPCReconciler
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			starknetRPC.Spec.RestoreArchive = v1alpha1.ArchiveSnapshot{
+				Index: &v1alpha1.SnapshotIndex{
+					URL: indexURL,
+				},
+				Storage: v1alpha1.StorageTemplate{
+					Size: resource.MustParse("10Gi"),
+				},
+			}
+
+			resolver = &snapshot.FakeResolver{
+				Index: snapshot.Index{
+					Snapshots: []snapshot.Snapshot{
+						{Network: network, FileName: "mainnet_0.15.0_1000.sqlite.zst", Checksum: "aaa", Size: 100, BlockHeight: 1000, Version: "0.15.0"},
+						{Network: network, FileName: "mainnet_0.16.0_2000.sqlite.zst", Checksum: "bbb", Size: 200, BlockHeight: 2000, Version: "0.16.0"},
+						{Network: "sepolia-testnet", FileName: "sepolia_0.16.0_3000.sqlite.zst", Checksum: "ccc", Size: 50, BlockHeight: 3000, Version: "0.16.0"},
+					},
+				},
+			}
+			reconciler = &StarknetRPCReconciler{
+				Client:           k8sClient,
+				Scheme:           k8sClient.Scheme(),
+				Recorder:         record.NewFakeRecorder(10),
+				SnapshotResolver: resolver,
+			}
+		})
+
+		AfterEach(func() {
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should pin the snapshot configured in the spec", func() {
+			starknetRPC.Spec.RestoreArchive.Index = nil
+			starknetRPC.Spec.RestoreArchive.FileName = "test-snapshot.tar"
+			starknetRPC.Spec.RestoreArchive.Checksum = "test-checksum"
+			Expect(k8sClient.Create(ctx, starknetRPC)).Should(Succeed())
+
+			_, err := reconciler.ResolveSnapshot(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			Expect(starknetRPC.Status.Snapshot).NotTo(BeNil())
+			Expect(starknetRPC.Status.Snapshot.FileName).To(Equal("test-snapshot.tar"))
+			Expect(starknetRPC.Status.Snapshot.Checksum).To(Equal("test-checksum"))
+			Expect(resolver.Requests).To(BeEmpty())
+		})
+
+		It("Should resolve the most recent snapshot of the network from the index", func() {
+			Expect(k8sClient.Create(ctx, starknetRPC)).Should(Succeed())
+
+			_, err := reconciler.ResolveSnapshot(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			Expect(starknetRPC.Status.Snapshot).To(Equal(&v1alpha1.ResolvedSnapshot{
+				FileName:    "mainnet_0.16.0_2000.sqlite.zst",
+				Checksum:    "bbb",
+				Size:        200,
+				BlockHeight: 2000,
+				Version:     "0.16.0",
+			}))
+			Expect(resolver.Requests).To(Equal([]string{indexURL}))
+
+			// The restore job uses the resolved snapshot
+			env := getEnvVars(starknetRPC)
+			Expect(env).To(ContainElement(corev1.EnvVar{Name: "PATHFINDER_FILE_NAME", Value: "mainnet_0.16.0_2000.sqlite.zst"}))
+			Expect(env).To(ContainElement(corev1.EnvVar{Name: "PATHFINDER_CHECKSUM", Value: "bbb"}))
+		})
+
+		It("Should honor the version range of the index configuration", func() {
+			starknetRPC.Spec.RestoreArchive.Index.Version = "<0.16.0"
+			Expect(k8sClient.Create(ctx, starknetRPC)).Should(Succeed())
+
+			_, err := reconciler.ResolveSnapshot(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(starknetRPC.Status.Snapshot.FileName).To(Equal("mainnet_0.15.0_1000.sqlite.zst"))
+		})
+
+		It("Should not resolve the snapshot again once pinned", func() {
+			Expect(k8sClient.Create(ctx, starknetRPC)).Should(Succeed())
+
+			_, err := reconciler.ResolveSnapshot(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			resolver.Index.Snapshots = append(resolver.Index.Snapshots,
+				snapshot.Snapshot{Network: network, FileName: "mainnet_0.16.0_5000.sqlite.zst", Checksum: "ddd", BlockHeight: 5000, Version: "0.16.0"})
+			_, err = reconciler.ResolveSnapshot(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(resolver.Requests).To(HaveLen(1))
+			Expect(starknetRPC.Status.Snapshot.FileName).To(Equal("mainnet_0.16.0_2000.sqlite.zst"))
+		})
+
+		It("Should report a missing index", func() {
+			Expect(k8sClient.Create(ctx, starknetRPC)).Should(Succeed())
+			starknetRPC.Spec.RestoreArchive.Index = nil
+
+			_, err := reconciler.ResolveSnapshot(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			restore := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Restore")
+			Expect(restore).NotTo(BeNil())
+			Expect(restore.Reason).To(Equal("SnapshotResolutionFailed"))
+			Expect(restore.Message).To(ContainSubstring("no snapshot index configured"))
+			Expect(resolver.Requests).To(BeEmpty())
+		})
+
+		It("Should report a failure to resolve the snapshot and retry later", func() {
+			Expect(k8sClient.Create(ctx, starknetRPC)).Should(Succeed())
+			resolver.Err = errors.New("index unavailable")
+
+			result, err := reconciler.ResolveSnapshot(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(result.RequeueAfter).To(Equal(snapshotResolveRetryInterval))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			Expect(starknetRPC.Status.Snapshot).To(BeNil())
+			restore := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Restore")
+			Expect(restore).NotTo(BeNil())
+			Expect(restore.Reason).To(Equal("SnapshotResolutionFailed"))
+		})
+	})
+})
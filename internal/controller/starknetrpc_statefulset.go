@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// StatefulSetLabel is set on the pods of the StatefulSet running the node, with the name of the StatefulSet
+const StatefulSetLabel = "pathfinder.runelabs.xyz/statefulset"
+
+// ReconcileNode runs the node with the workload selected in the spec
+func (r *StarknetRPCReconciler) ReconcileNode(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// The data volume can only be mounted by one node at a time
+	stopping, err := r.deleteStaleWorkload(ctx, cluster)
+	if err != nil {
+		return nil, err
+	} else if stopping {
+		logger.V(1).Info("Waiting for the previous workload of the node to be stopped")
+		return &ctrl.Result{RequeueAfter: 5 * time.Second}, reconciler.ErrNextLoop
+	}
+
+	if isStatefulSetWorkload(cluster) {
+		return r.ReconcileStatefulSet(ctx, cluster)
+	}
+	return r.ReconcilePod(ctx, cluster)
+}
+
+// ReconcileStatefulSet runs the node in a single-replica StatefulSet, and tracks the sync status of its pod.
+//
+// The pod is re-created by Kubernetes when it is evicted or its node is drained, and rolled out when its spec changes.
+func (r *StarknetRPCReconciler) ReconcileStatefulSet(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	statefulSet := r.GetWantedStatefulSet(cluster)
+	created, err := reconciler.CreateOrReconcile(ctx, r.Client, &statefulSet,
+		StatefulSetReconciler(statefulSet.DeepCopy()),
+	)
+	if err != nil {
+		return nil, err
+	} else if created {
+		err := condition.SetPhases(ctx, r.Client, cluster,
+			starknetrpc.StarknetRPCAvailableStatusCreating.Apply(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return &ctrl.Result{RequeueAfter: syncCheckInterval}, nil
+	}
+
+	// A node that has been unresponsive for too long gets a new pod, which the StatefulSet re-creates
+	if getAvailableStatus(cluster) == starknetrpc.StarknetRPCAvailableStatusFailed {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      r.GetPodName(cluster).Name,
+				Namespace: cluster.Namespace,
+			},
+		}
+		r.Recorder.Event(cluster, "Warning", "PodRecreated",
+			fmt.Sprintf("Pod %s is unhealthy, re-creating it", pod.Name))
+		if err := r.Delete(ctx, &pod); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		err := condition.SetPhases(ctx, r.Client, cluster,
+			starknetrpc.StarknetRPCAvailableStatusCreating.Apply(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return &ctrl.Result{RequeueAfter: time.Second}, reconciler.ErrNextLoop
+	}
+
+	pod := &corev1.Pod{}
+	err = r.Get(ctx, r.GetPodName(cluster), pod)
+	if err != nil && !apierrs.IsNotFound(err) {
+		return nil, err
+	}
+
+	// Until the pod of the current revision is running, the node is being (re-)created
+	if apierrs.IsNotFound(err) || isStatefulSetRollingOut(&statefulSet, pod) {
+		logger.V(1).Info("Waiting for the pod of the StatefulSet", "statefulSet", statefulSet.Name,
+			"revision", statefulSet.Status.UpdateRevision)
+		current := getAvailableStatus(cluster)
+		if current != starknetrpc.StarknetRPCAvailableStatusCreating && current != starknetrpc.StarknetRPCAvailableStatusPending {
+			err := condition.SetPhases(ctx, r.Client, cluster,
+				starknetrpc.StarknetRPCAvailableStatusCreating.Apply(),
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &ctrl.Result{RequeueAfter: syncCheckInterval}, nil
+	}
+
+	// Track the sync status of the node
+	return r.ReconcileSyncStatus(ctx, cluster, pod)
+}
+
+// StatefulSetReconciler keeps the replicas and the pod template of the StatefulSet up to date.
+// Updating the template rolls out a new pod.
+func StatefulSetReconciler(wanted *appsv1.StatefulSet) reconciler.ObjectReconcilier[*appsv1.StatefulSet] {
+	return reconciler.ObjectReconcilier[*appsv1.StatefulSet]{
+		Name: "StatefulSetReconciler",
+		IsUpToDate: func(statefulSet *appsv1.StatefulSet) bool {
+			current := statefulSet.Spec.Template
+			return statefulSet.Spec.Replicas != nil && *statefulSet.Spec.Replicas == *wanted.Spec.Replicas &&
+				current.Annotations[PodSpecHashAnnotation] == wanted.Spec.Template.Annotations[PodSpecHashAnnotation]
+		},
+		Update: func(statefulSet *appsv1.StatefulSet) error {
+			statefulSet.Spec.Replicas = wanted.Spec.Replicas
+			statefulSet.Spec.Template = *wanted.Spec.Template.DeepCopy()
+			return nil
+		},
+	}
+}
+
+// isStatefulSetRollingOut returns true until the pod of the latest revision of the StatefulSet is created
+func isStatefulSetRollingOut(statefulSet *appsv1.StatefulSet, pod *corev1.Pod) bool {
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation {
+		return true
+	}
+	return statefulSet.Status.UpdateRevision != "" &&
+		pod.Labels[appsv1.ControllerRevisionHashLabelKey] != statefulSet.Status.UpdateRevision
+}
+
+// GetStatefulSetName returns the name of the StatefulSet running the node
+func (r *StarknetRPCReconciler) GetStatefulSetName(cluster *v1alpha1.StarknetRPC) types.NamespacedName {
+	return getStatefulSetName(cluster)
+}
+
+func getStatefulSetName(cluster *v1alpha1.StarknetRPC) types.NamespacedName {
+	return types.NamespacedName{
+		Name:      fmt.Sprintf("%s-rpc%s", cluster.Name, getColorSuffix(getActiveColor(cluster))),
+		Namespace: cluster.Namespace,
+	}
+}
+
+func isStatefulSetWorkload(cluster *v1alpha1.StarknetRPC) bool {
+	return cluster.Spec.Workload == v1alpha1.WorkloadTypeStatefulSet
+}
+
+// GetWantedStatefulSet returns a single-replica StatefulSet running the pod rendered by GetWantedPod,
+// on the existing data volume
+func (r *StarknetRPCReconciler) GetWantedStatefulSet(cluster *v1alpha1.StarknetRPC) appsv1.StatefulSet {
+	pod := r.GetWantedPod(cluster)
+	nameInfo := r.GetStatefulSetName(cluster)
+
+	// The selector cannot be changed: it does not depend on the labels of the pod
+	selector := map[string]string{
+		"rpc.runelabs.xyz/name": cluster.Name,
+		StatefulSetLabel:        nameInfo.Name,
+	}
+	templateLabels := maps.Clone(pod.Labels)
+	maps.Copy(templateLabels, selector)
+
+	return appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            nameInfo.Name,
+			Namespace:       nameInfo.Namespace,
+			Labels:          pod.Labels,
+			OwnerReferences: pod.OwnerReferences,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &[]int32{1}[0],
+			ServiceName: r.GetServiceName(cluster).Name,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: selector,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      templateLabels,
+					Annotations: pod.Annotations,
+				},
+				Spec: pod.Spec,
+			},
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: appsv1.RollingUpdateStatefulSetStrategyType,
+			},
+		},
+	}
+}
+
+// deleteNode stops the node. The StatefulSet is deleted along with its pod, as it would re-create it otherwise.
+func (r *StarknetRPCReconciler) deleteNode(ctx context.Context, cluster *v1alpha1.StarknetRPC) error {
+	if !isStatefulSetWorkload(cluster) {
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      r.GetPodName(cluster).Name,
+				Namespace: cluster.Namespace,
+			},
+		}
+		return client.IgnoreNotFound(r.Delete(ctx, &pod))
+	}
+
+	statefulSet := appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.GetStatefulSetName(cluster).Name,
+			Namespace: cluster.Namespace,
+		},
+	}
+	deletePropagation := metav1.DeletePropagationBackground
+	return client.IgnoreNotFound(r.Delete(ctx, &statefulSet, &client.DeleteOptions{
+		PropagationPolicy: &deletePropagation,
+	}))
+}
+
+// deleteStaleWorkload stops the node running with the workload that is not selected anymore,
+// and returns true until its pod is gone
+func (r *StarknetRPCReconciler) deleteStaleWorkload(ctx context.Context, cluster *v1alpha1.StarknetRPC) (bool, error) {
+	stale := cluster.DeepCopy()
+	if isStatefulSetWorkload(cluster) {
+		stale.Spec.Workload = v1alpha1.WorkloadTypePod
+	} else {
+		stale.Spec.Workload = v1alpha1.WorkloadTypeStatefulSet
+
+		err := r.Get(ctx, r.GetStatefulSetName(stale), &appsv1.StatefulSet{})
+		if err == nil {
+			r.Recorder.Event(cluster, "Normal", "WorkloadChanged", "Replacing the StatefulSet of the node by a pod")
+			return true, r.deleteNode(ctx, stale)
+		} else if !apierrs.IsNotFound(err) {
+			return false, err
+		}
+	}
+
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, r.GetPodName(stale), pod)
+	if apierrs.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if pod.DeletionTimestamp == nil {
+		if isStatefulSetWorkload(cluster) {
+			r.Recorder.Event(cluster, "Normal", "WorkloadChanged", "Replacing the pod of the node by a StatefulSet")
+		}
+		if err := r.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
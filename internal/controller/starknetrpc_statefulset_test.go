@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPC StatefulSet", func() {
+	Context("When the node runs in a StatefulSet", func() {
+		const (
+			resourceName = "test-starknet-rpc-statefulset"
+			namespace    = "default"
+			network      = "mainnet"
+		)
+
+		var (
+			ctx         context.Context
+			starknetRPC *v1alpha1.StarknetRPC
+			reconciler  *StarknetRPCReconciler
+		)
+
+		availableReason := func() string {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			available := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Available")
+			Expect(available).NotTo(BeNil())
+			return available.Reason
+		}
+
+		getStatefulSet := func() *appsv1.StatefulSet {
+			statefulSet := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, reconciler.GetStatefulSetName(starknetRPC), statefulSet)).To(Succeed())
+			return statefulSet
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			starknetRPC.Spec.Workload = v1alpha1.WorkloadTypeStatefulSet
+			createTestStarknetRPC(ctx, starknetRPC)
+
+			reconciler = &StarknetRPCReconciler{
+				Client:       k8sClient,
+				Scheme:       k8sClient.Scheme(),
+				Recorder:     record.NewFakeRecorder(10),
+				HealthClient: proxy.NewFakeNodeHealthClient(100, 1000),
+			}
+
+			starknetrpc.StarknetRPCAvailableStatusPending.Apply()(starknetRPC)
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			_ = k8sClient.Delete(ctx, &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: reconciler.GetStatefulSetName(starknetRPC).Name, Namespace: namespace},
+			})
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should run a single replica mounting the data volume", func() {
+			_, err := reconciler.ReconcileNode(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			statefulSet := getStatefulSet()
+			Expect(*statefulSet.Spec.Replicas).To(Equal(int32(1)))
+			Expect(statefulSet.Spec.VolumeClaimTemplates).To(BeEmpty())
+			Expect(statefulSet.Spec.Template.Spec.Volumes).To(ContainElement(HaveField("VolumeSource.PersistentVolumeClaim.ClaimName",
+				reconciler.GetStoragePvcName(starknetRPC).Name)))
+			Expect(statefulSet.OwnerReferences).To(HaveLen(1))
+			Expect(statefulSet.OwnerReferences[0].Name).To(Equal(resourceName))
+			Expect(reconciler.GetPodName(starknetRPC).Name).To(Equal(statefulSet.Name + "-0"))
+
+			Expect(availableReason()).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusCreating)))
+		})
+
+		It("Should roll out a new pod when the spec changes", func() {
+			_, err := reconciler.ReconcileNode(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			previous := getStatefulSet().Spec.Template.Annotations[PodSpecHashAnnotation]
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			starknetRPC.Spec.Resources = corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("16Gi")},
+			}
+			Expect(k8sClient.Update(ctx, starknetRPC)).To(Succeed())
+
+			_, err = reconciler.ReconcileNode(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			statefulSet := getStatefulSet()
+			Expect(statefulSet.Spec.Template.Annotations[PodSpecHashAnnotation]).NotTo(Equal(previous))
+			Expect(statefulSet.Spec.Template.Spec.Containers[0].Resources.Limits.Memory().String()).To(Equal("16Gi"))
+		})
+
+		It("Should stop the pod of the node before switching to the StatefulSet", func() {
+			legacy := starknetRPC.DeepCopy()
+			legacy.Spec.Workload = v1alpha1.WorkloadTypePod
+			pod := reconciler.GetWantedPod(legacy)
+			Expect(k8sClient.Create(ctx, &pod)).To(Succeed())
+
+			_, err := reconciler.ReconcileNode(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(&pod), &corev1.Pod{})
+			Expect(apierrs.IsNotFound(err)).To(BeTrue())
+			err = k8sClient.Get(ctx, reconciler.GetStatefulSetName(starknetRPC), &appsv1.StatefulSet{})
+			Expect(apierrs.IsNotFound(err)).To(BeTrue())
+
+			By("Creating the StatefulSet once the pod is gone")
+			_, err = reconciler.ReconcileNode(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			getStatefulSet()
+		})
+
+		It("Should delete the StatefulSet to stop the node", func() {
+			_, err := reconciler.ReconcileNode(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(reconciler.deleteNode(ctx, starknetRPC)).To(Succeed())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, reconciler.GetStatefulSetName(starknetRPC), &appsv1.StatefulSet{})
+				return apierrs.IsNotFound(err)
+			}).Should(BeTrue())
+		})
+	})
+})
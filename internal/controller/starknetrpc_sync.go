@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// syncCheckInterval is the interval between two checks of the sync status of a running node
+	syncCheckInterval = 30 * time.Second
+	// unknownStatusTimeout is how long a node can stay unresponsive before being considered as failed
+	unknownStatusTimeout = 5 * time.Minute
+	// defaultMaxBlockLag is the default number of blocks a node can be behind and still receive traffic
+	defaultMaxBlockLag int64 = 10
+)
+
+// SyncedReadinessGate is the readiness gate of the RPC pod, only true once the node caught up with the chain
+const SyncedReadinessGate corev1.PodConditionType = "pathfinder.runelabs.xyz/synced"
+
+// ReconcileSyncStatus queries the sync status of the node through JSON-RPC, and moves the
+// Available condition through CatchingUp -> Ready -> Unknown -> Failed accordingly.
+func (r *StarknetRPCReconciler) ReconcileSyncStatus(ctx context.Context, cluster *v1alpha1.StarknetRPC, pod *corev1.Pod) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	current := getAvailableStatus(cluster)
+
+	if pod.Status.Phase != corev1.PodRunning {
+		if current == starknetrpc.StarknetRPCAvailableStatusPending || current == starknetrpc.StarknetRPCAvailableStatusCreating {
+			// The pod is still starting, nothing to query yet
+			return &ctrl.Result{RequeueAfter: syncCheckInterval}, nil
+		}
+		return r.markNodeUnresponsive(ctx, cluster, pod, fmt.Errorf("pod is in phase %s", pod.Status.Phase))
+	}
+
+	healthClient := r.getHealthClient()
+
+	ready, err := healthClient.IsReady(ctx, pod)
+	if err == nil && !ready {
+		err = fmt.Errorf("node is not ready")
+	}
+	if err != nil {
+		if current == starknetrpc.StarknetRPCAvailableStatusCreating {
+			// Pathfinder does not answer requests until the database is opened
+			logger.V(1).Info("Node is not ready yet", "error", err)
+			return &ctrl.Result{RequeueAfter: syncCheckInterval}, nil
+		}
+		return r.markNodeUnresponsive(ctx, cluster, pod, err)
+	}
+
+	syncStatus, err := proxy.Syncing(ctx, healthClient, pod)
+	if err != nil {
+		logger.V(1).Info("Failed to fetch the sync status of the node", "error", err)
+		return r.markNodeUnresponsive(ctx, cluster, pod, err)
+	}
+
+	next := starknetrpc.StarknetRPCAvailableStatusReady
+	if syncStatus.Syncing {
+		next = starknetrpc.StarknetRPCAvailableStatusCatchingUp
+	}
+
+	if next != current {
+		logger.Info("Node sync status changed", "from", current, "to", next,
+			"currentBlock", syncStatus.CurrentBlock, "highestBlock", syncStatus.HighestBlock)
+		r.Recorder.Event(cluster, "Normal", string(next),
+			fmt.Sprintf("Node is at block %d out of %d", syncStatus.CurrentBlock, syncStatus.HighestBlock))
+	}
+
+	err = condition.SetPhases(ctx, r.Client, cluster,
+		next.Apply(),
+		setSyncStatus(syncStatus),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only let the Service route traffic to the node once it caught up
+	caughtUp, err := r.isCaughtUp(ctx, cluster, pod, syncStatus)
+	if err != nil {
+		logger.V(1).Info("Failed to check if the node is synced", "error", err)
+	}
+	message := fmt.Sprintf("Node is %d blocks behind the chain head", syncStatus.HighestBlock-syncStatus.CurrentBlock)
+	if err := r.setSyncedReadinessGate(ctx, pod, caughtUp, message); err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{RequeueAfter: syncCheckInterval}, nil
+}
+
+// isCaughtUp returns true if the node is close enough to the chain head to receive traffic
+func (r *StarknetRPCReconciler) isCaughtUp(ctx context.Context, cluster *v1alpha1.StarknetRPC, pod *corev1.Pod, syncStatus *proxy.SyncStatus) (bool, error) {
+	maxBlockLag := getMaxBlockLag(cluster)
+	if maxBlockLag == 0 {
+		return r.getHealthClient().IsSynced(ctx, pod)
+	}
+	return syncStatus.HighestBlock-syncStatus.CurrentBlock <= maxBlockLag, nil
+}
+
+// setSyncedReadinessGate sets the readiness gate condition of the pod, if it changed
+func (r *StarknetRPCReconciler) setSyncedReadinessGate(ctx context.Context, pod *corev1.Pod, synced bool, message string) error {
+	status := corev1.ConditionFalse
+	reason := "NodeNotSynced"
+	if synced {
+		status = corev1.ConditionTrue
+		reason = "NodeSynced"
+	}
+
+	index := -1
+	for i, cond := range pod.Status.Conditions {
+		if cond.Type == SyncedReadinessGate {
+			if cond.Status == status {
+				return nil
+			}
+			index = i
+		}
+	}
+
+	original := pod.DeepCopy()
+	gate := corev1.PodCondition{
+		Type:               SyncedReadinessGate,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	}
+	if index >= 0 {
+		pod.Status.Conditions[index] = gate
+	} else {
+		pod.Status.Conditions = append(pod.Status.Conditions, gate)
+	}
+
+	log.FromContext(ctx).Info("Updating the readiness gate of the pod", "pod", pod.Name, "synced", synced)
+	return r.Status().Patch(ctx, pod, client.StrategicMergeFrom(original))
+}
+
+func getMaxBlockLag(cluster *v1alpha1.StarknetRPC) int64 {
+	if cluster.Spec.Readiness == nil || cluster.Spec.Readiness.MaxBlockLag == nil {
+		return defaultMaxBlockLag
+	}
+	return *cluster.Spec.Readiness.MaxBlockLag
+}
+
+// markNodeUnresponsive moves a responsive node to Unknown, and an Unknown node to Failed
+// once it has been unresponsive for longer than unknownStatusTimeout.
+func (r *StarknetRPCReconciler) markNodeUnresponsive(ctx context.Context, cluster *v1alpha1.StarknetRPC, pod *corev1.Pod, cause error) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// Stop routing traffic to the node right away
+	if pod.Status.Phase == corev1.PodRunning {
+		if err := r.setSyncedReadinessGate(ctx, pod, false, fmt.Sprintf("Node is not responding: %s", cause)); err != nil {
+			return nil, err
+		}
+	}
+
+	var next starknetrpc.StarknetRPCAvailableStatus
+	switch getAvailableStatus(cluster) {
+	case starknetrpc.StarknetRPCAvailableStatusCatchingUp, starknetrpc.StarknetRPCAvailableStatusReady:
+		next = starknetrpc.StarknetRPCAvailableStatusUnknown
+	case starknetrpc.StarknetRPCAvailableStatusUnknown:
+		available := meta.FindStatusCondition(cluster.Status.Conditions, string(starknetrpc.StarknetRPCAvailableCondition))
+		if time.Since(available.LastTransitionTime.Time) < unknownStatusTimeout {
+			return &ctrl.Result{RequeueAfter: syncCheckInterval}, nil
+		}
+		next = starknetrpc.StarknetRPCAvailableStatusFailed
+	default:
+		return &ctrl.Result{RequeueAfter: syncCheckInterval}, nil
+	}
+
+	logger.Info("Node is not responding", "status", next, "error", cause)
+	r.Recorder.Event(cluster, "Warning", string(next),
+		fmt.Sprintf("Node is not responding: %s", cause))
+
+	if err := condition.SetPhases(ctx, r.Client, cluster, next.Apply()); err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{RequeueAfter: syncCheckInterval}, nil
+}
+
+func setSyncStatus(syncStatus *proxy.SyncStatus) condition.StateTransition {
+	return func(rpc *v1alpha1.StarknetRPC) {
+		rpc.Status.Sync = &v1alpha1.SyncStatus{
+			CurrentBlock:  syncStatus.CurrentBlock,
+			HighestBlock:  syncStatus.HighestBlock,
+			LastCheckTime: metav1.Now(),
+		}
+	}
+}
+
+func getAvailableStatus(cluster *v1alpha1.StarknetRPC) starknetrpc.StarknetRPCAvailableStatus {
+	available := meta.FindStatusCondition(cluster.Status.Conditions, string(starknetrpc.StarknetRPCAvailableCondition))
+	if available == nil {
+		return starknetrpc.StarknetRPCAvailableStatusPending
+	}
+	return starknetrpc.StarknetRPCAvailableStatus(available.Reason)
+}
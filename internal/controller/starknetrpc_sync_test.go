@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPC sync status", func() {
+	Context("When tracking the sync status of a running node", func() {
+		const (
+			resourceName = "test-starknet-rpc-sync"
+			namespace    = "default"
+			network      = "mainnet"
+		)
+
+		var (
+			ctx          context.Context
+			starknetRPC  *v1alpha1.StarknetRPC
+			pod          *corev1.Pod
+			healthClient *proxy.FakeNodeHealthClient
+			reconciler   *StarknetRPCReconciler
+		)
+
+		availableReason := func() string {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			available := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Available")
+			Expect(available).NotTo(BeNil())
+			return available.Reason
+		}
+
+		gateStatus := func() corev1.ConditionStatus {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod)).To(Succeed())
+			for _, cond := range pod.Status.Conditions {
+				if cond.Type == SyncedReadinessGate {
+					return cond.Status
+				}
+			}
+			return corev1.ConditionUnknown
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			createTestStarknetRPC(ctx, starknetRPC)
+
+			healthClient = proxy.NewFakeNodeHealthClient(100, 1000)
+			reconciler = &StarknetRPCReconciler{
+				Client:       k8sClient,
+				Scheme:       k8sClient.Scheme(),
+				Recorder:     record.NewFakeRecorder(10),
+				HealthClient: healthClient,
+			}
+
+			// Create the node pod, and mark it as running
+			wanted := reconciler.GetWantedPod(starknetRPC)
+			pod = &wanted
+			Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+			pod.Status.Phase = corev1.PodRunning
+			Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+
+			starknetRPC.Status.Conditions = []metav1.Condition{}
+			starknetrpc.StarknetRPCAvailableStatusCreating.Apply()(starknetRPC)
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			_ = k8sClient.Delete(ctx, pod)
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should mark a node behind the chain head as catching up", func() {
+			result, err := reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(syncCheckInterval))
+
+			Expect(availableReason()).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusCatchingUp)))
+			Expect(starknetRPC.Status.Sync).NotTo(BeNil())
+			Expect(starknetRPC.Status.Sync.CurrentBlock).To(Equal(int64(100)))
+			Expect(starknetRPC.Status.Sync.HighestBlock).To(Equal(int64(1000)))
+		})
+
+		It("Should mark a synced node as ready", func() {
+			healthClient.SetSyncStatus(1000, 1000)
+
+			_, err := reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(availableReason()).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusReady)))
+			Expect(meta.IsStatusConditionTrue(starknetRPC.Status.Conditions, "Available")).To(BeTrue())
+			Expect(starknetRPC.Status.Sync.CurrentBlock).To(Equal(int64(1000)))
+			Expect(healthClient.Calls).To(ContainElement("starknet_blockNumber"))
+		})
+
+		It("Should keep a starting node in Creating while it does not answer", func() {
+			healthClient.Err = errors.New("connection refused")
+
+			_, err := reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(availableReason()).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusCreating)))
+		})
+
+		It("Should move an unresponsive node to Unknown, then to Failed", func() {
+			healthClient.SetSyncStatus(1000, 1000)
+			_, err := reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+
+			healthClient.Err = errors.New("connection refused")
+			_, err = reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(availableReason()).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusUnknown)))
+
+			// Still within the grace period
+			_, err = reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(availableReason()).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusUnknown)))
+
+			// Simulate that the node has been unresponsive for too long
+			for i := range starknetRPC.Status.Conditions {
+				if starknetRPC.Status.Conditions[i].Type == "Available" {
+					starknetRPC.Status.Conditions[i].LastTransitionTime = metav1.NewTime(time.Now().Add(-2 * unknownStatusTimeout))
+				}
+			}
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).To(Succeed())
+
+			_, err = reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(availableReason()).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusFailed)))
+		})
+
+		It("Should declare the readiness gate of the pod", func() {
+			Expect(pod.Spec.ReadinessGates).To(ContainElement(corev1.PodReadinessGate{ConditionType: SyncedReadinessGate}))
+		})
+
+		It("Should only open the readiness gate once the node is within the allowed lag", func() {
+			_, err := reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gateStatus()).To(Equal(corev1.ConditionFalse))
+
+			// Still catching up, but within the default lag
+			healthClient.SetSyncStatus(995, 1000)
+			_, err = reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(availableReason()).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusCatchingUp)))
+			Expect(gateStatus()).To(Equal(corev1.ConditionTrue))
+		})
+
+		It("Should rely on the node sync status when no lag is allowed", func() {
+			starknetRPC.Spec.Readiness = &v1alpha1.ReadinessConfig{MaxBlockLag: &[]int64{0}[0]}
+
+			healthClient.SetSyncStatus(999, 1000)
+			_, err := reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gateStatus()).To(Equal(corev1.ConditionFalse))
+
+			healthClient.SetSyncStatus(1000, 1000)
+			_, err = reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gateStatus()).To(Equal(corev1.ConditionTrue))
+		})
+
+		It("Should close the readiness gate of an unresponsive node", func() {
+			healthClient.SetSyncStatus(1000, 1000)
+			_, err := reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gateStatus()).To(Equal(corev1.ConditionTrue))
+
+			healthClient.Err = errors.New("connection refused")
+			_, err = reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gateStatus()).To(Equal(corev1.ConditionFalse))
+		})
+
+		It("Should recover from Unknown once the node answers again", func() {
+			healthClient.SetSyncStatus(1000, 1000)
+			_, err := reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+
+			healthClient.Err = fmt.Errorf("timeout")
+			_, err = reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(availableReason()).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusUnknown)))
+
+			healthClient.Err = nil
+			_, err = reconciler.ReconcileSyncStatus(ctx, starknetRPC, pod)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(availableReason()).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusReady)))
+		})
+	})
+})
@@ -0,0 +1,484 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// ColorLabel is set on the pods of the nodes upgraded with the BlueGreen strategy, with the color of the pod
+	ColorLabel = "pathfinder.runelabs.xyz/color"
+	// UpgradedFromAnnotation is set on the data volume cloned for an upgrade, with the volume it was cloned from
+	UpgradedFromAnnotation = "pathfinder.runelabs.xyz/upgraded-from"
+
+	// defaultUpgradeProgressDeadline is how long the new version has to catch up, if not configured
+	defaultUpgradeProgressDeadline = 2 * time.Hour
+	// upgradePollInterval is the interval between two checks of an upgrade in progress
+	upgradePollInterval = 10 * time.Second
+)
+
+// ReconcileUpgrade rolls out a new image with the BlueGreen strategy.
+//
+// The data volume is cloned, and the new version started on the clone with the other color. The Service is only
+// switched to the new version once it caught up with the chain, and the previous pod and volume are then retired.
+// If the new version does not catch up within the progress deadline, it is deleted and the node keeps running
+// the previous version. An upgrade superseded by another image before its promotion is restarted towards it.
+func (r *StarknetRPCReconciler) ReconcileUpgrade(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if upgrade := cluster.Status.Upgrade; upgrade != nil {
+		inProgress := upgrade.Phase == v1alpha1.UpgradePhaseCloning || upgrade.Phase == v1alpha1.UpgradePhaseSyncing
+		if inProgress && upgrade.ToImage != getSpecImage(cluster) {
+			return r.restartUpgrade(ctx, cluster)
+		}
+
+		switch upgrade.Phase {
+		case v1alpha1.UpgradePhaseCloning:
+			return r.reconcileUpgradeClone(ctx, cluster)
+		case v1alpha1.UpgradePhaseSyncing:
+			return r.reconcileUpgradeSync(ctx, cluster)
+		case v1alpha1.UpgradePhasePromoting:
+			return r.reconcileUpgradePromotion(ctx, cluster)
+		}
+	}
+
+	if !isBlueGreenUpgrade(cluster) {
+		return &ctrl.Result{}, nil
+	}
+
+	// The upgrade to the image is done, and a rolled back upgrade is only retried once the image changes again
+	wanted := getSpecImage(cluster)
+	if upgrade := cluster.Status.Upgrade; upgrade != nil && upgrade.ToImage == wanted {
+		return &ctrl.Result{}, nil
+	}
+
+	// The database is backed up before the upgrade starts
+	if isUpgradeBackupPending(cluster) {
+		return &ctrl.Result{}, nil
+	}
+
+	// A node that is not running has no traffic to keep serving, it is started with the new image
+	running, err := r.getRunningImage(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	// unless it was only stopped by the backup taken before the upgrade
+	if backup := cluster.Status.UpgradeBackup; running == "" && backup != nil && backup.ToImage == wanted {
+		running = backup.FromImage
+	}
+	if running == "" || running == wanted {
+		return &ctrl.Result{}, nil
+	}
+
+	color := getOtherColor(getActiveColor(cluster))
+	message := fmt.Sprintf("Upgrading from %s to %s on a clone of the data volume", running, wanted)
+	logger.Info("Starting a blue/green upgrade", "from", running, "to", wanted, "color", color)
+	r.Recorder.Event(cluster, "Normal", "UpgradeStarted", message)
+
+	now := metav1.Now()
+	err = condition.SetPhases(ctx, r.Client, cluster, func(rpc *v1alpha1.StarknetRPC) {
+		rpc.Status.Upgrade = &v1alpha1.UpgradeStatus{
+			Phase:     v1alpha1.UpgradePhaseCloning,
+			FromImage: running,
+			ToImage:   wanted,
+			Color:     color,
+			StartTime: &now,
+			Message:   message,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+}
+
+// reconcileUpgradeClone clones the data volume of the node for the new version
+func (r *StarknetRPCReconciler) reconcileUpgradeClone(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if isUpgradePastDeadline(cluster) {
+		return r.rollbackUpgrade(ctx, cluster, "The data volume was not cloned in time, the storage driver may not support volume cloning")
+	}
+
+	var active corev1.PersistentVolumeClaim
+	if err := r.Get(ctx, r.GetStoragePvcName(cluster), &active); err != nil {
+		return nil, err
+	}
+
+	candidate := getUpgradeCandidate(cluster)
+	pvc := r.GetWantedUpgradePvc(candidate, &active)
+	err := r.Create(ctx, &pvc)
+	if err == nil {
+		logger.Info("Cloning the data volume for the upgrade", "pvc", pvc.Name, "source", active.Name)
+		return &ctrl.Result{RequeueAfter: upgradePollInterval}, nil
+	} else if !apierrs.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(&pvc), &pvc); err != nil {
+		return nil, err
+	}
+	// The volume of a previous upgrade is still being deleted
+	if pvc.DeletionTimestamp != nil || !isReady(&pvc) {
+		logger.V(1).Info("Waiting for the data volume to be cloned", "pvc", pvc.Name)
+		return &ctrl.Result{RequeueAfter: upgradePollInterval}, nil
+	}
+
+	err = condition.SetPhases(ctx, r.Client, cluster,
+		setUpgradePhase(v1alpha1.UpgradePhaseSyncing, fmt.Sprintf("Waiting for %s to catch up with the chain", cluster.Status.Upgrade.ToImage)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+}
+
+// reconcileUpgradeSync runs the new version on the cloned volume, and promotes it once it caught up with the chain
+func (r *StarknetRPCReconciler) reconcileUpgradeSync(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	upgrade := cluster.Status.Upgrade
+
+	if isUpgradePastDeadline(cluster) {
+		return r.rollbackUpgrade(ctx, cluster,
+			fmt.Sprintf("%s did not catch up with the chain within %s", upgrade.ToImage, getUpgradeProgressDeadline(cluster)))
+	}
+
+	candidate := getUpgradeCandidate(cluster)
+	if err := r.createUpgradeCandidate(ctx, candidate); err != nil {
+		return nil, err
+	}
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, r.GetPodName(candidate), pod); err != nil {
+		if apierrs.IsNotFound(err) {
+			return &ctrl.Result{RequeueAfter: upgradePollInterval}, nil
+		}
+		return nil, err
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		logger.V(1).Info("Waiting for the new version to start", "pod", pod.Name, "phase", pod.Status.Phase)
+		return &ctrl.Result{RequeueAfter: upgradePollInterval}, nil
+	}
+
+	// Pathfinder does not answer until the database is migrated
+	healthClient := r.getHealthClient()
+	if ready, err := healthClient.IsReady(ctx, pod); err != nil || !ready {
+		logger.V(1).Info("Waiting for the new version to be ready", "pod", pod.Name, "error", err)
+		return &ctrl.Result{RequeueAfter: upgradePollInterval}, nil
+	}
+	syncStatus, err := proxy.Syncing(ctx, healthClient, pod)
+	if err != nil {
+		logger.V(1).Info("Failed to fetch the sync status of the new version", "pod", pod.Name, "error", err)
+		return &ctrl.Result{RequeueAfter: upgradePollInterval}, nil
+	}
+	caughtUp, err := r.isCaughtUp(ctx, candidate, pod, syncStatus)
+	if err != nil || !caughtUp {
+		logger.V(1).Info("Waiting for the new version to catch up", "pod", pod.Name,
+			"currentBlock", syncStatus.CurrentBlock, "highestBlock", syncStatus.HighestBlock)
+		return &ctrl.Result{RequeueAfter: upgradePollInterval}, nil
+	}
+
+	// The new version must be ready before the Service selects it
+	message := fmt.Sprintf("Node is %d blocks behind the chain head", syncStatus.HighestBlock-syncStatus.CurrentBlock)
+	if err := r.setSyncedReadinessGate(ctx, pod, true, message); err != nil {
+		return nil, err
+	}
+
+	var pvc corev1.PersistentVolumeClaim
+	if err := r.Get(ctx, r.GetStoragePvcName(candidate), &pvc); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Promoting the new version", "image", upgrade.ToImage, "color", upgrade.Color)
+	r.Recorder.Event(cluster, "Normal", "UpgradePromoted",
+		fmt.Sprintf("%s caught up with the chain, sending the traffic to it", upgrade.ToImage))
+	err = condition.SetPhases(ctx, r.Client, cluster,
+		setUpgradePhase(v1alpha1.UpgradePhasePromoting, fmt.Sprintf("Retiring %s", upgrade.FromImage)),
+		func(rpc *v1alpha1.StarknetRPC) {
+			rpc.Status.ActiveColor = upgrade.Color
+			// The cloned volume now holds the database of the node
+			if rpc.Status.Restore == nil {
+				rpc.Status.Restore = &v1alpha1.RestoreStatus{}
+			}
+			rpc.Status.Restore.VolumeUID = pvc.UID
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+}
+
+// reconcileUpgradePromotion retires the previous version, once the Service sends the traffic to the new one
+func (r *StarknetRPCReconciler) reconcileUpgradePromotion(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	upgrade := cluster.Status.Upgrade
+
+	service := &corev1.Service{}
+	if err := r.Get(ctx, r.GetServiceName(cluster), service); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	if !equality.Semantic.DeepEqual(service.Spec.Selector, getServiceSelector(cluster)) {
+		logger.V(1).Info("Waiting for the Service to select the new version", "service", service.Name)
+		return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+	}
+
+	previous := cluster.DeepCopy()
+	previous.Status.ActiveColor = getOtherColor(upgrade.Color)
+	if err := r.deleteNode(ctx, previous); err != nil {
+		return nil, err
+	}
+	pvc := corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, r.GetStoragePvcName(previous), &pvc)
+	if err == nil {
+		if pvc.DeletionTimestamp == nil {
+			if err := r.Delete(ctx, &pvc); client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+		}
+		logger.V(1).Info("Waiting for the previous data volume to be deleted", "pvc", pvc.Name)
+		return &ctrl.Result{RequeueAfter: upgradePollInterval}, errs.ErrNextLoop
+	} else if !apierrs.IsNotFound(err) {
+		return nil, err
+	}
+
+	logger.Info("Upgrade succeeded", "image", upgrade.ToImage)
+	r.Recorder.Event(cluster, "Normal", "UpgradeSucceeded",
+		fmt.Sprintf("Upgraded from %s to %s", upgrade.FromImage, upgrade.ToImage))
+	err = condition.SetPhases(ctx, r.Client, cluster,
+		setUpgradePhase(v1alpha1.UpgradePhaseSucceeded, fmt.Sprintf("Upgraded from %s to %s", upgrade.FromImage, upgrade.ToImage)),
+		setUpgradeCompletionTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{}, nil
+}
+
+// rollbackUpgrade deletes the new version, and keeps the node running the previous one
+func (r *StarknetRPCReconciler) rollbackUpgrade(ctx context.Context, cluster *v1alpha1.StarknetRPC, reason string) (*ctrl.Result, error) {
+	upgrade := cluster.Status.Upgrade
+
+	if _, err := r.deleteColor(ctx, getUpgradeCandidate(cluster)); err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Upgrade to %s rolled back, the node keeps running %s: %s", upgrade.ToImage, upgrade.FromImage, reason)
+	log.FromContext(ctx).Info("Upgrade rolled back", "image", upgrade.ToImage, "reason", reason)
+	r.Recorder.Event(cluster, "Warning", "UpgradeRolledBack", message)
+	err := condition.SetPhases(ctx, r.Client, cluster,
+		setUpgradePhase(v1alpha1.UpgradePhaseRolledBack, message),
+		setUpgradeCompletionTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{}, nil
+}
+
+// restartUpgrade deletes the new version of an upgrade whose image changed before it was promoted, and
+// upgrades the node to the new image of the spec instead. The node keeps running the previous image meanwhile,
+// see getPodImage.
+func (r *StarknetRPCReconciler) restartUpgrade(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	upgrade := cluster.Status.Upgrade
+	wanted := getSpecImage(cluster)
+
+	// The node already runs the image of the spec
+	if upgrade.FromImage == wanted {
+		return r.rollbackUpgrade(ctx, cluster, fmt.Sprintf("the image was changed back to %s", wanted))
+	}
+
+	deleted, err := r.deleteColor(ctx, getUpgradeCandidate(cluster))
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		logger.V(1).Info("Waiting for the superseded new version to be deleted", "image", upgrade.ToImage)
+		return &ctrl.Result{RequeueAfter: upgradePollInterval}, errs.ErrNextLoop
+	}
+
+	// The database is backed up before the upgrade to the new image starts
+	if isUpgradeBackupPending(cluster) {
+		return &ctrl.Result{}, nil
+	}
+
+	message := fmt.Sprintf("Upgrading from %s to %s on a clone of the data volume, instead of %s", upgrade.FromImage, wanted, upgrade.ToImage)
+	logger.Info("Restarting the blue/green upgrade", "from", upgrade.FromImage, "to", wanted, "superseded", upgrade.ToImage)
+	r.Recorder.Event(cluster, "Normal", "UpgradeRestarted", message)
+
+	now := metav1.Now()
+	err = condition.SetPhases(ctx, r.Client, cluster, func(rpc *v1alpha1.StarknetRPC) {
+		rpc.Status.Upgrade.Phase = v1alpha1.UpgradePhaseCloning
+		rpc.Status.Upgrade.ToImage = wanted
+		rpc.Status.Upgrade.StartTime = &now
+		rpc.Status.Upgrade.Message = message
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+}
+
+// deleteColor deletes the pod and the data volume of a color of the node, and returns whether they are gone
+func (r *StarknetRPCReconciler) deleteColor(ctx context.Context, node *v1alpha1.StarknetRPC) (bool, error) {
+	if err := r.deleteNode(ctx, node); err != nil {
+		return false, err
+	}
+	pvc := corev1.PersistentVolumeClaim{}
+	if err := r.Get(ctx, r.GetStoragePvcName(node), &pvc); err != nil {
+		return apierrs.IsNotFound(err), client.IgnoreNotFound(err)
+	}
+	if pvc.DeletionTimestamp == nil {
+		if err := r.Delete(ctx, &pvc); client.IgnoreNotFound(err) != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// createUpgradeCandidate starts the new version, with the workload of the node
+func (r *StarknetRPCReconciler) createUpgradeCandidate(ctx context.Context, candidate *v1alpha1.StarknetRPC) error {
+	var object client.Object
+	if isStatefulSetWorkload(candidate) {
+		statefulSet := r.GetWantedStatefulSet(candidate)
+		object = &statefulSet
+	} else {
+		pod := r.GetWantedPod(candidate)
+		object = &pod
+	}
+
+	err := r.Create(ctx, object)
+	if err == nil {
+		log.FromContext(ctx).Info("Started the new version", "name", object.GetName())
+		return nil
+	}
+	return client.IgnoreAlreadyExists(err)
+}
+
+// getRunningImage returns the image run by the node, or an empty string if it is not running
+func (r *StarknetRPCReconciler) getRunningImage(ctx context.Context, cluster *v1alpha1.StarknetRPC) (string, error) {
+	var spec *corev1.PodSpec
+	if isStatefulSetWorkload(cluster) {
+		statefulSet := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, r.GetStatefulSetName(cluster), statefulSet); err != nil {
+			return "", client.IgnoreNotFound(err)
+		}
+		spec = &statefulSet.Spec.Template.Spec
+	} else {
+		pod := &corev1.Pod{}
+		if err := r.Get(ctx, r.GetPodName(cluster), pod); err != nil {
+			return "", client.IgnoreNotFound(err)
+		}
+		spec = &pod.Spec
+	}
+
+	if len(spec.Containers) == 0 {
+		return "", nil
+	}
+	return spec.Containers[0].Image, nil
+}
+
+// GetWantedUpgradePvc returns the data volume of the new version, cloned from the data volume of the node
+func (r *StarknetRPCReconciler) GetWantedUpgradePvc(candidate *v1alpha1.StarknetRPC, source *corev1.PersistentVolumeClaim) corev1.PersistentVolumeClaim {
+	pvc := r.GetWantedPvc(candidate)
+	// A clone must be at least as large as its source, which may have been expanded
+	pvc.Spec.StorageClassName = source.Spec.StorageClassName
+	pvc.Spec.Resources.Requests = source.Spec.Resources.Requests.DeepCopy()
+	pvc.Spec.DataSource = &corev1.TypedLocalObjectReference{
+		Kind: "PersistentVolumeClaim",
+		Name: source.Name,
+	}
+	// The clone holds the same database as its source
+	for _, annotation := range []string{SnapshotAnnotation, SnapshotChecksumAnnotation, VolumeSnapshotAnnotation, ClonedFromAnnotation} {
+		if value, ok := source.Annotations[annotation]; ok {
+			pvc.Annotations[annotation] = value
+		}
+	}
+	pvc.Annotations[UpgradedFromAnnotation] = source.Name
+	return pvc
+}
+
+// getUpgradeCandidate returns the node as it runs the new version, with the color of the upgrade
+func getUpgradeCandidate(cluster *v1alpha1.StarknetRPC) *v1alpha1.StarknetRPC {
+	candidate := cluster.DeepCopy()
+	candidate.Status.ActiveColor = cluster.Status.Upgrade.Color
+	candidate.Status.Upgrade = nil
+	return candidate
+}
+
+func isUpgradePastDeadline(cluster *v1alpha1.StarknetRPC) bool {
+	upgrade := cluster.Status.Upgrade
+	return upgrade.StartTime != nil && time.Since(upgrade.StartTime.Time) > getUpgradeProgressDeadline(cluster)
+}
+
+func getUpgradeProgressDeadline(cluster *v1alpha1.StarknetRPC) time.Duration {
+	policy := cluster.Spec.UpgradePolicy
+	if policy == nil || policy.ProgressDeadlineSeconds == nil {
+		return defaultUpgradeProgressDeadline
+	}
+	return time.Duration(*policy.ProgressDeadlineSeconds) * time.Second
+}
+
+func isBlueGreenUpgrade(cluster *v1alpha1.StarknetRPC) bool {
+	return cluster.Spec.UpgradePolicy != nil && cluster.Spec.UpgradePolicy.Strategy == v1alpha1.UpgradeStrategyBlueGreen
+}
+
+func getActiveColor(cluster *v1alpha1.StarknetRPC) v1alpha1.NodeColor {
+	if cluster.Status.ActiveColor == "" {
+		return v1alpha1.NodeColorBlue
+	}
+	return cluster.Status.ActiveColor
+}
+
+func getOtherColor(color v1alpha1.NodeColor) v1alpha1.NodeColor {
+	if color == v1alpha1.NodeColorGreen {
+		return v1alpha1.NodeColorBlue
+	}
+	return v1alpha1.NodeColorGreen
+}
+
+// getColorSuffix returns the suffix of the names of the pod and data volume of a color.
+// Blue keeps the names the nodes had before blue/green upgrades.
+func getColorSuffix(color v1alpha1.NodeColor) string {
+	if color == v1alpha1.NodeColorGreen {
+		return "-green"
+	}
+	return ""
+}
+
+func getColorLabelValue(color v1alpha1.NodeColor) string {
+	return strings.ToLower(string(color))
+}
+
+func setUpgradePhase(phase v1alpha1.UpgradePhase, message string) condition.StateTransition {
+	return func(rpc *v1alpha1.StarknetRPC) {
+		rpc.Status.Upgrade.Phase = phase
+		rpc.Status.Upgrade.Message = message
+	}
+}
+
+func setUpgradeCompletionTime(rpc *v1alpha1.StarknetRPC) {
+	now := metav1.Now()
+	rpc.Status.Upgrade.CompletionTime = &now
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// upgradeBackupLabel is set on the backups taken before an upgrade, with the name of the node
+const upgradeBackupLabel = "rpc.runelabs.xyz/upgrade-backup"
+
+// ReconcileUpgradeBackup backs up the database of the node before a new image is started on it.
+//
+// The node keeps running the previous image until the backup is completed (see getPodImage). The backup
+// stops the node while the database is compressed, through the quiesce annotation. If the backup fails,
+// the node keeps running the previous image until the failed backup is deleted, or the image changes again.
+func (r *StarknetRPCReconciler) ReconcileUpgradeBackup(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	policy := cluster.Spec.UpgradePolicy
+	if policy == nil || policy.BackupBeforeUpgrade == nil {
+		return &ctrl.Result{}, nil
+	}
+
+	wanted := getSpecImage(cluster)
+	status := cluster.Status.UpgradeBackup
+	if status != nil && status.ToImage == wanted {
+		return r.reconcileUpgradeBackupProgress(ctx, cluster)
+	}
+
+	// The database of a blue/green upgrade already started was backed up, or did not need to be
+	if upgrade := cluster.Status.Upgrade; upgrade != nil && upgrade.ToImage == wanted {
+		return &ctrl.Result{}, nil
+	}
+
+	// A node that is not running yet has no database to lose
+	running, err := r.getRunningImage(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if running == "" || running == wanted {
+		return &ctrl.Result{}, nil
+	}
+
+	backup := r.GetWantedUpgradeBackup(cluster, time.Now())
+	if err := r.Create(ctx, &backup); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Backing up the database before the upgrade", "backup", backup.Name, "from", running, "to", wanted)
+	r.Recorder.Event(cluster, "Normal", "UpgradeBackupStarted",
+		fmt.Sprintf("Backing up the database with %s before upgrading from %s to %s", backup.Name, running, wanted))
+	err = condition.SetPhases(ctx, r.Client, cluster, func(rpc *v1alpha1.StarknetRPC) {
+		rpc.Status.UpgradeBackup = &v1alpha1.UpgradeBackupStatus{
+			BackupName: backup.Name,
+			Phase:      v1alpha1.StarknetRPCBackupPhasePending,
+			FromImage:  running,
+			ToImage:    wanted,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+}
+
+// reconcileUpgradeBackupProgress follows the backup taken before the upgrade, and lets the upgrade go on
+// once it is completed
+func (r *StarknetRPCReconciler) reconcileUpgradeBackupProgress(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	status := cluster.Status.UpgradeBackup
+
+	if status.Phase == v1alpha1.StarknetRPCBackupPhaseCompleted {
+		return &ctrl.Result{}, nil
+	}
+
+	backup := &v1alpha1.StarknetRPCBackup{}
+	err := r.Get(ctx, client.ObjectKey{Name: status.BackupName, Namespace: cluster.Namespace}, backup)
+	if apierrs.IsNotFound(err) {
+		// The failed backup was deleted: take a new one
+		logger.Info("The backup taken before the upgrade is gone, taking a new one", "backup", status.BackupName)
+		err := condition.SetPhases(ctx, r.Client, cluster, func(rpc *v1alpha1.StarknetRPC) {
+			rpc.Status.UpgradeBackup = nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+	} else if err != nil {
+		return nil, err
+	}
+
+	if backup.Status.Phase != status.Phase {
+		switch backup.Status.Phase {
+		case v1alpha1.StarknetRPCBackupPhaseCompleted:
+			logger.Info("Database backed up, upgrading the node", "backup", backup.Name, "image", status.ToImage)
+			r.Recorder.Event(cluster, "Normal", "UpgradeBackupCompleted",
+				fmt.Sprintf("Database backed up to %s at block %d, upgrading to %s",
+					backup.Status.FileName, backup.Status.BlockHeight, status.ToImage))
+		case v1alpha1.StarknetRPCBackupPhaseFailed:
+			logger.Info("The backup taken before the upgrade failed", "backup", backup.Name, "reason", backup.Status.Message)
+			r.Recorder.Event(cluster, "Warning", "UpgradeBackupFailed",
+				fmt.Sprintf("Backup %s failed, the node keeps running %s: %s", backup.Name, status.FromImage, backup.Status.Message))
+		}
+
+		err := condition.SetPhases(ctx, r.Client, cluster, func(rpc *v1alpha1.StarknetRPC) {
+			rpc.Status.UpgradeBackup.Phase = backup.Status.Phase
+			rpc.Status.UpgradeBackup.FileName = backup.Status.FileName
+			rpc.Status.UpgradeBackup.Checksum = backup.Status.Checksum
+			rpc.Status.UpgradeBackup.BlockHeight = backup.Status.BlockHeight
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if backup.Status.Phase == v1alpha1.StarknetRPCBackupPhaseCompleted {
+		return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+	}
+
+	// The node keeps running the previous image, until the backup is completed
+	logger.V(1).Info("Waiting for the backup taken before the upgrade", "backup", backup.Name, "phase", backup.Status.Phase)
+	return &ctrl.Result{}, nil
+}
+
+// GetWantedUpgradeBackup returns the backup taken before the upgrade of the node
+func (r *StarknetRPCReconciler) GetWantedUpgradeBackup(cluster *v1alpha1.StarknetRPC, at time.Time) v1alpha1.StarknetRPCBackup {
+	template := cluster.Spec.UpgradePolicy.BackupBeforeUpgrade.DeepCopy()
+
+	return v1alpha1.StarknetRPCBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-upgrade-%d", cluster.Name, at.Unix()),
+			Namespace: cluster.Namespace,
+			Labels: map[string]string{
+				upgradeBackupLabel:      cluster.Name,
+				"rpc.runelabs.xyz/name": cluster.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion:         cluster.APIVersion,
+					Kind:               cluster.Kind,
+					Name:               cluster.Name,
+					UID:                cluster.UID,
+					Controller:         &[]bool{true}[0],
+					BlockOwnerDeletion: &[]bool{true}[0],
+				},
+			},
+		},
+		Spec: v1alpha1.StarknetRPCBackupSpec{
+			StarknetRPC: corev1.LocalObjectReference{Name: cluster.Name},
+			Destination: template.Destination,
+			Image:       template.Image,
+			Storage:     template.Storage,
+		},
+	}
+}
+
+// isUpgradeBackupPending returns true while the backup taken before the upgrade to the image of the spec
+// is not completed
+func isUpgradeBackupPending(rpc *v1alpha1.StarknetRPC) bool {
+	status := rpc.Status.UpgradeBackup
+	return status != nil && status.ToImage == getSpecImage(rpc) && status.Phase != v1alpha1.StarknetRPCBackupPhaseCompleted
+}
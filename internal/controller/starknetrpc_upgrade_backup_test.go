@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPC backup before upgrade", func() {
+	Context("When the image of a node backed up before its upgrades changes", func() {
+		const (
+			resourceName = "test-starknet-rpc-upgrade-backup"
+			namespace    = "default"
+			network      = "mainnet"
+			fromImage    = "eqlabs/pathfinder:v0.20.0"
+			toImage      = "eqlabs/pathfinder:v0.21.0"
+		)
+
+		var (
+			ctx         context.Context
+			starknetRPC *v1alpha1.StarknetRPC
+			pod         *corev1.Pod
+			reconciler  *StarknetRPCReconciler
+		)
+
+		reload := func() {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+		}
+
+		// startBackup detects the image change, and returns the backup taken before the upgrade
+		startBackup := func() *v1alpha1.StarknetRPCBackup {
+			_, err := reconciler.ReconcileUpgradeBackup(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			reload()
+			Expect(starknetRPC.Status.UpgradeBackup).NotTo(BeNil())
+			backup := &v1alpha1.StarknetRPCBackup{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Name: starknetRPC.Status.UpgradeBackup.BackupName, Namespace: namespace}, backup)).To(Succeed())
+			return backup
+		}
+
+		setBackupPhase := func(backup *v1alpha1.StarknetRPCBackup, phase v1alpha1.StarknetRPCBackupPhase) {
+			backup.Status.Phase = phase
+			if phase == v1alpha1.StarknetRPCBackupPhaseCompleted {
+				backup.Status.FileName = "mainnet_1000.sqlite.zst"
+				backup.Status.Checksum = "test-checksum"
+				backup.Status.BlockHeight = 1000
+			}
+			Expect(k8sClient.Status().Update(ctx, backup)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			starknetRPC.Spec.Image = &[]string{fromImage}[0]
+			starknetRPC.Spec.RestoreArchive.Enable = &[]bool{true}[0]
+			starknetRPC.Spec.UpgradePolicy = &v1alpha1.UpgradePolicy{
+				BackupBeforeUpgrade: &v1alpha1.UpgradeBackupTemplate{
+					Destination: v1alpha1.BackupDestination{
+						RcloneConfig: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "rclone-config"},
+							Key:                  "rclone.conf",
+						},
+						Remote: "snapshots:bucket/mainnet",
+					},
+					Storage: v1alpha1.StorageTemplate{
+						Size: resource.MustParse("50Gi"),
+					},
+				},
+			}
+			createTestStarknetRPC(ctx, starknetRPC)
+
+			reconciler = &StarknetRPCReconciler{
+				Client:       k8sClient,
+				Scheme:       k8sClient.Scheme(),
+				Recorder:     record.NewFakeRecorder(10),
+				HealthClient: proxy.NewFakeNodeHealthClient(1000, 1000),
+			}
+
+			// The node runs the previous image
+			wantedPod := reconciler.GetWantedPod(starknetRPC)
+			pod = &wantedPod
+			Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+
+			markArchiveAsFinished(starknetRPC)
+			starknetrpc.StarknetRPCAvailableStatusReady.Apply()(starknetRPC)
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).Should(Succeed())
+
+			// The image is changed
+			starknetRPC.Spec.Image = &[]string{toImage}[0]
+			Expect(k8sClient.Update(ctx, starknetRPC)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			backups := &v1alpha1.StarknetRPCBackupList{}
+			Expect(k8sClient.List(ctx, backups, client.InNamespace(namespace),
+				client.MatchingLabels{upgradeBackupLabel: resourceName})).To(Succeed())
+			for i := range backups.Items {
+				_ = k8sClient.Delete(ctx, &backups.Items[i])
+			}
+			_ = k8sClient.Delete(ctx, pod)
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should back up the database, and keep running the previous image until the backup is completed", func() {
+			backup := startBackup()
+			Expect(backup.Spec.StarknetRPC.Name).To(Equal(resourceName))
+			Expect(backup.Spec.Destination.Remote).To(Equal("snapshots:bucket/mainnet"))
+			Expect(backup.Spec.Storage.Size.String()).To(Equal("50Gi"))
+			Expect(backup.OwnerReferences).To(HaveLen(1))
+			Expect(backup.OwnerReferences[0].Name).To(Equal(resourceName))
+
+			Expect(starknetRPC.Status.UpgradeBackup.FromImage).To(Equal(fromImage))
+			Expect(starknetRPC.Status.UpgradeBackup.ToImage).To(Equal(toImage))
+			Expect(getPodImage(starknetRPC)).To(Equal(fromImage))
+
+			By("Waiting for the backup")
+			setBackupPhase(backup, v1alpha1.StarknetRPCBackupPhaseRunning)
+			_, err := reconciler.ReconcileUpgradeBackup(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			reload()
+			Expect(starknetRPC.Status.UpgradeBackup.Phase).To(Equal(v1alpha1.StarknetRPCBackupPhaseRunning))
+			Expect(getPodImage(starknetRPC)).To(Equal(fromImage))
+
+			By("Upgrading the node once the backup is completed")
+			setBackupPhase(backup, v1alpha1.StarknetRPCBackupPhaseCompleted)
+			_, err = reconciler.ReconcileUpgradeBackup(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			reload()
+			Expect(starknetRPC.Status.UpgradeBackup.Phase).To(Equal(v1alpha1.StarknetRPCBackupPhaseCompleted))
+			Expect(starknetRPC.Status.UpgradeBackup.FileName).To(Equal("mainnet_1000.sqlite.zst"))
+			Expect(starknetRPC.Status.UpgradeBackup.Checksum).To(Equal("test-checksum"))
+			Expect(starknetRPC.Status.UpgradeBackup.BlockHeight).To(Equal(int64(1000)))
+			Expect(getPodImage(starknetRPC)).To(Equal(toImage))
+
+			_, err = reconciler.ReconcileUpgradeBackup(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should not upgrade the node when the backup fails, until it is deleted", func() {
+			backup := startBackup()
+
+			setBackupPhase(backup, v1alpha1.StarknetRPCBackupPhaseFailed)
+			_, err := reconciler.ReconcileUpgradeBackup(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			reload()
+			Expect(starknetRPC.Status.UpgradeBackup.Phase).To(Equal(v1alpha1.StarknetRPCBackupPhaseFailed))
+			Expect(getPodImage(starknetRPC)).To(Equal(fromImage))
+
+			_, err = reconciler.ReconcilePod(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			current := &corev1.Pod{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), current)).To(Succeed())
+			Expect(current.Spec.Containers[0].Image).To(Equal(fromImage))
+
+			By("Taking a new backup once the failed one is deleted")
+			Expect(k8sClient.Delete(ctx, backup)).To(Succeed())
+			_, err = reconciler.ReconcileUpgradeBackup(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			reload()
+			Expect(starknetRPC.Status.UpgradeBackup).To(BeNil())
+		})
+	})
+})
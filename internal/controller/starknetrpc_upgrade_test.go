@@ -0,0 +1,261 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/proxy"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPC blue/green upgrade", func() {
+	Context("When the image of a node upgraded with the BlueGreen strategy changes", func() {
+		const (
+			resourceName = "test-starknet-rpc-upgrade"
+			namespace    = "default"
+			network      = "mainnet"
+			fromImage    = "eqlabs/pathfinder:v0.20.0"
+			toImage      = "eqlabs/pathfinder:v0.21.0"
+		)
+
+		var (
+			ctx          context.Context
+			starknetRPC  *v1alpha1.StarknetRPC
+			pvc          *corev1.PersistentVolumeClaim
+			pod          *corev1.Pod
+			healthClient *proxy.FakeNodeHealthClient
+			reconciler   *StarknetRPCReconciler
+		)
+
+		reload := func() {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+		}
+
+		// deleteVolume deletes a volume, as done by Kubernetes once no pod uses it anymore
+		deleteVolume := func(key client.ObjectKey) {
+			current := &corev1.PersistentVolumeClaim{}
+			if err := k8sClient.Get(ctx, key, current); err == nil {
+				current.Finalizers = nil
+				_ = k8sClient.Update(ctx, current)
+				_ = k8sClient.Delete(ctx, current)
+			}
+		}
+
+		// startUpgradeCandidate runs a started upgrade until the new version runs on the cloned volume
+		startUpgradeCandidate := func() *corev1.Pod {
+			// Clone the volume
+			_, err := reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			clone := &corev1.PersistentVolumeClaim{}
+			Expect(k8sClient.Get(ctx, reconciler.GetStoragePvcName(getUpgradeCandidate(starknetRPC)), clone)).To(Succeed())
+			clone.Status.Phase = corev1.ClaimBound
+			Expect(k8sClient.Status().Update(ctx, clone)).To(Succeed())
+
+			_, err = reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(starknetRPC.Status.Upgrade.Phase).To(Equal(v1alpha1.UpgradePhaseSyncing))
+
+			// Start the new version
+			_, err = reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			candidate := &corev1.Pod{}
+			Expect(k8sClient.Get(ctx, reconciler.GetPodName(getUpgradeCandidate(starknetRPC)), candidate)).To(Succeed())
+			candidate.Status.Phase = corev1.PodRunning
+			Expect(k8sClient.Status().Update(ctx, candidate)).To(Succeed())
+			return candidate
+		}
+
+		// startUpgrade runs the upgrade until the new version runs on the cloned volume
+		startUpgrade := func() *corev1.Pod {
+			_, err := reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			return startUpgradeCandidate()
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			starknetRPC.Spec.Image = &[]string{fromImage}[0]
+			starknetRPC.Spec.RestoreArchive.Enable = &[]bool{true}[0]
+			starknetRPC.Spec.UpgradePolicy = &v1alpha1.UpgradePolicy{
+				Strategy: v1alpha1.UpgradeStrategyBlueGreen,
+			}
+			createTestStarknetRPC(ctx, starknetRPC)
+
+			healthClient = proxy.NewFakeNodeHealthClient(100, 1000)
+			reconciler = &StarknetRPCReconciler{
+				Client:       k8sClient,
+				Scheme:       k8sClient.Scheme(),
+				Recorder:     record.NewFakeRecorder(20),
+				HealthClient: healthClient,
+			}
+
+			// The node runs the previous image on its restored volume
+			wantedPvc := reconciler.GetWantedPvc(starknetRPC)
+			pvc = &wantedPvc
+			Expect(k8sClient.Create(ctx, pvc)).Should(Succeed())
+			wantedPod := reconciler.GetWantedPod(starknetRPC)
+			pod = &wantedPod
+			Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+			Expect(reconciler.ReconcileService(ctx, starknetRPC)).Error().NotTo(HaveOccurred())
+
+			markArchiveAsFinished(starknetRPC)
+			starknetrpc.StarknetRPCAvailableStatusReady.Apply()(starknetRPC)
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).Should(Succeed())
+
+			// The image is changed
+			starknetRPC.Spec.Image = &[]string{toImage}[0]
+			Expect(k8sClient.Update(ctx, starknetRPC)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			for _, color := range []v1alpha1.NodeColor{v1alpha1.NodeColorBlue, v1alpha1.NodeColorGreen} {
+				node := starknetRPC.DeepCopy()
+				node.Status.ActiveColor = color
+				_ = reconciler.deleteNode(ctx, node)
+				deleteVolume(reconciler.GetStoragePvcName(node))
+			}
+			_ = k8sClient.Delete(ctx, &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: reconciler.GetServiceName(starknetRPC).Name, Namespace: namespace},
+			})
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should keep the node running the previous image while the new one catches up", func() {
+			_, err := reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			reload()
+			Expect(starknetRPC.Status.Upgrade).NotTo(BeNil())
+			Expect(starknetRPC.Status.Upgrade.Phase).To(Equal(v1alpha1.UpgradePhaseCloning))
+			Expect(starknetRPC.Status.Upgrade.FromImage).To(Equal(fromImage))
+			Expect(starknetRPC.Status.Upgrade.ToImage).To(Equal(toImage))
+			Expect(starknetRPC.Status.Upgrade.Color).To(Equal(v1alpha1.NodeColorGreen))
+			Expect(getPodImage(starknetRPC)).To(Equal(fromImage))
+
+			By("Cloning the data volume")
+			_, err = reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			clone := &corev1.PersistentVolumeClaim{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Name: resourceName + "-storage-green", Namespace: namespace}, clone)).To(Succeed())
+			Expect(clone.Spec.DataSource).NotTo(BeNil())
+			Expect(clone.Spec.DataSource.Kind).To(Equal("PersistentVolumeClaim"))
+			Expect(clone.Spec.DataSource.Name).To(Equal(pvc.Name))
+		})
+
+		It("Should switch the traffic to the new version once it caught up, and retire the previous one", func() {
+			candidate := startUpgrade()
+			Expect(candidate.Name).To(Equal(resourceName + "-rpc-green"))
+			Expect(candidate.Spec.Containers[0].Image).To(Equal(toImage))
+			Expect(candidate.Labels).To(HaveKeyWithValue(ColorLabel, "green"))
+
+			By("Waiting for the new version to catch up")
+			_, err := reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(starknetRPC.Status.Upgrade.Phase).To(Equal(v1alpha1.UpgradePhaseSyncing))
+
+			By("Promoting the new version")
+			healthClient.SetSyncStatus(1000, 1000)
+			_, err = reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			reload()
+			Expect(starknetRPC.Status.Upgrade.Phase).To(Equal(v1alpha1.UpgradePhasePromoting))
+			Expect(starknetRPC.Status.ActiveColor).To(Equal(v1alpha1.NodeColorGreen))
+			Expect(reconciler.GetPodName(starknetRPC).Name).To(Equal(candidate.Name))
+			Expect(getPodImage(starknetRPC)).To(Equal(toImage))
+
+			By("Waiting for the Service to select the new version")
+			_, err = reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})).To(Succeed())
+
+			Expect(reconciler.ReconcileService(ctx, starknetRPC)).Error().NotTo(HaveOccurred())
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, reconciler.GetServiceName(starknetRPC), service)).To(Succeed())
+			Expect(service.Spec.Selector).To(HaveKeyWithValue(ColorLabel, "green"))
+
+			By("Retiring the previous pod and volume")
+			_, err = reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})
+			Expect(apierrs.IsNotFound(err)).To(BeTrue())
+
+			deleteVolume(client.ObjectKeyFromObject(pvc))
+			_, err = reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			reload()
+			Expect(starknetRPC.Status.Upgrade.Phase).To(Equal(v1alpha1.UpgradePhaseSucceeded))
+			Expect(starknetRPC.Status.Upgrade.CompletionTime).NotTo(BeNil())
+		})
+
+		It("Should restart the upgrade when the image changes while the new version catches up", func() {
+			const nextImage = "eqlabs/pathfinder:v0.22.0"
+			candidate := startUpgrade()
+
+			reload()
+			starknetRPC.Spec.Image = &[]string{nextImage}[0]
+			Expect(k8sClient.Update(ctx, starknetRPC)).To(Succeed())
+
+			// The node keeps running the previous image, instead of being re-created with the new one
+			Expect(getPodImage(starknetRPC)).To(Equal(fromImage))
+
+			By("Deleting the superseded new version")
+			_, err := reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(candidate), &corev1.Pod{})
+			Expect(apierrs.IsNotFound(err)).To(BeTrue())
+			Expect(getPodImage(starknetRPC)).To(Equal(fromImage))
+
+			deleteVolume(reconciler.GetStoragePvcName(getUpgradeCandidate(starknetRPC)))
+			_, err = reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+
+			reload()
+			Expect(starknetRPC.Status.Upgrade.Phase).To(Equal(v1alpha1.UpgradePhaseCloning))
+			Expect(starknetRPC.Status.Upgrade.FromImage).To(Equal(fromImage))
+			Expect(starknetRPC.Status.Upgrade.ToImage).To(Equal(nextImage))
+			Expect(starknetRPC.Status.ActiveColor).To(BeEmpty())
+			Expect(getPodImage(starknetRPC)).To(Equal(fromImage))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})).To(Succeed())
+
+			By("Starting the new image on a new clone")
+			candidate = startUpgradeCandidate()
+			Expect(candidate.Spec.Containers[0].Image).To(Equal(nextImage))
+		})
+
+		It("Should roll back when the new version does not catch up in time", func() {
+			candidate := startUpgrade()
+
+			reload()
+			starknetRPC.Status.Upgrade.StartTime = &metav1.Time{Time: time.Now().Add(-3 * time.Hour)}
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).To(Succeed())
+
+			_, err := reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			reload()
+			Expect(starknetRPC.Status.Upgrade.Phase).To(Equal(v1alpha1.UpgradePhaseRolledBack))
+			Expect(starknetRPC.Status.ActiveColor).To(BeEmpty())
+			Expect(getPodImage(starknetRPC)).To(Equal(fromImage))
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(candidate), &corev1.Pod{})
+			Expect(apierrs.IsNotFound(err)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})).To(Succeed())
+
+			By("Not retrying the same image")
+			_, err = reconciler.ReconcileUpgrade(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(starknetRPC.Status.Upgrade.Phase).To(Equal(v1alpha1.UpgradePhaseRolledBack))
+		})
+	})
+})
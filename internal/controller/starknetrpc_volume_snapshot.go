@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// VolumeSnapshotAnnotation is set on the data volume, with the name of the VolumeSnapshot it was seeded from
+	VolumeSnapshotAnnotation = "pathfinder.runelabs.xyz/volume-snapshot"
+
+	// volumeSnapshotAPIGroup is the API group of the CSI VolumeSnapshots
+	volumeSnapshotAPIGroup = "snapshot.storage.k8s.io"
+)
+
+// ReconcileVolumeSnapshotRestore waits for the data volume, created from a VolumeSnapshot, to be bound.
+//
+// The storage provisioner restores the snapshot while binding the claim: once bound, the volume
+// holds the database and the restore is successful.
+func (r *StarknetRPCReconciler) ReconcileVolumeSnapshotRestore(ctx context.Context, cluster *v1alpha1.StarknetRPC) (*ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	source := getVolumeSnapshotSource(cluster)
+
+	var pvc corev1.PersistentVolumeClaim
+	if err := r.Get(ctx, r.GetStoragePvcName(cluster), &pvc); err != nil {
+		if apierrs.IsNotFound(err) {
+			return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+		}
+		return nil, err
+	}
+
+	if !isReady(&pvc) || pvc.DeletionTimestamp != nil {
+		logger.V(1).Info("Waiting for the data volume to be restored from the VolumeSnapshot", "pvc", pvc.Name, "volumeSnapshot", source.Name)
+
+		restoreCondition := meta.FindStatusCondition(cluster.Status.Conditions, string(starknetrpc.StarknetRPCRestoreCondition))
+		if restoreCondition == nil || restoreCondition.Reason != string(starknetrpc.StarknetRPCRestoreStatusRestoring) {
+			r.Recorder.Event(cluster, "Normal", "RestoreStarted",
+				fmt.Sprintf("Restoring the data volume from VolumeSnapshot %s", source.Name))
+			if err := condition.SetPhases(ctx, r.Client, cluster, starknetrpc.StarknetRPCRestoreStatusRestoring.Apply()); err != nil {
+				return nil, err
+			}
+		}
+
+		return &ctrl.Result{RequeueAfter: 5 * time.Second}, errs.ErrNextLoop
+	}
+
+	// Tie the data volume to the restored snapshot
+	if err := r.recordRestoredVolume(ctx, cluster, &pvc); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Data volume restored from the VolumeSnapshot", "pvc", pvc.Name, "volumeSnapshot", source.Name)
+	r.Recorder.Event(cluster, "Normal", "RestoreFinished",
+		fmt.Sprintf("Data volume restored from VolumeSnapshot %s", source.Name))
+	if err := condition.SetPhases(ctx, r.Client, cluster, starknetrpc.StarknetRPCRestoreStatusSuccess.Apply()); err != nil {
+		return nil, err
+	}
+
+	return &ctrl.Result{RequeueAfter: time.Second}, errs.ErrNextLoop
+}
+
+// getVolumeSnapshotSource returns the VolumeSnapshot the data volume is seeded from, if any
+func getVolumeSnapshotSource(cluster *v1alpha1.StarknetRPC) *v1alpha1.VolumeSnapshotSource {
+	if cluster.Spec.RestoreFrom == nil {
+		return nil
+	}
+	return cluster.Spec.RestoreFrom.VolumeSnapshot
+}
+
+// getPvcDataSource returns the data source of the data volume, if it is seeded from a VolumeSnapshot.
+// The data source of a volume cloned from another node depends on the source node, see getCloneDataSource.
+func getPvcDataSource(cluster *v1alpha1.StarknetRPC) *corev1.TypedLocalObjectReference {
+	if source := getVolumeSnapshotSource(cluster); source != nil {
+		return &corev1.TypedLocalObjectReference{
+			APIGroup: &[]string{volumeSnapshotAPIGroup}[0],
+			Kind:     "VolumeSnapshot",
+			Name:     source.Name,
+		}
+	}
+
+	return nil
+}
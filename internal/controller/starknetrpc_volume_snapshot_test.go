@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	errs "github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPC VolumeSnapshot restore", func() {
+	Context("When restoring the data volume from a VolumeSnapshot", func() {
+		const (
+			resourceName = "test-starknet-rpc-volume-snapshot"
+			namespace    = "default"
+			network      = "mainnet"
+		)
+
+		var (
+			ctx         context.Context
+			starknetRPC *v1alpha1.StarknetRPC
+			reconciler  *StarknetRPCReconciler
+		)
+
+		restoreReason := func() string {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			restore := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Restore")
+			Expect(restore).NotTo(BeNil())
+			return restore.Reason
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			starknetRPC.Spec.RestoreFrom = &v1alpha1.RestoreSource{
+				VolumeSnapshot: &v1alpha1.VolumeSnapshotSource{Name: "mainnet-snapshot"},
+			}
+			createTestStarknetRPC(ctx, starknetRPC)
+			starknetRPC.Status.Conditions = []metav1.Condition{}
+			starknetrpc.StarknetRPCRestoreStatusPending.Apply()(starknetRPC)
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).Should(Succeed())
+
+			reconciler = &StarknetRPCReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
+			}
+		})
+
+		AfterEach(func() {
+			pvc := &corev1.PersistentVolumeClaim{}
+			if err := k8sClient.Get(ctx, reconciler.GetStoragePvcName(starknetRPC), pvc); err == nil {
+				pvc.Finalizers = nil
+				_ = k8sClient.Update(ctx, pvc)
+				_ = k8sClient.Delete(ctx, pvc)
+			}
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should require a restore source", func() {
+			invalid := starknetRPC.DeepCopy()
+			invalid.ObjectMeta = metav1.ObjectMeta{Name: resourceName + "-invalid", Namespace: namespace}
+			invalid.Spec.RestoreFrom = nil
+			Expect(k8sClient.Create(ctx, invalid)).NotTo(Succeed())
+		})
+
+		It("Should create the data volume from the VolumeSnapshot", func() {
+			pvc := reconciler.GetWantedPvc(starknetRPC)
+			Expect(pvc.Spec.DataSource).NotTo(BeNil())
+			Expect(*pvc.Spec.DataSource.APIGroup).To(Equal("snapshot.storage.k8s.io"))
+			Expect(pvc.Spec.DataSource.Kind).To(Equal("VolumeSnapshot"))
+			Expect(pvc.Spec.DataSource.Name).To(Equal("mainnet-snapshot"))
+		})
+
+		It("Should report the restore as successful once the volume is bound", func() {
+			_, err := reconciler.ReconcilePvc(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = reconciler.ReconcileArchiveRestore(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusRestoring)))
+
+			// No scratch volume nor job is needed
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(&corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-archive-restore", Namespace: namespace},
+			}), &corev1.PersistentVolumeClaim{})).NotTo(Succeed())
+
+			pvc := &corev1.PersistentVolumeClaim{}
+			Expect(k8sClient.Get(ctx, reconciler.GetStoragePvcName(starknetRPC), pvc)).To(Succeed())
+			pvc.Status.Phase = corev1.ClaimBound
+			Expect(k8sClient.Status().Update(ctx, pvc)).To(Succeed())
+
+			_, err = reconciler.ReconcileArchiveRestore(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusSuccess)))
+			Expect(meta.IsStatusConditionTrue(starknetRPC.Status.Conditions, "Restore")).To(BeTrue())
+			Expect(starknetRPC.Status.Restore.VolumeUID).To(Equal(pvc.UID))
+
+			Expect(k8sClient.Get(ctx, reconciler.GetStoragePvcName(starknetRPC), pvc)).To(Succeed())
+			Expect(pvc.Annotations).To(HaveKeyWithValue(VolumeSnapshotAnnotation, "mainnet-snapshot"))
+
+			// The volume is checked like an archive restored one
+			Expect(k8sClient.Delete(ctx, pvc)).To(Succeed())
+			_, err = reconciler.CheckDataVolume(ctx, starknetRPC)
+			Expect(err).To(Equal(errs.ErrNextLoop))
+			Expect(restoreReason()).To(Equal(string(starknetrpc.StarknetRPCRestoreStatusPending)))
+		})
+	})
+})
@@ -0,0 +1,395 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	pathfinderv1alpha1 "github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+)
+
+// backupPollInterval is the interval between two checks of a running backup
+const backupPollInterval = 30 * time.Second
+
+// +kubebuilder:rbac:groups=pathfinder.runelabs.xyz,resources=starknetrpcbackups,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=pathfinder.runelabs.xyz,resources=starknetrpcbackups/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=pathfinder.runelabs.xyz,resources=starknetrpcbackups/finalizers,verbs=update
+
+// StarknetRPCBackupReconciler reconciles a StarknetRPCBackup object
+type StarknetRPCBackupReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// backupResult is the termination message written by the backup script
+type backupResult struct {
+	FileName    string `json:"fileName"`
+	Checksum    string `json:"checksum"`
+	Size        int64  `json:"size"`
+	BlockHeight int64  `json:"blockHeight"`
+}
+
+// Reconcile takes a backup of the database of a StarknetRPC node.
+//
+// The node is stopped (quiesced) through an annotation on the StarknetRPC, then a job
+// compresses the database, computes its checksum and uploads it. The node is released
+// once the backup is finished, whether it succeeded or not.
+func (r *StarknetRPCBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	backup := &pathfinderv1alpha1.StarknetRPCBackup{}
+	if err := r.Get(ctx, req.NamespacedName, backup); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	logger.V(1).Info("Reconciling StarknetRPCBackup", "name", backup.Name, "phase", backup.Status.Phase)
+
+	if isBackupFinished(backup) {
+		return ctrl.Result{}, r.cleanup(ctx, backup)
+	}
+
+	rpc := &pathfinderv1alpha1.StarknetRPC{}
+	err := r.Get(ctx, types.NamespacedName{Name: backup.Spec.StarknetRPC.Name, Namespace: backup.Namespace}, rpc)
+	if apierrs.IsNotFound(err) {
+		return ctrl.Result{}, r.fail(ctx, backup, fmt.Sprintf("StarknetRPC %s not found", backup.Spec.StarknetRPC.Name))
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// 1. Only a restored database can be backed up
+	if !meta.IsStatusConditionTrue(rpc.Status.Conditions, "Restore") {
+		err := r.setPhase(ctx, backup, pathfinderv1alpha1.StarknetRPCBackupPhasePending,
+			"Waiting for the database of the node to be restored")
+		return ctrl.Result{RequeueAfter: backupPollInterval}, err
+	}
+
+	// 2. Quiesce the node, unless another backup is already running on it
+	holder := rpc.Annotations[QuiesceAnnotation]
+	if holder != "" && holder != backup.Name {
+		err := r.setPhase(ctx, backup, pathfinderv1alpha1.StarknetRPCBackupPhasePending,
+			fmt.Sprintf("Waiting for backup %s to finish", holder))
+		return ctrl.Result{RequeueAfter: backupPollInterval}, err
+	}
+	if holder == "" {
+		original := rpc.DeepCopy()
+		if rpc.Annotations == nil {
+			rpc.Annotations = make(map[string]string)
+		}
+		rpc.Annotations[QuiesceAnnotation] = backup.Name
+		if err := r.Patch(ctx, rpc, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		logger.Info("Stopping the node for the backup", "node", rpc.Name)
+		r.Recorder.Event(backup, "Normal", "Quiescing", fmt.Sprintf("Stopping StarknetRPC %s", rpc.Name))
+		err := r.setPhase(ctx, backup, pathfinderv1alpha1.StarknetRPCBackupPhaseQuiescing,
+			fmt.Sprintf("Stopping StarknetRPC %s", rpc.Name), func(backup *pathfinderv1alpha1.StarknetRPCBackup) {
+				now := metav1.Now()
+				backup.Status.StartTime = &now
+			})
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// 3. Wait for the node to be stopped
+	pod := &corev1.Pod{}
+	err = r.Get(ctx, getNodePodName(rpc), pod)
+	if err == nil {
+		logger.V(1).Info("Waiting for the node to be stopped", "pod", pod.Name)
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	} else if !apierrs.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	// 4. Run the backup job
+	scratch := r.GetWantedBackupPvc(backup)
+	if err := r.Create(ctx, &scratch); err != nil && !apierrs.IsAlreadyExists(err) {
+		return ctrl.Result{}, err
+	}
+
+	job := r.GetWantedBackupJob(backup, rpc)
+	err = r.Create(ctx, &job)
+	if err == nil {
+		logger.Info("Created backup job", "job", job.Name)
+		r.Recorder.Event(backup, "Normal", "BackupStarted", fmt.Sprintf("Backup job %s created", job.Name))
+		err := r.setPhase(ctx, backup, pathfinderv1alpha1.StarknetRPCBackupPhaseRunning,
+			"The database is being compressed and uploaded", func(backup *pathfinderv1alpha1.StarknetRPCBackup) {
+				backup.Status.JobName = job.Name
+			})
+		return ctrl.Result{RequeueAfter: backupPollInterval}, err
+	} else if !apierrs.IsAlreadyExists(err) {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(&job), &job); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if job.Status.Succeeded > 0 {
+		return ctrl.Result{}, r.complete(ctx, backup, &job)
+	} else if job.Status.Failed > 0 {
+		return ctrl.Result{}, r.fail(ctx, backup, getJobFailureReason(ctx, r.Client, &job))
+	}
+
+	logger.V(1).Info("Backup still in progress, waiting for completion")
+	return ctrl.Result{RequeueAfter: backupPollInterval}, nil
+}
+
+// complete records the snapshot uploaded by the job, and releases the node
+func (r *StarknetRPCBackupReconciler) complete(ctx context.Context, backup *pathfinderv1alpha1.StarknetRPCBackup, job *batchv1.Job) error {
+	message, err := getJobResult(ctx, r.Client, job)
+	if err != nil {
+		return err
+	}
+
+	result := backupResult{}
+	if err := json.Unmarshal([]byte(message), &result); err != nil {
+		return r.fail(ctx, backup, fmt.Sprintf("Failed to read the result of the backup job: %s", err))
+	}
+
+	log.FromContext(ctx).Info("Backup completed", "fileName", result.FileName, "blockHeight", result.BlockHeight)
+	r.Recorder.Event(backup, "Normal", "BackupCompleted",
+		fmt.Sprintf("Snapshot %s uploaded at block %d", result.FileName, result.BlockHeight))
+
+	err = r.setPhase(ctx, backup, pathfinderv1alpha1.StarknetRPCBackupPhaseCompleted,
+		fmt.Sprintf("Snapshot %s uploaded", result.FileName), func(backup *pathfinderv1alpha1.StarknetRPCBackup) {
+			backup.Status.FileName = result.FileName
+			backup.Status.Checksum = result.Checksum
+			backup.Status.Size = result.Size
+			backup.Status.BlockHeight = result.BlockHeight
+			now := metav1.Now()
+			backup.Status.CompletionTime = &now
+		})
+	if err != nil {
+		return err
+	}
+
+	return r.cleanup(ctx, backup)
+}
+
+// fail marks the backup as failed, and releases the node
+func (r *StarknetRPCBackupReconciler) fail(ctx context.Context, backup *pathfinderv1alpha1.StarknetRPCBackup, reason string) error {
+	log.FromContext(ctx).Info("Backup failed", "reason", reason)
+	r.Recorder.Event(backup, "Warning", "BackupFailed", reason)
+
+	err := r.setPhase(ctx, backup, pathfinderv1alpha1.StarknetRPCBackupPhaseFailed, reason,
+		func(backup *pathfinderv1alpha1.StarknetRPCBackup) {
+			now := metav1.Now()
+			backup.Status.CompletionTime = &now
+		})
+	if err != nil {
+		return err
+	}
+
+	return r.cleanup(ctx, backup)
+}
+
+// cleanup releases the node and deletes the scratch volume of a finished backup.
+// The job is kept, so that its logs can be inspected.
+func (r *StarknetRPCBackupReconciler) cleanup(ctx context.Context, backup *pathfinderv1alpha1.StarknetRPCBackup) error {
+	rpc := &pathfinderv1alpha1.StarknetRPC{}
+	err := r.Get(ctx, types.NamespacedName{Name: backup.Spec.StarknetRPC.Name, Namespace: backup.Namespace}, rpc)
+	if err == nil {
+		if err := releaseQuiescedNode(ctx, r.Client, rpc, backup.Name); err != nil {
+			return err
+		}
+	} else if !apierrs.IsNotFound(err) {
+		return err
+	}
+
+	scratch := r.GetWantedBackupPvc(backup)
+	return client.IgnoreNotFound(r.Delete(ctx, &scratch))
+}
+
+// setPhase updates the phase of the backup, if it changed
+func (r *StarknetRPCBackupReconciler) setPhase(ctx context.Context, backup *pathfinderv1alpha1.StarknetRPCBackup, phase pathfinderv1alpha1.StarknetRPCBackupPhase, message string, mutations ...func(*pathfinderv1alpha1.StarknetRPCBackup)) error {
+	if backup.Status.Phase == phase && backup.Status.Message == message && len(mutations) == 0 {
+		return nil
+	}
+
+	backup.Status.Phase = phase
+	backup.Status.Message = message
+	for _, mutate := range mutations {
+		mutate(backup)
+	}
+	return r.Status().Update(ctx, backup)
+}
+
+// getBackupOwnerReference returns the owner reference set on the objects created for the backup
+func getBackupOwnerReference(backup *pathfinderv1alpha1.StarknetRPCBackup) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion:         pathfinderv1alpha1.GroupVersion.String(),
+		Kind:               "StarknetRPCBackup",
+		Name:               backup.Name,
+		UID:                backup.UID,
+		Controller:         &[]bool{true}[0],
+		BlockOwnerDeletion: &[]bool{true}[0],
+	}
+}
+
+func getBackupLabels(backup *pathfinderv1alpha1.StarknetRPCBackup) map[string]string {
+	return map[string]string{
+		"rpc.runelabs.xyz/type":   "starknet",
+		"rpc.runelabs.xyz/name":   backup.Spec.StarknetRPC.Name,
+		"rpc.runelabs.xyz/backup": backup.Name,
+	}
+}
+
+// GetWantedBackupPvc returns the scratch volume holding the compressed snapshot before its upload
+func (r *StarknetRPCBackupReconciler) GetWantedBackupPvc(backup *pathfinderv1alpha1.StarknetRPCBackup) corev1.PersistentVolumeClaim {
+	return corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:          getBackupLabels(backup),
+			Name:            fmt.Sprintf("%s-backup-scratch", backup.Name),
+			Namespace:       backup.Namespace,
+			OwnerReferences: []metav1.OwnerReference{getBackupOwnerReference(backup)},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteOnce,
+			},
+			StorageClassName: getStorageClassName(&backup.Spec.Storage),
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: backup.Spec.Storage.Size,
+				},
+			},
+		},
+	}
+}
+
+func getBackupEnvVars(backup *pathfinderv1alpha1.StarknetRPCBackup, rpc *pathfinderv1alpha1.StarknetRPC) []corev1.EnvVar {
+	envVars := []corev1.EnvVar{
+		{
+			Name:  "PATHFINDER_NETWORK",
+			Value: rpc.Spec.Network,
+		},
+		{
+			Name:  "RCLONE_REMOTE",
+			Value: backup.Spec.Destination.Remote,
+		},
+		{
+			Name: "RSYNC_CONFIG",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: backup.Spec.Destination.RcloneConfig.DeepCopy(),
+			},
+		},
+	}
+
+	if backup.Spec.FileName != "" {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "BACKUP_FILE_NAME",
+			Value: backup.Spec.FileName,
+		})
+	}
+
+	return envVars
+}
+
+// GetWantedBackupJob returns the job compressing and uploading the database of the node
+func (r *StarknetRPCBackupReconciler) GetWantedBackupJob(backup *pathfinderv1alpha1.StarknetRPCBackup, rpc *pathfinderv1alpha1.StarknetRPC) batchv1.Job {
+	image := getImage(&rpc.Spec.RestoreArchive)
+	if backup.Spec.Image != nil {
+		image = *backup.Spec.Image
+	}
+
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:          getBackupLabels(backup),
+			Name:            fmt.Sprintf("%s-backup", backup.Name),
+			Namespace:       backup.Namespace,
+			OwnerReferences: []metav1.OwnerReference{getBackupOwnerReference(backup)},
+		},
+		Spec: batchv1.JobSpec{
+			// The node is stopped during the backup, a failed backup is not retried
+			BackoffLimit: &[]int32{0}[0],
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: getBackupLabels(backup),
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "snapshot-uploader",
+							Image:   image,
+							Command: []string{"/app/backup.sh"},
+							Env:     getBackupEnvVars(backup, rpc),
+							// The script writes its result (or the end of the logs on error) as the termination message
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "snapshot-scratch",
+									MountPath: "/scratch",
+								},
+								{
+									Name:      "data",
+									MountPath: "/data",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "data",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: getStoragePvcName(rpc).Name,
+								},
+							},
+						},
+						{
+							Name: "snapshot-scratch",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: fmt.Sprintf("%s-backup-scratch", backup.Name),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *StarknetRPCBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&pathfinderv1alpha1.StarknetRPCBackup{}).
+		Owns(&batchv1.Job{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
+		Named("starknetrpcbackup").
+		Complete(r)
+}
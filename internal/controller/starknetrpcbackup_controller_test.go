@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPCBackup Controller", func() {
+	Context("When reconciling a StarknetRPCBackup resource", func() {
+		const (
+			resourceName = "test-starknet-rpc-backup"
+			nodeName     = "test-starknet-rpc-backed-up"
+			namespace    = "default"
+			network      = "mainnet"
+		)
+
+		var (
+			ctx         context.Context
+			starknetRPC *v1alpha1.StarknetRPC
+			backup      *v1alpha1.StarknetRPCBackup
+			reconciler  *StarknetRPCBackupReconciler
+		)
+
+		reconcile := func() {
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{
+				NamespacedName: types.NamespacedName{Name: resourceName, Namespace: namespace},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(backup), backup)).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+		}
+
+		// finishJob simulates the end of the backup job, with the termination message of its pod
+		finishJob := func(succeeded bool, message string) {
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-backup", Namespace: namespace}, job)).To(Succeed())
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName + "-backup-pod",
+					Namespace: namespace,
+					Labels:    map[string]string{batchv1.JobNameLabel: job.Name},
+				},
+				Spec: *job.Spec.Template.Spec.DeepCopy(),
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			exitCode := int32(0)
+			if !succeeded {
+				exitCode = 1
+			}
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name: "snapshot-uploader",
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Message: message},
+				},
+			}}
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+
+			now := metav1.Now()
+			job.Status.StartTime = &now
+			if succeeded {
+				job.Status.Succeeded = 1
+			} else {
+				job.Status.Failed = 1
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(nodeName)
+			createTestStarknetRPC(ctx, starknetRPC)
+			starknetRPC.Status.Conditions = []metav1.Condition{}
+			starknetrpc.StarknetRPCRestoreStatusSkipped.Apply()(starknetRPC)
+			Expect(k8sClient.Status().Update(ctx, starknetRPC)).Should(Succeed())
+
+			backup = &v1alpha1.StarknetRPCBackup{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: namespace,
+				},
+				Spec: v1alpha1.StarknetRPCBackupSpec{
+					StarknetRPC: corev1.LocalObjectReference{Name: nodeName},
+					Destination: v1alpha1.BackupDestination{
+						RcloneConfig: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "rclone-config"},
+							Key:                  "rclone.conf",
+						},
+						Remote: "snapshots:bucket/mainnet",
+					},
+					Storage: v1alpha1.StorageTemplate{
+						Size: resource.MustParse("50Gi"),
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, backup)).Should(Succeed())
+
+			reconciler = &StarknetRPCBackupReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
+			}
+		})
+
+		AfterEach(func() {
+			deletePropagation := metav1.DeletePropagationBackground
+			_ = k8sClient.Delete(ctx, &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-backup", Namespace: namespace},
+			}, &client.DeleteOptions{PropagationPolicy: &deletePropagation})
+			_ = k8sClient.Delete(ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-backup-pod", Namespace: namespace},
+			})
+			_ = k8sClient.Delete(ctx, &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-backup-scratch", Namespace: namespace},
+			})
+			_ = k8sClient.Delete(ctx, backup)
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should quiesce the node and start the backup job", func() {
+			reconcile()
+
+			Expect(starknetRPC.Annotations).To(HaveKeyWithValue(QuiesceAnnotation, resourceName))
+			Expect(backup.Status.Phase).To(Equal(v1alpha1.StarknetRPCBackupPhaseRunning))
+			Expect(backup.Status.StartTime).NotTo(BeNil())
+			Expect(backup.Status.JobName).To(Equal(resourceName + "-backup"))
+
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-backup", Namespace: namespace}, job)).To(Succeed())
+			container := job.Spec.Template.Spec.Containers[0]
+			Expect(container.Command).To(Equal([]string{"/app/backup.sh"}))
+			Expect(container.Image).To(Equal("ghcr.io/runelabsxyz/pathfinder-snapshotter:latest"))
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "RCLONE_REMOTE", Value: "snapshots:bucket/mainnet"}))
+			Expect(job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal(nodeName + "-storage"))
+			Expect(job.OwnerReferences[0].Kind).To(Equal("StarknetRPCBackup"))
+
+			scratch := &corev1.PersistentVolumeClaim{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-backup-scratch", Namespace: namespace}, scratch)).To(Succeed())
+		})
+
+		It("Should wait for the node pod to be stopped", func() {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       fmt.Sprintf("%s-rpc", nodeName),
+					Namespace:  namespace,
+					Finalizers: []string{"test.runelabs.xyz/keep"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "pathfinder", Image: "eqlabs/pathfinder"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			defer func() {
+				pod.Finalizers = nil
+				_ = k8sClient.Update(ctx, pod)
+				_ = k8sClient.Delete(ctx, pod)
+			}()
+
+			reconcile()
+			Expect(backup.Status.Phase).To(Equal(v1alpha1.StarknetRPCBackupPhaseQuiescing))
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-backup", Namespace: namespace}, &batchv1.Job{})).NotTo(Succeed())
+		})
+
+		It("Should record the uploaded snapshot and release the node", func() {
+			reconcile()
+			finishJob(true, `{"fileName":"mainnet_1234.sqlite.zst","checksum":"abc","size":42,"blockHeight":1234}`)
+			reconcile()
+
+			Expect(backup.Status.Phase).To(Equal(v1alpha1.StarknetRPCBackupPhaseCompleted))
+			Expect(backup.Status.FileName).To(Equal("mainnet_1234.sqlite.zst"))
+			Expect(backup.Status.Checksum).To(Equal("abc"))
+			Expect(backup.Status.Size).To(Equal(int64(42)))
+			Expect(backup.Status.BlockHeight).To(Equal(int64(1234)))
+			Expect(backup.Status.CompletionTime).NotTo(BeNil())
+			Expect(starknetRPC.Annotations).NotTo(HaveKey(QuiesceAnnotation))
+		})
+
+		It("Should release the node when the backup fails", func() {
+			reconcile()
+			finishJob(false, "rclone: access denied")
+			reconcile()
+
+			Expect(backup.Status.Phase).To(Equal(v1alpha1.StarknetRPCBackupPhaseFailed))
+			Expect(backup.Status.Message).To(Equal("rclone: access denied"))
+			Expect(starknetRPC.Annotations).NotTo(HaveKey(QuiesceAnnotation))
+		})
+
+		It("Should wait for another backup holding the node", func() {
+			starknetRPC.Annotations = map[string]string{QuiesceAnnotation: "another-backup"}
+			Expect(k8sClient.Update(ctx, starknetRPC)).To(Succeed())
+
+			reconcile()
+			Expect(backup.Status.Phase).To(Equal(v1alpha1.StarknetRPCBackupPhasePending))
+			Expect(starknetRPC.Annotations).To(HaveKeyWithValue(QuiesceAnnotation, "another-backup"))
+		})
+	})
+
+	Context("When a StarknetRPC is quiesced by a backup", func() {
+		const (
+			resourceName = "test-starknet-rpc-quiesced"
+			namespace    = "default"
+		)
+
+		var (
+			ctx         context.Context
+			starknetRPC *v1alpha1.StarknetRPC
+			reconciler  *StarknetRPCReconciler
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			starknetRPC = newTestStarknetRPC(resourceName)
+			starknetRPC.Annotations = map[string]string{QuiesceAnnotation: "a-deleted-backup"}
+			createTestStarknetRPC(ctx, starknetRPC)
+
+			reconciler = &StarknetRPCReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
+			}
+		})
+
+		AfterEach(func() {
+			_ = k8sClient.Delete(ctx, starknetRPC)
+		})
+
+		It("Should release a node held by a backup that is gone", func() {
+			quiesced, err := reconciler.ReconcileQuiesce(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(quiesced).To(BeFalse())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			Expect(starknetRPC.Annotations).NotTo(HaveKey(QuiesceAnnotation))
+		})
+
+		It("Should stop the node while a backup is running", func() {
+			backup := &v1alpha1.StarknetRPCBackup{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "a-deleted-backup",
+					Namespace: namespace,
+				},
+				Spec: v1alpha1.StarknetRPCBackupSpec{
+					StarknetRPC: corev1.LocalObjectReference{Name: resourceName},
+					Destination: v1alpha1.BackupDestination{
+						RcloneConfig: corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "rclone-config"},
+							Key:                  "rclone.conf",
+						},
+						Remote: "snapshots:bucket/mainnet",
+					},
+					Storage: v1alpha1.StorageTemplate{
+						Size: resource.MustParse("50Gi"),
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, backup)).To(Succeed())
+			defer func() { _ = k8sClient.Delete(ctx, backup) }()
+
+			quiesced, err := reconciler.ReconcileQuiesce(ctx, starknetRPC)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(quiesced).To(BeTrue())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(starknetRPC), starknetRPC)).To(Succeed())
+			available := meta.FindStatusCondition(starknetRPC.Status.Conditions, "Available")
+			Expect(available).NotTo(BeNil())
+			Expect(available.Reason).To(Equal(string(starknetrpc.StarknetRPCAvailableStatusQuiesced)))
+		})
+	})
+})
@@ -0,0 +1,374 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	pathfinderv1alpha1 "github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	rpccondition "github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/reconciler"
+)
+
+// deploymentLabel is the label set on every StarknetRPC node managed by a StarknetRPCDeployment
+const deploymentLabel = "rpc.runelabs.xyz/deployment"
+
+// +kubebuilder:rbac:groups=pathfinder.runelabs.xyz,resources=starknetrpcdeployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=pathfinder.runelabs.xyz,resources=starknetrpcdeployments/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=pathfinder.runelabs.xyz,resources=starknetrpcdeployments/finalizers,verbs=update
+
+// StarknetRPCDeploymentReconciler reconciles a StarknetRPCDeployment object
+type StarknetRPCDeploymentReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// Reconcile makes sure that the deployment owns exactly `replicas` StarknetRPC nodes
+// matching its template, and aggregates their status.
+//
+// Nodes are updated one at a time: a node is only updated when every other node
+// is available, so that a template change never takes down more than one node.
+func (r *StarknetRPCDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	deployment := &pathfinderv1alpha1.StarknetRPCDeployment{}
+	if err := r.Get(ctx, req.NamespacedName, deployment); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	logger.V(1).Info("Reconciling StarknetRPCDeployment", "name", deployment.Name)
+
+	nodes, err := r.listNodes(ctx, deployment)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	replicas := getDeploymentReplicas(deployment)
+
+	// 1. Delete the nodes that are out of range (scale down)
+	existing := make(map[int]*pathfinderv1alpha1.StarknetRPC, len(nodes))
+	for i := range nodes {
+		node := &nodes[i]
+		ordinal, ok := getNodeOrdinal(deployment, node)
+		if ok && ordinal < int(replicas) {
+			existing[ordinal] = node
+			continue
+		}
+
+		if node.DeletionTimestamp != nil {
+			continue
+		}
+		logger.Info("Deleting StarknetRPC node", "node", node.Name)
+		if err := r.Delete(ctx, node); client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		r.Recorder.Event(deployment, "Normal", "NodeDeleted",
+			fmt.Sprintf("StarknetRPC %s deleted while scaling down", node.Name))
+	}
+
+	// 2. Create the missing nodes (scale up)
+	for ordinal := range int(replicas) {
+		if _, ok := existing[ordinal]; ok {
+			continue
+		}
+
+		node := r.GetWantedNode(deployment, ordinal)
+		created, err := reconciler.CreateOrReconcile(ctx, r.Client, &node)
+		if err != nil {
+			return ctrl.Result{}, err
+		} else if created {
+			r.Recorder.Event(deployment, "Normal", "NodeCreated",
+				fmt.Sprintf("StarknetRPC %s created", node.Name))
+		}
+		existing[ordinal] = &node
+	}
+
+	// 3. Roll the template to the existing nodes, one node at a time
+	if err := r.rollNodes(ctx, deployment, existing); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// 4. Aggregate the status of the nodes
+	if err := r.updateStatus(ctx, deployment, existing); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// rollNodes updates the nodes whose spec differs from the template.
+//
+// A node that is already unavailable can always be updated, as it does not reduce
+// the availability of the deployment. Otherwise, at most one available node is
+// updated per loop, and only if every other node is available.
+func (r *StarknetRPCDeploymentReconciler) rollNodes(ctx context.Context, deployment *pathfinderv1alpha1.StarknetRPCDeployment, nodes map[int]*pathfinderv1alpha1.StarknetRPC) error {
+	logger := log.FromContext(ctx)
+
+	unavailable := 0
+	for _, node := range nodes {
+		if !isNodeSynced(node) {
+			unavailable++
+		}
+	}
+
+	// The ordinals may have gaps, e.g. when a node was deleted by hand
+	for _, ordinal := range slices.Sorted(maps.Keys(nodes)) {
+		node := nodes[ordinal]
+		if isNodeUpToDate(deployment, node) {
+			continue
+		}
+
+		synced := isNodeSynced(node)
+		if synced && unavailable > 0 {
+			logger.V(1).Info("Waiting for the other nodes to be available before updating", "node", node.Name)
+			continue
+		}
+
+		logger.Info("Updating StarknetRPC node to the latest template", "node", node.Name)
+		original := node.DeepCopy()
+		if err := NodeTemplateReconciler(deployment).Update(node); err != nil {
+			return err
+		}
+		if err := r.Patch(ctx, node, client.MergeFrom(original)); err != nil {
+			return err
+		}
+		r.Recorder.Event(deployment, "Normal", "NodeUpdated",
+			fmt.Sprintf("StarknetRPC %s updated to the latest template", node.Name))
+
+		if synced {
+			// The node is going to be unavailable while it restarts
+			unavailable++
+		}
+	}
+
+	return nil
+}
+
+func (r *StarknetRPCDeploymentReconciler) updateStatus(ctx context.Context, deployment *pathfinderv1alpha1.StarknetRPCDeployment, nodes map[int]*pathfinderv1alpha1.StarknetRPC) error {
+	status := pathfinderv1alpha1.StarknetRPCDeploymentStatus{
+		Replicas:           int32(len(nodes)),
+		Selector:           labels.SelectorFromSet(getDeploymentSelector(deployment)).String(),
+		ObservedGeneration: deployment.Generation,
+		Conditions:         slices.Clone(deployment.Status.Conditions),
+	}
+
+	for _, node := range nodes {
+		if isNodeUpToDate(deployment, node) {
+			status.UpdatedReplicas++
+		}
+		if isNodeReady(node) {
+			status.ReadyReplicas++
+		}
+		if isNodeSynced(node) {
+			status.SyncedReplicas++
+		}
+	}
+
+	if status.SyncedReplicas > 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    string(rpccondition.StarknetRPCAvailableCondition),
+			Status:  metav1.ConditionTrue,
+			Reason:  "NodesSynced",
+			Message: fmt.Sprintf("%d out of %d nodes are synced", status.SyncedReplicas, getDeploymentReplicas(deployment)),
+		})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    string(rpccondition.StarknetRPCAvailableCondition),
+			Status:  metav1.ConditionFalse,
+			Reason:  "NoNodeSynced",
+			Message: "None of the nodes are synced",
+		})
+	}
+
+	if equality.Semantic.DeepEqual(deployment.Status, status) {
+		return nil
+	}
+
+	deployment.Status = status
+	return r.Status().Update(ctx, deployment)
+}
+
+func (r *StarknetRPCDeploymentReconciler) listNodes(ctx context.Context, deployment *pathfinderv1alpha1.StarknetRPCDeployment) ([]pathfinderv1alpha1.StarknetRPC, error) {
+	var list pathfinderv1alpha1.StarknetRPCList
+	err := r.List(ctx, &list,
+		client.InNamespace(deployment.Namespace),
+		client.MatchingLabels(getDeploymentSelector(deployment)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only keep the nodes we actually own
+	nodes := make([]pathfinderv1alpha1.StarknetRPC, 0, len(list.Items))
+	for _, node := range list.Items {
+		if owner := metav1.GetControllerOf(&node); owner != nil && owner.UID == deployment.UID {
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes, nil
+}
+
+// NodeTemplateReconciler ensures the StarknetRPC node matches the deployment template
+func NodeTemplateReconciler(deployment *pathfinderv1alpha1.StarknetRPCDeployment) reconciler.ObjectReconcilier[*pathfinderv1alpha1.StarknetRPC] {
+	return reconciler.ObjectReconcilier[*pathfinderv1alpha1.StarknetRPC]{
+		Name: "NodeTemplateReconciler",
+		IsUpToDate: func(node *pathfinderv1alpha1.StarknetRPC) bool {
+			return isNodeUpToDate(deployment, node)
+		},
+		Update: func(node *pathfinderv1alpha1.StarknetRPC) error {
+			node.Spec = *deployment.Spec.Template.Spec.DeepCopy()
+			if node.Labels == nil {
+				node.Labels = make(map[string]string)
+			}
+			maps.Copy(node.Labels, getNodeLabels(deployment))
+			if node.Annotations == nil {
+				node.Annotations = make(map[string]string)
+			}
+			maps.Copy(node.Annotations, deployment.Spec.Template.Metadata.Annotations)
+			return nil
+		},
+	}
+}
+
+func isNodeUpToDate(deployment *pathfinderv1alpha1.StarknetRPCDeployment, node *pathfinderv1alpha1.StarknetRPC) bool {
+	if !equality.Semantic.DeepEqual(node.Spec, deployment.Spec.Template.Spec) {
+		return false
+	}
+	for k, v := range getNodeLabels(deployment) {
+		if node.Labels[k] != v {
+			return false
+		}
+	}
+	for k, v := range deployment.Spec.Template.Metadata.Annotations {
+		if node.Annotations[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// isNodeReady returns true if the node answers requests, even if it is still catching up
+func isNodeReady(node *pathfinderv1alpha1.StarknetRPC) bool {
+	available := meta.FindStatusCondition(node.Status.Conditions, string(rpccondition.StarknetRPCAvailableCondition))
+	if available == nil {
+		return false
+	}
+	return available.Reason == string(rpccondition.StarknetRPCAvailableStatusCatchingUp) ||
+		available.Reason == string(rpccondition.StarknetRPCAvailableStatusReady)
+}
+
+// isNodeSynced returns true if the node is fully synced, and its latest spec has been reconciled
+func isNodeSynced(node *pathfinderv1alpha1.StarknetRPC) bool {
+	return node.Status.ObservedGeneration == node.Generation &&
+		meta.IsStatusConditionTrue(node.Status.Conditions, string(rpccondition.StarknetRPCAvailableCondition))
+}
+
+func getDeploymentReplicas(deployment *pathfinderv1alpha1.StarknetRPCDeployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return 1
+	}
+	return *deployment.Spec.Replicas
+}
+
+func getDeploymentSelector(deployment *pathfinderv1alpha1.StarknetRPCDeployment) map[string]string {
+	return map[string]string{
+		deploymentLabel: deployment.Name,
+	}
+}
+
+func getNodeLabels(deployment *pathfinderv1alpha1.StarknetRPCDeployment) map[string]string {
+	nodeLabels := make(map[string]string)
+	maps.Copy(nodeLabels, deployment.Spec.Template.Metadata.Labels)
+	maps.Copy(nodeLabels, getDeploymentSelector(deployment))
+	return nodeLabels
+}
+
+// getNodeOrdinal returns the ordinal of the node, parsed from its name
+func getNodeOrdinal(deployment *pathfinderv1alpha1.StarknetRPCDeployment, node *pathfinderv1alpha1.StarknetRPC) (int, bool) {
+	suffix, found := strings.CutPrefix(node.Name, deployment.Name+"-")
+	if !found {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(suffix)
+	if err != nil || ordinal < 0 {
+		return 0, false
+	}
+	return ordinal, true
+}
+
+func (r *StarknetRPCDeploymentReconciler) GetNodeName(deployment *pathfinderv1alpha1.StarknetRPCDeployment, ordinal int) types.NamespacedName {
+	return types.NamespacedName{
+		Name:      fmt.Sprintf("%s-%d", deployment.Name, ordinal),
+		Namespace: deployment.Namespace,
+	}
+}
+
+// GetWantedNode returns the desired StarknetRPC node for the given ordinal
+func (r *StarknetRPCDeploymentReconciler) GetWantedNode(deployment *pathfinderv1alpha1.StarknetRPCDeployment, ordinal int) pathfinderv1alpha1.StarknetRPC {
+	nameInfo := r.GetNodeName(deployment, ordinal)
+	annotations := make(map[string]string)
+	maps.Copy(annotations, deployment.Spec.Template.Metadata.Annotations)
+
+	node := pathfinderv1alpha1.StarknetRPC{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      getNodeLabels(deployment),
+			Annotations: annotations,
+			Name:        nameInfo.Name,
+			Namespace:   nameInfo.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion:         pathfinderv1alpha1.GroupVersion.String(),
+					Kind:               "StarknetRPCDeployment",
+					Name:               deployment.Name,
+					UID:                deployment.UID,
+					Controller:         &[]bool{true}[0],
+					BlockOwnerDeletion: &[]bool{true}[0],
+				},
+			},
+		},
+		Spec: *deployment.Spec.Template.Spec.DeepCopy(),
+	}
+
+	return node
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *StarknetRPCDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&pathfinderv1alpha1.StarknetRPCDeployment{}).
+		Owns(&pathfinderv1alpha1.StarknetRPC{}).
+		Named("starknetrpcdeployment").
+		Complete(r)
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition/starknetrpc"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPCDeployment Controller", func() {
+	Context("When reconciling a StarknetRPCDeployment resource", func() {
+		const (
+			resourceName = "test-starknet-rpc-deployment"
+			namespace    = "default"
+			network      = "mainnet"
+		)
+
+		var (
+			ctx        context.Context
+			deployment *v1alpha1.StarknetRPCDeployment
+			reconciler *StarknetRPCDeploymentReconciler
+		)
+
+		nodeName := func(ordinal int) types.NamespacedName {
+			return types.NamespacedName{
+				Name:      fmt.Sprintf("%s-%d", resourceName, ordinal),
+				Namespace: namespace,
+			}
+		}
+
+		reconcile := func() {
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{
+				NamespacedName: types.NamespacedName{Name: resourceName, Namespace: namespace},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			deployment = &v1alpha1.StarknetRPCDeployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: namespace,
+				},
+				Spec: v1alpha1.StarknetRPCDeploymentSpec{
+					Replicas: &[]int32{2}[0],
+					Template: v1alpha1.StarknetRPCTemplateSpec{
+						Metadata: v1alpha1.StarknetRPCTemplateMetadata{
+							Labels: map[string]string{"team": "platform"},
+						},
+						Spec: newTestStarknetRPC(resourceName).Spec,
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, deployment)).Should(Succeed())
+
+			reconciler = &StarknetRPCDeploymentReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
+			}
+		})
+
+		AfterEach(func() {
+			// Clean up resources (there is no garbage collector in envtest)
+			_ = k8sClient.DeleteAllOf(ctx, &v1alpha1.StarknetRPC{},
+				client.InNamespace(namespace),
+				client.MatchingLabels{deploymentLabel: resourceName},
+			)
+			_ = k8sClient.Delete(ctx, deployment)
+		})
+
+		It("Should create one StarknetRPC per replica", func() {
+			reconcile()
+
+			for ordinal := range 2 {
+				node := &v1alpha1.StarknetRPC{}
+				Expect(k8sClient.Get(ctx, nodeName(ordinal), node)).To(Succeed())
+
+				Expect(node.Spec.Network).To(Equal(network))
+				Expect(node.Labels).To(HaveKeyWithValue(deploymentLabel, resourceName))
+				Expect(node.Labels).To(HaveKeyWithValue("team", "platform"))
+				Expect(node.OwnerReferences).To(HaveLen(1))
+				Expect(node.OwnerReferences[0].Kind).To(Equal("StarknetRPCDeployment"))
+				Expect(node.OwnerReferences[0].UID).To(Equal(deployment.UID))
+			}
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), deployment)).To(Succeed())
+			Expect(deployment.Status.Replicas).To(Equal(int32(2)))
+			Expect(deployment.Status.UpdatedReplicas).To(Equal(int32(2)))
+			Expect(deployment.Status.SyncedReplicas).To(Equal(int32(0)))
+			Expect(deployment.Status.Selector).To(Equal(fmt.Sprintf("%s=%s", deploymentLabel, resourceName)))
+		})
+
+		It("Should delete the highest ordinals when scaling down", func() {
+			reconcile()
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), deployment)).To(Succeed())
+			deployment.Spec.Replicas = &[]int32{1}[0]
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+
+			reconcile()
+
+			Expect(k8sClient.Get(ctx, nodeName(0), &v1alpha1.StarknetRPC{})).To(Succeed())
+			err := k8sClient.Get(ctx, nodeName(1), &v1alpha1.StarknetRPC{})
+			Expect(err).To(HaveOccurred())
+			Expect(client.IgnoreNotFound(err)).To(Succeed())
+		})
+
+		It("Should aggregate the Available condition of the nodes", func() {
+			reconcile()
+
+			// Mark the first node as fully synced
+			node := &v1alpha1.StarknetRPC{}
+			Expect(k8sClient.Get(ctx, nodeName(0), node)).To(Succeed())
+			starknetrpc.StarknetRPCAvailableStatusReady.Apply()(node)
+			node.Status.ObservedGeneration = node.Generation
+			Expect(k8sClient.Status().Update(ctx, node)).To(Succeed())
+
+			// And the second one as catching up
+			Expect(k8sClient.Get(ctx, nodeName(1), node)).To(Succeed())
+			starknetrpc.StarknetRPCAvailableStatusCatchingUp.Apply()(node)
+			node.Status.ObservedGeneration = node.Generation
+			Expect(k8sClient.Status().Update(ctx, node)).To(Succeed())
+
+			reconcile()
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), deployment)).To(Succeed())
+			Expect(deployment.Status.ReadyReplicas).To(Equal(int32(2)))
+			Expect(deployment.Status.SyncedReplicas).To(Equal(int32(1)))
+			Expect(meta.IsStatusConditionTrue(deployment.Status.Conditions, "Available")).To(BeTrue())
+		})
+
+		It("Should not update a synced node while another node is unavailable", func() {
+			reconcile()
+
+			// Only the first node is synced
+			node := &v1alpha1.StarknetRPC{}
+			Expect(k8sClient.Get(ctx, nodeName(0), node)).To(Succeed())
+			starknetrpc.StarknetRPCAvailableStatusReady.Apply()(node)
+			node.Status.ObservedGeneration = node.Generation
+			Expect(k8sClient.Status().Update(ctx, node)).To(Succeed())
+
+			// Change the template
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), deployment)).To(Succeed())
+			deployment.Spec.Template.Spec.Image = &[]string{"eqlabs/pathfinder:v0.21.0"}[0]
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+
+			reconcile()
+
+			// The unavailable node got updated, but not the synced one
+			Expect(k8sClient.Get(ctx, nodeName(0), node)).To(Succeed())
+			Expect(node.Spec.Image).To(BeNil())
+			Expect(k8sClient.Get(ctx, nodeName(1), node)).To(Succeed())
+			Expect(node.Spec.Image).NotTo(BeNil())
+			Expect(*node.Spec.Image).To(Equal("eqlabs/pathfinder:v0.21.0"))
+		})
+
+		It("Should roll the template to the nodes whose ordinals have gaps", func() {
+			deployment.Spec.Replicas = &[]int32{3}[0]
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+			reconcile()
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), deployment)).To(Succeed())
+			deployment.Spec.Template.Spec.Image = &[]string{"eqlabs/pathfinder:v0.21.0"}[0]
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+
+			// Only nodes 0 and 2, none of them synced
+			nodes := map[int]*v1alpha1.StarknetRPC{}
+			for _, ordinal := range []int{0, 2} {
+				node := &v1alpha1.StarknetRPC{}
+				Expect(k8sClient.Get(ctx, nodeName(ordinal), node)).To(Succeed())
+				nodes[ordinal] = node
+			}
+			Expect(reconciler.rollNodes(ctx, deployment, nodes)).To(Succeed())
+
+			for _, ordinal := range []int{0, 2} {
+				node := &v1alpha1.StarknetRPC{}
+				Expect(k8sClient.Get(ctx, nodeName(ordinal), node)).To(Succeed())
+				Expect(node.Spec.Image).NotTo(BeNil())
+				Expect(*node.Spec.Image).To(Equal("eqlabs/pathfinder:v0.21.0"))
+			}
+		})
+	})
+})
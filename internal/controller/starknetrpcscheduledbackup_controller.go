@@ -0,0 +1,427 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	pathfinderv1alpha1 "github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+)
+
+const (
+	// scheduledBackupLabel is set on the backups created by a StarknetRPCScheduledBackup
+	scheduledBackupLabel = "rpc.runelabs.xyz/scheduled-backup"
+	// maxMissedSchedules bounds the number of schedules looked at when catching up
+	maxMissedSchedules = 1000
+	// pruneRetryInterval is how long a failed prune job is kept, before the snapshot deletion is retried
+	pruneRetryInterval = 5 * time.Minute
+)
+
+// +kubebuilder:rbac:groups=pathfinder.runelabs.xyz,resources=starknetrpcscheduledbackups,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=pathfinder.runelabs.xyz,resources=starknetrpcscheduledbackups/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=pathfinder.runelabs.xyz,resources=starknetrpcscheduledbackups/finalizers,verbs=update
+
+// StarknetRPCScheduledBackupReconciler reconciles a StarknetRPCScheduledBackup object
+type StarknetRPCScheduledBackupReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// now returns the current time, overridden in tests
+	now func() time.Time
+}
+
+// Reconcile creates a StarknetRPCBackup on every schedule, and prunes the backups (and their
+// snapshot file on the destination) that are not kept by the retention policy.
+//
+// A new backup is never created while the previous one is still running: the schedule is skipped.
+func (r *StarknetRPCScheduledBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	scheduled := &pathfinderv1alpha1.StarknetRPCScheduledBackup{}
+	if err := r.Get(ctx, req.NamespacedName, scheduled); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	logger.V(1).Info("Reconciling StarknetRPCScheduledBackup", "name", scheduled.Name)
+
+	schedule, err := cron.ParseStandard(scheduled.Spec.Schedule)
+	if err != nil {
+		r.Recorder.Event(scheduled, "Warning", "InvalidSchedule", err.Error())
+		// Wait for the schedule to be fixed
+		return ctrl.Result{}, nil
+	}
+
+	backups := &pathfinderv1alpha1.StarknetRPCBackupList{}
+	err = r.List(ctx, backups, client.InNamespace(scheduled.Namespace), client.MatchingLabels{scheduledBackupLabel: scheduled.Name})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	status := scheduled.Status.DeepCopy()
+	updateScheduledBackupStatus(status, backups.Items)
+
+	// 1. Prune the old backups
+	pruneRetry, err := r.pruneBackups(ctx, scheduled, backups.Items)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// 2. Create the backup of the latest missed schedule
+	now := r.getNow()
+	missed, next := getMissedSchedule(schedule, scheduled, now)
+	if missed != nil && (scheduled.Spec.Suspend == nil || !*scheduled.Spec.Suspend) {
+		if status.Active != "" {
+			logger.Info("Previous backup still running, skipping the schedule", "active", status.Active)
+			r.Recorder.Event(scheduled, "Normal", "BackupSkipped",
+				fmt.Sprintf("Backup %s is still running", status.Active))
+		} else {
+			backup := r.GetWantedBackup(scheduled, *missed)
+			if err := r.Create(ctx, &backup); err != nil && !apierrs.IsAlreadyExists(err) {
+				return ctrl.Result{}, err
+			}
+			logger.Info("Created scheduled backup", "backup", backup.Name)
+			r.Recorder.Event(scheduled, "Normal", "BackupCreated", fmt.Sprintf("Backup %s created", backup.Name))
+			status.Active = backup.Name
+		}
+	}
+	if missed != nil {
+		status.LastScheduleTime = &metav1.Time{Time: *missed}
+	}
+	status.NextScheduleTime = &metav1.Time{Time: next}
+
+	if !equality.Semantic.DeepEqual(status, &scheduled.Status) {
+		scheduled.Status = *status
+		if err := r.Status().Update(ctx, scheduled); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	requeueAfter := next.Sub(now)
+	if pruneRetry > 0 {
+		requeueAfter = min(requeueAfter, pruneRetry)
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// getMissedSchedule returns the latest schedule time that has not been run yet (if any), and the next one
+func getMissedSchedule(schedule cron.Schedule, scheduled *pathfinderv1alpha1.StarknetRPCScheduledBackup, now time.Time) (*time.Time, time.Time) {
+	start := scheduled.CreationTimestamp.Time
+	if scheduled.Status.LastScheduleTime != nil {
+		start = scheduled.Status.LastScheduleTime.Time
+	}
+
+	var missed *time.Time
+	next := schedule.Next(start.UTC())
+	for range maxMissedSchedules {
+		if next.After(now) {
+			break
+		}
+		at := next
+		missed = &at
+		next = schedule.Next(next)
+	}
+	return missed, next
+}
+
+// updateScheduledBackupStatus records the running and the latest completed backups
+func updateScheduledBackupStatus(status *pathfinderv1alpha1.StarknetRPCScheduledBackupStatus, backups []pathfinderv1alpha1.StarknetRPCBackup) {
+	status.Active = ""
+	var latest *pathfinderv1alpha1.StarknetRPCBackup
+	for i := range backups {
+		backup := &backups[i]
+		if !isBackupFinished(backup) {
+			status.Active = backup.Name
+			continue
+		}
+		if backup.Status.Phase != pathfinderv1alpha1.StarknetRPCBackupPhaseCompleted || backup.Status.CompletionTime == nil {
+			continue
+		}
+		if latest == nil || backup.Status.CompletionTime.After(latest.Status.CompletionTime.Time) {
+			latest = backup
+		}
+	}
+
+	if latest != nil {
+		status.LastSuccessfulBackup = latest.Name
+		status.LastSuccessfulTime = latest.Status.CompletionTime.DeepCopy()
+		status.LastSuccessfulBlockHeight = latest.Status.BlockHeight
+	}
+}
+
+// pruneBackups deletes the backups that are not kept by the retention policy. The snapshot file
+// of a completed backup is deleted from the destination first, by a prune job.
+//
+// A failed prune job is re-created once pruneRetryInterval elapsed: the returned duration is how long
+// to wait before the next retry, if any.
+func (r *StarknetRPCScheduledBackupReconciler) pruneBackups(ctx context.Context, scheduled *pathfinderv1alpha1.StarknetRPCScheduledBackup, backups []pathfinderv1alpha1.StarknetRPCBackup) (time.Duration, error) {
+	logger := log.FromContext(ctx)
+	var retry time.Duration
+
+	for _, backup := range selectBackupsToPrune(backups, scheduled.Spec.Retention) {
+		if backup.DeletionTimestamp != nil {
+			continue
+		}
+
+		if backup.Status.Phase == pathfinderv1alpha1.StarknetRPCBackupPhaseCompleted && backup.Status.FileName != "" {
+			job := r.GetWantedPruneJob(scheduled, backup)
+			err := r.Create(ctx, &job)
+			if err == nil {
+				logger.Info("Deleting the snapshot of an old backup", "backup", backup.Name, "fileName", backup.Status.FileName)
+				continue
+			} else if !apierrs.IsAlreadyExists(err) {
+				return 0, err
+			}
+
+			if err := r.Get(ctx, client.ObjectKeyFromObject(&job), &job); err != nil {
+				return 0, err
+			}
+
+			// The job retries by itself, until it failed for good
+			deletePropagation := metav1.DeletePropagationBackground
+			if failed := getJobFailedCondition(&job); failed != nil {
+				wait := pruneRetryInterval - r.getNow().Sub(failed.LastTransitionTime.Time)
+				if wait > 0 {
+					logger.V(1).Info("Waiting before retrying the prune job", "job", job.Name, "wait", wait)
+					if retry == 0 || wait < retry {
+						retry = wait
+					}
+					continue
+				}
+
+				// Deleting the job starts a new one
+				reason := getJobFailureReason(ctx, r.Client, &job)
+				logger.Info("Prune job failed, retrying", "job", job.Name, "reason", reason)
+				r.Recorder.Event(scheduled, "Warning", "PruneFailed",
+					fmt.Sprintf("Failed to delete snapshot %s, retrying: %s", backup.Status.FileName, reason))
+				if err := r.Delete(ctx, &job, &client.DeleteOptions{PropagationPolicy: &deletePropagation}); client.IgnoreNotFound(err) != nil {
+					return 0, err
+				}
+				continue
+			} else if job.Status.Succeeded == 0 {
+				continue
+			}
+
+			if err := r.Delete(ctx, &job, &client.DeleteOptions{PropagationPolicy: &deletePropagation}); client.IgnoreNotFound(err) != nil {
+				return 0, err
+			}
+		}
+
+		logger.Info("Deleting old backup", "backup", backup.Name)
+		if err := r.Delete(ctx, backup); client.IgnoreNotFound(err) != nil {
+			return 0, err
+		}
+		r.Recorder.Event(scheduled, "Normal", "BackupPruned", fmt.Sprintf("Backup %s deleted", backup.Name))
+	}
+
+	return retry, nil
+}
+
+// selectBackupsToPrune returns the finished backups that are not kept by the retention policy.
+//
+// Failed backups are pruned once a more recent backup completed. Without a policy, nothing is pruned.
+func selectBackupsToPrune(backups []pathfinderv1alpha1.StarknetRPCBackup, retention *pathfinderv1alpha1.BackupRetentionPolicy) []*pathfinderv1alpha1.StarknetRPCBackup {
+	if retention == nil {
+		return nil
+	}
+
+	var completed []*pathfinderv1alpha1.StarknetRPCBackup
+	for i := range backups {
+		if backups[i].Status.Phase == pathfinderv1alpha1.StarknetRPCBackupPhaseCompleted && backups[i].Status.CompletionTime != nil {
+			completed = append(completed, &backups[i])
+		}
+	}
+	// Most recent first
+	slices.SortFunc(completed, func(a, b *pathfinderv1alpha1.StarknetRPCBackup) int {
+		return b.Status.CompletionTime.Compare(a.Status.CompletionTime.Time)
+	})
+
+	keep := make(map[string]bool)
+	keepPeriods := func(count *int32, period func(time.Time) string) {
+		if count == nil {
+			return
+		}
+		seen := make(map[string]bool)
+		for _, backup := range completed {
+			if len(seen) >= int(*count) {
+				return
+			}
+			key := period(backup.Status.CompletionTime.UTC())
+			if !seen[key] {
+				seen[key] = true
+				keep[backup.Name] = true
+			}
+		}
+	}
+
+	if retention.KeepLast != nil {
+		for i, backup := range completed {
+			if i >= int(*retention.KeepLast) {
+				break
+			}
+			keep[backup.Name] = true
+		}
+	}
+	keepPeriods(retention.KeepDaily, func(t time.Time) string {
+		return t.Format(time.DateOnly)
+	})
+	keepPeriods(retention.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+
+	var prune []*pathfinderv1alpha1.StarknetRPCBackup
+	for _, backup := range completed {
+		if !keep[backup.Name] {
+			prune = append(prune, backup)
+		}
+	}
+
+	if len(completed) > 0 {
+		latest := completed[0].Status.CompletionTime
+		for i := range backups {
+			backup := &backups[i]
+			if backup.Status.Phase == pathfinderv1alpha1.StarknetRPCBackupPhaseFailed &&
+				backup.Status.CompletionTime != nil && backup.Status.CompletionTime.Before(latest) {
+				prune = append(prune, backup)
+			}
+		}
+	}
+
+	return prune
+}
+
+// GetWantedBackup returns the backup created for the schedule at the given time
+func (r *StarknetRPCScheduledBackupReconciler) GetWantedBackup(scheduled *pathfinderv1alpha1.StarknetRPCScheduledBackup, at time.Time) pathfinderv1alpha1.StarknetRPCBackup {
+	spec := *scheduled.Spec.Template.DeepCopy()
+	// Every backup gets its own file, named after its block
+	spec.FileName = ""
+
+	return pathfinderv1alpha1.StarknetRPCBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", scheduled.Name, at.Unix()),
+			Namespace: scheduled.Namespace,
+			Labels: map[string]string{
+				scheduledBackupLabel:    scheduled.Name,
+				"rpc.runelabs.xyz/name": spec.StarknetRPC.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{getScheduledBackupOwnerReference(scheduled)},
+		},
+		Spec: spec,
+	}
+}
+
+// GetWantedPruneJob returns the job deleting the snapshot file of a backup from its destination
+func (r *StarknetRPCScheduledBackupReconciler) GetWantedPruneJob(scheduled *pathfinderv1alpha1.StarknetRPCScheduledBackup, backup *pathfinderv1alpha1.StarknetRPCBackup) batchv1.Job {
+	image := defaultSnapshotterImage
+	if backup.Spec.Image != nil {
+		image = *backup.Spec.Image
+	}
+
+	labels := map[string]string{
+		scheduledBackupLabel:      scheduled.Name,
+		"rpc.runelabs.xyz/backup": backup.Name,
+	}
+
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:    labels,
+			Name:      fmt.Sprintf("%s-prune", backup.Name),
+			Namespace: scheduled.Namespace,
+			// Owned by the scheduled backup, as the backup is deleted once the job succeeded
+			OwnerReferences: []metav1.OwnerReference{getScheduledBackupOwnerReference(scheduled)},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &[]int32{2}[0],
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "snapshot-pruner",
+							Image:   image,
+							Command: []string{"/app/prune.sh"},
+							Env: []corev1.EnvVar{
+								{
+									Name:  "RCLONE_REMOTE",
+									Value: backup.Spec.Destination.Remote,
+								},
+								{
+									Name:  "BACKUP_FILE_NAME",
+									Value: backup.Status.FileName,
+								},
+								{
+									Name: "RSYNC_CONFIG",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: backup.Spec.Destination.RcloneConfig.DeepCopy(),
+									},
+								},
+							},
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func getScheduledBackupOwnerReference(scheduled *pathfinderv1alpha1.StarknetRPCScheduledBackup) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion:         pathfinderv1alpha1.GroupVersion.String(),
+		Kind:               "StarknetRPCScheduledBackup",
+		Name:               scheduled.Name,
+		UID:                scheduled.UID,
+		Controller:         &[]bool{true}[0],
+		BlockOwnerDeletion: &[]bool{true}[0],
+	}
+}
+
+func (r *StarknetRPCScheduledBackupReconciler) getNow() time.Time {
+	if r.now == nil {
+		return time.Now()
+	}
+	return r.now()
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *StarknetRPCScheduledBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&pathfinderv1alpha1.StarknetRPCScheduledBackup{}).
+		Owns(&pathfinderv1alpha1.StarknetRPCBackup{}).
+		Owns(&batchv1.Job{}).
+		Named("starknetrpcscheduledbackup").
+		Complete(r)
+}
@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("StarknetRPCScheduledBackup Controller", func() {
+	Context("When reconciling a StarknetRPCScheduledBackup resource", func() {
+		const (
+			resourceName = "test-starknet-rpc-scheduled-backup"
+			namespace    = "default"
+		)
+
+		var (
+			ctx        context.Context
+			scheduled  *v1alpha1.StarknetRPCScheduledBackup
+			reconciler *StarknetRPCScheduledBackupReconciler
+			now        time.Time
+		)
+
+		reconcile := func() ctrl.Result {
+			result, err := reconciler.Reconcile(ctx, ctrl.Request{
+				NamespacedName: types.NamespacedName{Name: resourceName, Namespace: namespace},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(scheduled), scheduled)).To(Succeed())
+			return result
+		}
+
+		listBackups := func() []v1alpha1.StarknetRPCBackup {
+			backups := &v1alpha1.StarknetRPCBackupList{}
+			Expect(k8sClient.List(ctx, backups, client.InNamespace(namespace),
+				client.MatchingLabels{scheduledBackupLabel: resourceName})).To(Succeed())
+			return backups.Items
+		}
+
+		// createBackup creates a backup of the schedule, finished with the given phase
+		createBackup := func(name string, phase v1alpha1.StarknetRPCBackupPhase, completion time.Time) *v1alpha1.StarknetRPCBackup {
+			backup := reconciler.GetWantedBackup(scheduled, completion)
+			backup.Name = name
+			Expect(k8sClient.Create(ctx, &backup)).To(Succeed())
+			backup.Status.Phase = phase
+			if phase == v1alpha1.StarknetRPCBackupPhaseCompleted || phase == v1alpha1.StarknetRPCBackupPhaseFailed {
+				backup.Status.CompletionTime = &metav1.Time{Time: completion}
+			}
+			if phase == v1alpha1.StarknetRPCBackupPhaseCompleted {
+				backup.Status.FileName = fmt.Sprintf("mainnet_%d.sqlite.zst", completion.Unix())
+			}
+			Expect(k8sClient.Status().Update(ctx, &backup)).To(Succeed())
+			return &backup
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			scheduled = &v1alpha1.StarknetRPCScheduledBackup{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: namespace,
+				},
+				Spec: v1alpha1.StarknetRPCScheduledBackupSpec{
+					Schedule: "0 3 * * *",
+					Template: v1alpha1.StarknetRPCBackupSpec{
+						StarknetRPC: corev1.LocalObjectReference{Name: "test-starknet-rpc-scheduled"},
+						Destination: v1alpha1.BackupDestination{
+							RcloneConfig: corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "rclone-config"},
+								Key:                  "rclone.conf",
+							},
+							Remote: "snapshots:bucket/mainnet",
+						},
+						FileName: "overwritten.sqlite.zst",
+						Storage: v1alpha1.StorageTemplate{
+							Size: resource.MustParse("50Gi"),
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, scheduled)).Should(Succeed())
+
+			// A day after the creation of the schedule
+			now = scheduled.CreationTimestamp.Add(25 * time.Hour)
+			reconciler = &StarknetRPCScheduledBackupReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
+				now:      func() time.Time { return now },
+			}
+		})
+
+		AfterEach(func() {
+			deletePropagation := metav1.DeletePropagationBackground
+			_ = k8sClient.DeleteAllOf(ctx, &batchv1.Job{}, client.InNamespace(namespace),
+				client.MatchingLabels{scheduledBackupLabel: resourceName},
+				client.PropagationPolicy(deletePropagation))
+			_ = k8sClient.DeleteAllOf(ctx, &v1alpha1.StarknetRPCBackup{}, client.InNamespace(namespace),
+				client.MatchingLabels{scheduledBackupLabel: resourceName})
+			_ = k8sClient.Delete(ctx, scheduled)
+		})
+
+		It("Should create a backup for the missed schedule", func() {
+			result := reconcile()
+
+			backups := listBackups()
+			Expect(backups).To(HaveLen(1))
+			Expect(backups[0].Spec.StarknetRPC.Name).To(Equal("test-starknet-rpc-scheduled"))
+			Expect(backups[0].Spec.FileName).To(BeEmpty())
+			Expect(backups[0].OwnerReferences[0].Kind).To(Equal("StarknetRPCScheduledBackup"))
+
+			Expect(scheduled.Status.Active).To(Equal(backups[0].Name))
+			Expect(scheduled.Status.LastScheduleTime).NotTo(BeNil())
+			Expect(scheduled.Status.LastScheduleTime.UTC().Hour()).To(Equal(3))
+			Expect(scheduled.Status.NextScheduleTime.Time).To(BeTemporally(">", now))
+			Expect(result.RequeueAfter).To(Equal(scheduled.Status.NextScheduleTime.Sub(now)))
+
+			// Nothing new until the next schedule
+			reconcile()
+			Expect(listBackups()).To(HaveLen(1))
+		})
+
+		It("Should skip the schedule while a backup is running", func() {
+			createBackup(resourceName+"-running", v1alpha1.StarknetRPCBackupPhaseRunning, now)
+
+			reconcile()
+			Expect(listBackups()).To(HaveLen(1))
+			Expect(scheduled.Status.Active).To(Equal(resourceName + "-running"))
+			Expect(scheduled.Status.LastScheduleTime).NotTo(BeNil())
+		})
+
+		It("Should not create backups while suspended", func() {
+			scheduled.Spec.Suspend = &[]bool{true}[0]
+			Expect(k8sClient.Update(ctx, scheduled)).To(Succeed())
+
+			reconcile()
+			Expect(listBackups()).To(BeEmpty())
+		})
+
+		It("Should record the last successful backup", func() {
+			scheduled.Spec.Suspend = &[]bool{true}[0]
+			Expect(k8sClient.Update(ctx, scheduled)).To(Succeed())
+			createBackup(resourceName+"-old", v1alpha1.StarknetRPCBackupPhaseCompleted, now.Add(-48*time.Hour))
+			latest := createBackup(resourceName+"-latest", v1alpha1.StarknetRPCBackupPhaseCompleted, now.Add(-24*time.Hour))
+			latest.Status.BlockHeight = 1234
+			Expect(k8sClient.Status().Update(ctx, latest)).To(Succeed())
+
+			reconcile()
+			Expect(scheduled.Status.LastSuccessfulBackup).To(Equal(resourceName + "-latest"))
+			Expect(scheduled.Status.LastSuccessfulBlockHeight).To(Equal(int64(1234)))
+		})
+
+		It("Should delete the snapshot of the pruned backups before deleting them", func() {
+			scheduled.Spec.Suspend = &[]bool{true}[0]
+			scheduled.Spec.Retention = &v1alpha1.BackupRetentionPolicy{KeepLast: &[]int32{1}[0]}
+			Expect(k8sClient.Update(ctx, scheduled)).To(Succeed())
+			old := createBackup(resourceName+"-old", v1alpha1.StarknetRPCBackupPhaseCompleted, now.Add(-48*time.Hour))
+			createBackup(resourceName+"-latest", v1alpha1.StarknetRPCBackupPhaseCompleted, now.Add(-24*time.Hour))
+
+			reconcile()
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-old-prune", Namespace: namespace}, job)).To(Succeed())
+			container := job.Spec.Template.Spec.Containers[0]
+			Expect(container.Command).To(Equal([]string{"/app/prune.sh"}))
+			Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "BACKUP_FILE_NAME", Value: old.Status.FileName}))
+			Expect(listBackups()).To(HaveLen(2))
+
+			startTime := metav1.Now()
+			job.Status.StartTime = &startTime
+			job.Status.Succeeded = 1
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+
+			reconcile()
+			backups := listBackups()
+			Expect(backups).To(HaveLen(1))
+			Expect(backups[0].Name).To(Equal(resourceName + "-latest"))
+		})
+
+		It("Should retry the prune job once it failed for good", func() {
+			scheduled.Spec.Suspend = &[]bool{true}[0]
+			scheduled.Spec.Retention = &v1alpha1.BackupRetentionPolicy{KeepLast: &[]int32{1}[0]}
+			Expect(k8sClient.Update(ctx, scheduled)).To(Succeed())
+			createBackup(resourceName+"-old", v1alpha1.StarknetRPCBackupPhaseCompleted, now.Add(-48*time.Hour))
+			createBackup(resourceName+"-latest", v1alpha1.StarknetRPCBackupPhaseCompleted, now.Add(-24*time.Hour))
+
+			reconcile()
+			jobKey := types.NamespacedName{Name: resourceName + "-old-prune", Namespace: namespace}
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, jobKey, job)).To(Succeed())
+
+			By("Waiting while the job retries by itself")
+			startTime := metav1.Now()
+			job.Status.StartTime = &startTime
+			job.Status.Failed = 1
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+
+			reconcile()
+			Expect(listBackups()).To(HaveLen(2))
+			current := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, jobKey, current)).To(Succeed())
+			Expect(current.UID).To(Equal(job.UID))
+
+			By("Re-creating the job once it failed for good")
+			job = current
+			job.Status.Failed = 3
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobFailureTarget, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", LastTransitionTime: startTime},
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", LastTransitionTime: startTime},
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+
+			// The clock of the reconciler is a day ahead: the retry interval elapsed
+			reconcile()
+			Expect(listBackups()).To(HaveLen(2))
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, jobKey, current)
+				return err != nil || current.UID != job.UID
+			}).Should(BeTrue())
+
+			reconcile()
+			Expect(k8sClient.Get(ctx, jobKey, current)).To(Succeed())
+			Expect(current.UID).NotTo(Equal(job.UID))
+			Expect(listBackups()).To(HaveLen(2))
+		})
+	})
+
+	Context("When selecting the backups to prune", func() {
+		backup := func(name string, phase v1alpha1.StarknetRPCBackupPhase, completion time.Time) v1alpha1.StarknetRPCBackup {
+			return v1alpha1.StarknetRPCBackup{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Status: v1alpha1.StarknetRPCBackupStatus{
+					Phase:          phase,
+					CompletionTime: &metav1.Time{Time: completion},
+				},
+			}
+		}
+		names := func(backups []*v1alpha1.StarknetRPCBackup) []string {
+			var names []string
+			for _, backup := range backups {
+				names = append(names, backup.Name)
+			}
+			return names
+		}
+
+		// Monday 2025-06-02, 3am
+		start := time.Date(2025, time.June, 2, 3, 0, 0, 0, time.UTC)
+
+		It("Should keep everything without a retention policy", func() {
+			backups := []v1alpha1.StarknetRPCBackup{
+				backup("a", v1alpha1.StarknetRPCBackupPhaseCompleted, start),
+				backup("b", v1alpha1.StarknetRPCBackupPhaseFailed, start.Add(time.Hour)),
+				backup("c", v1alpha1.StarknetRPCBackupPhaseCompleted, start.Add(2*time.Hour)),
+			}
+			Expect(selectBackupsToPrune(backups, nil)).To(BeEmpty())
+		})
+
+		It("Should keep the latest backups of the last days and weeks", func() {
+			var backups []v1alpha1.StarknetRPCBackup
+			// Two backups a day for three weeks
+			for day := range 21 {
+				for i := range 2 {
+					at := start.AddDate(0, 0, day).Add(time.Duration(i) * 6 * time.Hour)
+					backups = append(backups, backup(fmt.Sprintf("d%02d-%d", day, i), v1alpha1.StarknetRPCBackupPhaseCompleted, at))
+				}
+			}
+
+			prune := names(selectBackupsToPrune(backups, &v1alpha1.BackupRetentionPolicy{
+				KeepLast:   &[]int32{3}[0],
+				KeepDaily:  &[]int32{2}[0],
+				KeepWeekly: &[]int32{2}[0],
+			}))
+
+			// The last 3 backups, and the last of the last 2 days
+			Expect(prune).NotTo(ContainElements("d20-1", "d20-0", "d19-1"))
+			// The last of the previous week (Sunday)
+			Expect(prune).NotTo(ContainElement("d13-1"))
+			Expect(prune).To(ContainElements("d19-0", "d18-1", "d14-0", "d13-0", "d00-0"))
+			Expect(prune).To(HaveLen(len(backups) - 4))
+		})
+
+		It("Should prune the failed backups once a newer backup completed", func() {
+			backups := []v1alpha1.StarknetRPCBackup{
+				backup("failed-old", v1alpha1.StarknetRPCBackupPhaseFailed, start),
+				backup("completed", v1alpha1.StarknetRPCBackupPhaseCompleted, start.Add(time.Hour)),
+				backup("failed-new", v1alpha1.StarknetRPCBackupPhaseFailed, start.Add(2*time.Hour)),
+				{ObjectMeta: metav1.ObjectMeta{Name: "running"}, Status: v1alpha1.StarknetRPCBackupStatus{Phase: v1alpha1.StarknetRPCBackupPhaseRunning}},
+			}
+
+			prune := names(selectBackupsToPrune(backups, &v1alpha1.BackupRetentionPolicy{KeepLast: &[]int32{5}[0]}))
+			Expect(prune).To(Equal([]string{"failed-old"}))
+		})
+	})
+})
@@ -25,6 +25,9 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -100,6 +103,49 @@ var _ = AfterSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 })
 
+// newTestStarknetRPC returns a mainnet StarknetRPC in the default namespace, with nothing to restore.
+// The tests adjust its spec before creating it with createTestStarknetRPC.
+func newTestStarknetRPC(name string) *pathfinderv1alpha1.StarknetRPC {
+	return &pathfinderv1alpha1.StarknetRPC{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: pathfinderv1alpha1.GroupVersion.String(),
+			Kind:       "StarknetRPC",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: pathfinderv1alpha1.StarknetRPCSpec{
+			Network: "mainnet",
+			RestoreArchive: pathfinderv1alpha1.ArchiveSnapshot{
+				Enable:   &[]bool{false}[0],
+				FileName: "test-snapshot.tar",
+				Checksum: "test-checksum",
+				Storage: pathfinderv1alpha1.StorageTemplate{
+					Size: resource.MustParse("10Gi"),
+				},
+			},
+			Storage: pathfinderv1alpha1.StorageTemplate{
+				Size: resource.MustParse("100Gi"),
+			},
+			Layer1RpcSecret: corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: "l1-rpc-secret",
+				},
+				Key: "url",
+			},
+		},
+	}
+}
+
+// createTestStarknetRPC creates the StarknetRPC. The client clears its type meta, which the owner
+// references of the wanted resources are built from, so it is set back.
+func createTestStarknetRPC(ctx context.Context, rpc *pathfinderv1alpha1.StarknetRPC) {
+	Expect(k8sClient.Create(ctx, rpc)).Should(Succeed())
+	rpc.APIVersion = pathfinderv1alpha1.GroupVersion.String()
+	rpc.Kind = "StarknetRPC"
+}
+
 // getFirstFoundEnvTestBinaryDir locates the first binary in the specified path.
 // ENVTEST-based tests depend on specific binaries, usually located in paths set by
 // controller-runtime. When running tests directly (e.g., via an IDE) without using
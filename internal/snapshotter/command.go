@@ -0,0 +1,125 @@
+package snapshotter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// defaultDataDir and defaultScratchDir are where the volumes are mounted in the restore job
+	defaultDataDir    = "/data"
+	defaultScratchDir = "/scratch"
+	// defaultBucketName and defaultEndpoint are those of the pathfinder snapshot service
+	defaultBucketName = "pathfinder-snapshots"
+	defaultEndpoint   = "https://cbf011119e7864a873158d83f3304e27.r2.cloudflarestorage.com"
+	// TerminationMessagePath is where the result of the restore is written for the controller
+	TerminationMessagePath = "/dev/termination-log"
+)
+
+// ErrUnsupportedSource is returned for the sources only handled by the snapshotter image
+var ErrUnsupportedSource = errors.New("unsupported snapshot source")
+
+// OptionsFromEnv reads the options of the restore from the environment of the restore job,
+// as documented in images/snapshotter/restore.sh
+func OptionsFromEnv(getenv func(string) string) (RestoreOptions, error) {
+	opts := RestoreOptions{
+		Network:    getenv("PATHFINDER_NETWORK"),
+		FileName:   getenv("PATHFINDER_FILE_NAME"),
+		Checksum:   getenv("PATHFINDER_CHECKSUM"),
+		DataDir:    getOrDefault(getenv, "DATA_DIR", defaultDataDir),
+		ScratchDir: getOrDefault(getenv, "EXTRACT_DIR", defaultScratchDir),
+	}
+	if opts.Network == "" || opts.FileName == "" || opts.Checksum == "" {
+		return opts, errors.New("PATHFINDER_NETWORK, PATHFINDER_FILE_NAME and PATHFINDER_CHECKSUM must be set")
+	}
+	if getenv("RESTORE_MODE") == "stream" {
+		opts.ScratchDir = ""
+	}
+
+	switch sourceType := getOrDefault(getenv, "SNAPSHOT_SOURCE", "rclone"); sourceType {
+	case "rclone":
+		if getenv("RCLONE_CONFIG_FILE") != "" || getenv("RSYNC_CONFIG") != "" {
+			return opts, fmt.Errorf("%w: an rclone configuration requires the snapshotter image", ErrUnsupportedSource)
+		}
+		if getenv("S3_ACCESS_KEY_ID") == "" || getenv("S3_SECRET_ACCESS_KEY") == "" {
+			return opts, errors.New("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY must be set")
+		}
+		opts.Source = &S3Source{
+			Endpoint:        getOrDefault(getenv, "S3_ENDPOINT_URL", defaultEndpoint),
+			Region:          getOrDefault(getenv, "S3_REGION", "auto"),
+			Bucket:          getOrDefault(getenv, "S3_BUCKET_NAME", defaultBucketName),
+			Key:             opts.FileName,
+			AccessKeyID:     getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: getenv("S3_SECRET_ACCESS_KEY"),
+		}
+	case "s3":
+		opts.Source = &S3Source{
+			Endpoint:        getenv("S3_ENDPOINT_URL"),
+			Region:          getenv("S3_REGION"),
+			Bucket:          getenv("S3_BUCKET_NAME"),
+			Key:             path.Join(getenv("S3_PATH"), opts.FileName),
+			AccessKeyID:     getOrDefault(getenv, "S3_ACCESS_KEY_ID", getenv("AWS_ACCESS_KEY_ID")),
+			SecretAccessKey: getOrDefault(getenv, "S3_SECRET_ACCESS_KEY", getenv("AWS_SECRET_ACCESS_KEY")),
+			SessionToken:    getenv("AWS_SESSION_TOKEN"),
+		}
+	case "http":
+		opts.Source = &HTTPSource{URL: getenv("SNAPSHOT_URL")}
+	case "pvc":
+		// The file is already local, there is nothing to download
+		opts.Source = &FileSource{Path: path.Join(getenv("SNAPSHOT_DIR"), opts.FileName)}
+		opts.ScratchDir = ""
+	default:
+		return opts, fmt.Errorf("%w: %s", ErrUnsupportedSource, sourceType)
+	}
+	return opts, nil
+}
+
+// RunRestore runs the restore described by the environment, reporting the progress to `out`.
+// The final progress, or the error, is written to the termination message at `terminationPath`.
+func RunRestore(ctx context.Context, getenv func(string) string, out io.Writer, terminationPath string) error {
+	err := runRestore(ctx, getenv, out, terminationPath)
+	if err != nil {
+		writeTerminationMessage(terminationPath, []byte(err.Error()))
+	}
+	return err
+}
+
+func runRestore(ctx context.Context, getenv func(string) string, out io.Writer, terminationPath string) error {
+	opts, err := OptionsFromEnv(getenv)
+	if err != nil {
+		return err
+	}
+	opts.Reporter = NewProgressReporter(out, opts.FileName)
+
+	if err := Restore(ctx, opts); err != nil {
+		return err
+	}
+
+	result, err := json.Marshal(opts.Reporter.Progress())
+	if err != nil {
+		return err
+	}
+	writeTerminationMessage(terminationPath, result)
+	return nil
+}
+
+// writeTerminationMessage writes the message read by the controller once the container terminates
+func writeTerminationMessage(terminationPath string, message []byte) {
+	if terminationPath == "" {
+		return
+	}
+	_ = os.WriteFile(terminationPath, message, 0o644)
+}
+
+func getOrDefault(getenv func(string) string, name string, fallback string) string {
+	if value := strings.TrimSpace(getenv(name)); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,130 @@
+package snapshotter
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// defaultReportInterval is the minimum interval between two progress reports of the same phase
+const defaultReportInterval = 10 * time.Second
+
+// Phase is the step of the restore in progress
+type Phase string
+
+const (
+	// PhaseDownloading is when the archive is downloaded (and decompressed, when streaming)
+	PhaseDownloading Phase = "Downloading"
+	// PhaseVerifying is when the checksum of the downloaded archive is verified
+	PhaseVerifying Phase = "Verifying"
+	// PhaseExtracting is when the downloaded archive is decompressed to the data directory
+	PhaseExtracting Phase = "Extracting"
+	// PhaseCompleted is when the database is ready
+	PhaseCompleted Phase = "Completed"
+)
+
+// Progress is the progress of a restore. It is reported as one JSON document per line on the
+// standard output, and written to the termination message of the container once the restore completes.
+type Progress struct {
+	// Phase is the current step of the restore
+	Phase Phase `json:"phase"`
+	// FileName is the name of the snapshot file being restored
+	FileName string `json:"fileName,omitempty"`
+	// BytesDone is the number of bytes of the archive processed in the current phase
+	BytesDone int64 `json:"bytesDone"`
+	// BytesTotal is the size of the archive, if known
+	BytesTotal int64 `json:"bytesTotal,omitempty"`
+	// StartTime is when the restore started
+	StartTime time.Time `json:"startTime"`
+	// PhaseStartTime is when the current phase started
+	PhaseStartTime time.Time `json:"phaseStartTime"`
+	// ETASeconds is the estimated time left in the current phase, if the size of the archive is known
+	ETASeconds int64 `json:"etaSeconds,omitempty"`
+}
+
+// ProgressReporter writes the progress of a restore, at most once per interval within a phase
+type ProgressReporter struct {
+	out      io.Writer
+	interval time.Duration
+	now      func() time.Time
+
+	mu         sync.Mutex
+	progress   Progress
+	lastReport time.Time
+}
+
+// NewProgressReporter returns a ProgressReporter writing the progress of the restore of `fileName` to `out`
+func NewProgressReporter(out io.Writer, fileName string) *ProgressReporter {
+	return &ProgressReporter{
+		out:      out,
+		interval: defaultReportInterval,
+		now:      time.Now,
+		progress: Progress{FileName: fileName},
+	}
+}
+
+// SetPhase moves the restore to the next phase, processing `total` bytes (0 if unknown), and reports it
+func (r *ProgressReporter) SetPhase(phase Phase, total int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if r.progress.StartTime.IsZero() {
+		r.progress.StartTime = now
+	}
+	r.progress.Phase = phase
+	r.progress.BytesDone = 0
+	r.progress.BytesTotal = total
+	r.progress.PhaseStartTime = now
+	r.progress.ETASeconds = 0
+	r.report(now)
+}
+
+// Add records that `n` more bytes have been processed in the current phase
+func (r *ProgressReporter) Add(n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.progress.BytesDone += n
+	now := r.now()
+	if now.Sub(r.lastReport) >= r.interval {
+		r.report(now)
+	}
+}
+
+// Progress returns the current progress of the restore
+func (r *ProgressReporter) Progress() Progress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.progress
+}
+
+// report writes the progress, the lock must be held
+func (r *ProgressReporter) report(now time.Time) {
+	r.progress.ETASeconds = 0
+	elapsed := now.Sub(r.progress.PhaseStartTime)
+	if r.progress.BytesTotal > 0 && r.progress.BytesDone > 0 && elapsed > 0 {
+		rate := float64(r.progress.BytesDone) / elapsed.Seconds()
+		r.progress.ETASeconds = int64(float64(r.progress.BytesTotal-r.progress.BytesDone) / rate)
+	}
+
+	r.lastReport = now
+	line, err := json.Marshal(r.progress)
+	if err != nil {
+		return
+	}
+	_, _ = r.out.Write(append(line, '\n'))
+}
+
+// progressReader reports the bytes read from the underlying reader
+type progressReader struct {
+	io.Reader
+	reporter *ProgressReporter
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.reporter.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,193 @@
+// Package snapshotter restores the pathfinder database from a zstd compressed snapshot file.
+// It is run in the restore jobs, through the `restore` subcommand of the operator binary.
+package snapshotter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrChecksumMismatch is returned when the checksum of the snapshot file is not the expected one
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// RestoreOptions describes the snapshot to restore
+type RestoreOptions struct {
+	// Network is the network of the database, which is restored to <DataDir>/<Network>.sqlite
+	Network string
+	// FileName is the name of the snapshot file
+	FileName string
+	// Checksum is the expected sha256 checksum of the snapshot file
+	Checksum string
+	// DataDir is the directory the database is restored to
+	DataDir string
+	// ScratchDir is where the snapshot file is downloaded before being decompressed.
+	// If not set, the snapshot file is decompressed while it is downloaded.
+	ScratchDir string
+	// Source is where the snapshot file is read from
+	Source Source
+	// Reporter receives the progress of the restore
+	Reporter *ProgressReporter
+}
+
+// Restore downloads, verifies and decompresses the snapshot file to the data directory.
+// The database is only moved in place once its checksum has been verified.
+func Restore(ctx context.Context, opts RestoreOptions) error {
+	if err := os.MkdirAll(opts.DataDir, 0o755); err != nil {
+		return err
+	}
+
+	database := filepath.Join(opts.DataDir, opts.Network+".sqlite")
+	partial := database + ".partial"
+
+	var err error
+	if opts.ScratchDir == "" {
+		err = streamSnapshot(ctx, opts, partial)
+	} else {
+		err = downloadSnapshot(ctx, opts, partial)
+	}
+	if err != nil {
+		_ = os.Remove(partial)
+		return err
+	}
+
+	if err := os.Rename(partial, database); err != nil {
+		return err
+	}
+	opts.Reporter.SetPhase(PhaseCompleted, 0)
+	return nil
+}
+
+// streamSnapshot decompresses the snapshot file while it is downloaded, and verifies its checksum at the end
+func streamSnapshot(ctx context.Context, opts RestoreOptions, target string) error {
+	body, size, err := opts.Source.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = body.Close() }()
+
+	opts.Reporter.SetPhase(PhaseDownloading, size)
+	hasher := sha256.New()
+	reader := io.TeeReader(&progressReader{Reader: body, reporter: opts.Reporter}, hasher)
+	if err := decompress(ctx, reader, target); err != nil {
+		return err
+	}
+
+	// The decoder may stop before the end of the file
+	if _, err := io.Copy(hasher, body); err != nil {
+		return fmt.Errorf("failed to download the snapshot: %w", err)
+	}
+	return verifyChecksum(hasher, opts.Checksum)
+}
+
+// downloadSnapshot downloads the snapshot file to the scratch directory, verifies its checksum and then decompresses it
+func downloadSnapshot(ctx context.Context, opts RestoreOptions, target string) error {
+	if err := os.MkdirAll(opts.ScratchDir, 0o755); err != nil {
+		return err
+	}
+	archive := filepath.Join(opts.ScratchDir, opts.FileName)
+	defer func() { _ = os.Remove(archive) }()
+
+	body, size, err := opts.Source.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = body.Close() }()
+
+	opts.Reporter.SetPhase(PhaseDownloading, size)
+	file, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, &progressReader{Reader: &contextReader{ctx: ctx, Reader: body}, reporter: opts.Reporter})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download the snapshot: %w", err)
+	}
+
+	info, err := os.Stat(archive)
+	if err != nil {
+		return err
+	}
+
+	opts.Reporter.SetPhase(PhaseVerifying, info.Size())
+	if err := hashFile(ctx, archive, opts.Reporter, opts.Checksum); err != nil {
+		return err
+	}
+
+	opts.Reporter.SetPhase(PhaseExtracting, info.Size())
+	file, err = os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	return decompress(ctx, &progressReader{Reader: file, reporter: opts.Reporter}, target)
+}
+
+// hashFile verifies the checksum of a file
+func hashFile(ctx context.Context, path string, reporter *ProgressReporter, checksum string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, &progressReader{Reader: &contextReader{ctx: ctx, Reader: file}, reporter: reporter}); err != nil {
+		return err
+	}
+	return verifyChecksum(hasher, checksum)
+}
+
+// decompress writes the zstd decompressed content of the reader to the target file
+func decompress(ctx context.Context, reader io.Reader, target string) error {
+	decoder, err := zstd.NewReader(&contextReader{ctx: ctx, Reader: reader}, zstd.WithDecoderConcurrency(0))
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, decoder)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decompress the snapshot: %w", err)
+	}
+	return nil
+}
+
+func verifyChecksum(hasher hash.Hash, checksum string) error {
+	actual := hex.EncodeToString(hasher.Sum(nil))
+	if actual != checksum {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, checksum, actual)
+	}
+	return nil
+}
+
+// contextReader stops reading once the context is done
+type contextReader struct {
+	io.Reader
+	ctx context.Context
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
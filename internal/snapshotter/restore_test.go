@@ -0,0 +1,238 @@
+package snapshotter
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	testAccessKeyID     = "test-access-key"
+	testSecretAccessKey = "test-secret-key"
+)
+
+// fakeS3 is a local stand-in for an S3 bucket, serving the objects to the signed requests
+type fakeS3 struct {
+	objects  map[string][]byte
+	requests []*http.Request
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.requests = append(s.requests, req)
+
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential="+testAccessKeyID+"/") ||
+		!strings.Contains(auth, "SignedHeaders=") || !strings.Contains(auth, "Signature=") ||
+		req.Header.Get("X-Amz-Date") == "" {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+
+	object, ok := s.objects[req.URL.Path]
+	if !ok {
+		http.Error(w, "NoSuchKey", http.StatusNotFound)
+		return
+	}
+	http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(object))
+}
+
+var _ = Describe("Snapshot restore", func() {
+	var (
+		ctx      context.Context
+		database []byte
+		archive  []byte
+		checksum string
+		dataDir  string
+		bucket   *fakeS3
+		server   *httptest.Server
+		output   *bytes.Buffer
+	)
+
+	restoredDatabase := func() []byte {
+		content, err := os.ReadFile(filepath.Join(dataDir, "mainnet.sqlite"))
+		Expect(err).NotTo(HaveOccurred())
+		return content
+	}
+
+	getenv := func(env map[string]string) func(string) string {
+		return func(name string) string { return env[name] }
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		database = make([]byte, 1<<20)
+		_, err := rand.Read(database)
+		Expect(err).NotTo(HaveOccurred())
+
+		encoder, err := zstd.NewWriter(nil)
+		Expect(err).NotTo(HaveOccurred())
+		archive = encoder.EncodeAll(database, nil)
+		sum := sha256.Sum256(archive)
+		checksum = hex.EncodeToString(sum[:])
+
+		dataDir = GinkgoT().TempDir()
+		bucket = &fakeS3{objects: map[string][]byte{"/snapshots/mainnet/snapshot.sqlite.zst": archive}}
+		server = httptest.NewServer(bucket)
+		DeferCleanup(server.Close)
+		output = &bytes.Buffer{}
+	})
+
+	s3Env := func() map[string]string {
+		return map[string]string{
+			"PATHFINDER_NETWORK":   "mainnet",
+			"PATHFINDER_FILE_NAME": "snapshot.sqlite.zst",
+			"PATHFINDER_CHECKSUM":  checksum,
+			"DATA_DIR":             dataDir,
+			"EXTRACT_DIR":          GinkgoT().TempDir(),
+			"SNAPSHOT_SOURCE":      "s3",
+			"S3_ENDPOINT_URL":      server.URL,
+			"S3_BUCKET_NAME":       "snapshots",
+			"S3_PATH":              "mainnet",
+			"S3_ACCESS_KEY_ID":     testAccessKeyID,
+			"S3_SECRET_ACCESS_KEY": testSecretAccessKey,
+		}
+	}
+
+	It("Should download, verify and extract a snapshot from an S3 bucket", func() {
+		terminationLog := filepath.Join(GinkgoT().TempDir(), "termination-log")
+
+		Expect(RunRestore(ctx, getenv(s3Env()), output, terminationLog)).To(Succeed())
+		Expect(restoredDatabase()).To(Equal(database))
+		Expect(bucket.requests).To(HaveLen(1))
+
+		// The progress of every phase is reported
+		var phases []Phase
+		for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+			progress := Progress{}
+			Expect(json.Unmarshal([]byte(line), &progress)).To(Succeed())
+			phases = append(phases, progress.Phase)
+		}
+		Expect(phases).To(Equal([]Phase{PhaseDownloading, PhaseVerifying, PhaseExtracting, PhaseCompleted}))
+
+		// The result is left for the controller
+		message, err := os.ReadFile(terminationLog)
+		Expect(err).NotTo(HaveOccurred())
+		result := Progress{}
+		Expect(json.Unmarshal(message, &result)).To(Succeed())
+		Expect(result.Phase).To(Equal(PhaseCompleted))
+		Expect(result.FileName).To(Equal("snapshot.sqlite.zst"))
+	})
+
+	It("Should stream a snapshot without storing the archive", func() {
+		env := s3Env()
+		env["RESTORE_MODE"] = "stream"
+
+		Expect(RunRestore(ctx, getenv(env), output, "")).To(Succeed())
+		Expect(restoredDatabase()).To(Equal(database))
+
+		entries, err := os.ReadDir(env["EXTRACT_DIR"])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("Should not leave a database behind when the checksum does not match", func() {
+		terminationLog := filepath.Join(GinkgoT().TempDir(), "termination-log")
+		for _, mode := range []string{"download", "stream"} {
+			env := s3Env()
+			env["RESTORE_MODE"] = mode
+			env["PATHFINDER_CHECKSUM"] = strings.Repeat("0", 64)
+
+			err := RunRestore(ctx, getenv(env), output, terminationLog)
+			Expect(err).To(MatchError(ErrChecksumMismatch))
+
+			entries, err := os.ReadDir(dataDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+
+			message, err := os.ReadFile(terminationLog)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(message)).To(ContainSubstring("checksum mismatch"))
+		}
+	})
+
+	It("Should fail when the request is not signed with the credentials", func() {
+		env := s3Env()
+		delete(env, "S3_ACCESS_KEY_ID")
+
+		err := RunRestore(ctx, getenv(env), output, "")
+		Expect(err).To(MatchError(ContainSubstring("403")))
+	})
+
+	It("Should fail when the snapshot does not exist", func() {
+		env := s3Env()
+		env["PATHFINDER_FILE_NAME"] = "missing.sqlite.zst"
+
+		err := RunRestore(ctx, getenv(env), output, "")
+		Expect(err).To(MatchError(ContainSubstring("404")))
+	})
+
+	It("Should download a snapshot from an HTTP(S) mirror", func() {
+		mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(archive))
+		}))
+		DeferCleanup(mirror.Close)
+
+		env := s3Env()
+		env["SNAPSHOT_SOURCE"] = "http"
+		env["SNAPSHOT_URL"] = mirror.URL + "/pathfinder/snapshot.sqlite.zst"
+
+		Expect(RunRestore(ctx, getenv(env), output, "")).To(Succeed())
+		Expect(restoredDatabase()).To(Equal(database))
+	})
+
+	It("Should read a snapshot from a mounted volume in place", func() {
+		snapshotDir := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(snapshotDir, "snapshot.sqlite.zst"), archive, 0o644)).To(Succeed())
+
+		env := s3Env()
+		env["SNAPSHOT_SOURCE"] = "pvc"
+		env["SNAPSHOT_DIR"] = snapshotDir
+
+		Expect(RunRestore(ctx, getenv(env), output, "")).To(Succeed())
+		Expect(restoredDatabase()).To(Equal(database))
+	})
+
+	It("Should refuse the sources handled by the snapshotter image", func() {
+		env := s3Env()
+		env["SNAPSHOT_SOURCE"] = "gcs"
+		_, err := OptionsFromEnv(getenv(env))
+		Expect(err).To(MatchError(ErrUnsupportedSource))
+
+		env["SNAPSHOT_SOURCE"] = "rclone"
+		env["RCLONE_CONFIG_FILE"] = "/etc/rclone/rclone.conf"
+		_, err = OptionsFromEnv(getenv(env))
+		Expect(err).To(MatchError(ErrUnsupportedSource))
+	})
+
+	It("Should default to the pathfinder snapshot service", func() {
+		env := s3Env()
+		delete(env, "SNAPSHOT_SOURCE")
+		delete(env, "S3_ENDPOINT_URL")
+		delete(env, "S3_BUCKET_NAME")
+
+		opts, err := OptionsFromEnv(getenv(env))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opts.Source).To(Equal(&S3Source{
+			Endpoint:        defaultEndpoint,
+			Region:          "auto",
+			Bucket:          defaultBucketName,
+			Key:             "snapshot.sqlite.zst",
+			AccessKeyID:     testAccessKeyID,
+			SecretAccessKey: testSecretAccessKey,
+		}))
+	})
+})
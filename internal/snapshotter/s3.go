@@ -0,0 +1,61 @@
+package snapshotter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// defaultS3Region is the region used to sign the requests when none is configured
+const defaultS3Region = "us-east-1"
+
+// S3Source downloads the snapshot file from an S3-compatible bucket, addressed with path-style URLs
+type S3Source struct {
+	// Endpoint is the URL of the S3 API, https://s3.<region>.amazonaws.com if not set
+	Endpoint string
+	// Region is the region of the bucket, us-east-1 if not set
+	Region string
+	// Bucket is the name of the bucket
+	Bucket string
+	// Key is the key of the snapshot file in the bucket
+	Key string
+	// AccessKeyID and SecretAccessKey sign the requests. If not set, the bucket is read anonymously.
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is the token of temporary credentials
+	SessionToken string
+	// Client is the client used to download the file, http.DefaultClient if not set
+	Client *http.Client
+}
+
+func (s *S3Source) Open(ctx context.Context) (io.ReadCloser, int64, error) {
+	options := s3.Options{
+		Region:       s.Region,
+		UsePathStyle: true,
+		HTTPClient:   getClient(s.Client),
+		Credentials:  aws.AnonymousCredentials{},
+	}
+	if options.Region == "" {
+		options.Region = defaultS3Region
+	}
+	if s.Endpoint != "" {
+		options.BaseEndpoint = aws.String(s.Endpoint)
+	}
+	if s.AccessKeyID != "" {
+		options.Credentials = credentials.NewStaticCredentialsProvider(s.AccessKeyID, s.SecretAccessKey, s.SessionToken)
+	}
+
+	object, err := s3.New(options).GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Key),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to download the snapshot from s3://%s/%s: %w", s.Bucket, s.Key, err)
+	}
+	return object.Body, max(aws.ToInt64(object.ContentLength), 0), nil
+}
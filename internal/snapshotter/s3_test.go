@@ -0,0 +1,68 @@
+package snapshotter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("S3 source", func() {
+	var (
+		server   *httptest.Server
+		requests []*http.Request
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests = append(requests, req)
+			_, _ = w.Write([]byte("snapshot"))
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Should sign the requests with the session token of temporary credentials", func() {
+		source := &S3Source{
+			Endpoint:        server.URL,
+			Region:          "eu-west-1",
+			Bucket:          "snapshots",
+			Key:             "mainnet/snapshot.sqlite.zst",
+			AccessKeyID:     testAccessKeyID,
+			SecretAccessKey: testSecretAccessKey,
+			SessionToken:    "test-session-token",
+		}
+
+		body, size, err := source.Open(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = body.Close() }()
+		content, err := io.ReadAll(body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("snapshot"))
+		Expect(size).To(Equal(int64(len("snapshot"))))
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].URL.Path).To(Equal("/snapshots/mainnet/snapshot.sqlite.zst"))
+		Expect(requests[0].Header.Get("X-Amz-Security-Token")).To(Equal("test-session-token"))
+		Expect(requests[0].Header.Get("Authorization")).To(HavePrefix(
+			"AWS4-HMAC-SHA256 Credential=" + testAccessKeyID + "/"))
+		Expect(requests[0].Header.Get("Authorization")).To(ContainSubstring("/eu-west-1/s3/aws4_request"))
+	})
+
+	It("Should read a public bucket anonymously", func() {
+		source := &S3Source{Endpoint: server.URL, Bucket: "snapshots", Key: "snapshot.sqlite.zst"}
+
+		body, _, err := source.Open(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		_ = body.Close()
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Header.Get("Authorization")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,70 @@
+package snapshotter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// Source is where the snapshot file is read from
+type Source interface {
+	// Open returns the content of the snapshot file, and its size (0 if unknown)
+	Open(ctx context.Context) (io.ReadCloser, int64, error)
+}
+
+// HTTPSource downloads the snapshot file from an HTTP(S) URL
+type HTTPSource struct {
+	// URL is the URL of the snapshot file
+	URL string
+	// Client is the client used to download the file, http.DefaultClient if not set
+	Client *http.Client
+}
+
+func (s *HTTPSource) Open(ctx context.Context) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return doGet(getClient(s.Client), req)
+}
+
+// FileSource reads the snapshot file from a local path (e.g. a mounted volume)
+type FileSource struct {
+	// Path is the path of the snapshot file
+	Path string
+}
+
+func (s *FileSource) Open(_ context.Context) (io.ReadCloser, int64, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+func getClient(client *http.Client) *http.Client {
+	if client == nil {
+		return http.DefaultClient
+	}
+	return client
+}
+
+// doGet sends the request, and returns the body of a successful response
+func doGet(client *http.Client, req *http.Request) (io.ReadCloser, int64, error) {
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to download the snapshot: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		return nil, 0, fmt.Errorf("failed to download the snapshot from %s: unexpected status %s", req.URL.Redacted(), res.Status)
+	}
+	return res.Body, max(res.ContentLength, 0), nil
+}
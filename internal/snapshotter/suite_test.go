@@ -0,0 +1,14 @@
+package snapshotter
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSnapshotter(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Snapshotter Suite")
+}
@@ -13,6 +13,7 @@ type StarknetRPCConditionType string
 const (
 	StarknetRPCRestoreCondition   StarknetRPCConditionType = "Restore"
 	StarknetRPCAvailableCondition StarknetRPCConditionType = "Available"
+	StarknetRPCStorageCondition   StarknetRPCConditionType = "Storage"
 )
 
 func Initialize(ctx context.Context, client client.Client, rpc *v1alpha1.StarknetRPC) error {
@@ -28,6 +28,8 @@ const (
 	// before the transition to the Failed state (to prevent intermittent issues, or recreating in the event of an overload,
 	// which could lead to a cascading failure).
 	StarknetRPCAvailableStatusUnknown StarknetRPCAvailableStatus = "Unknown"
+	// Quiesced status indicates that the node has been stopped on purpose, e.g. while its database is being backed up.
+	StarknetRPCAvailableStatusQuiesced StarknetRPCAvailableStatus = "Quiesced"
 )
 
 func (s StarknetRPCAvailableStatus) String() string {
@@ -44,6 +46,8 @@ func (s StarknetRPCAvailableStatus) String() string {
 		return "Failed"
 	case StarknetRPCAvailableStatusUnknown:
 		return "Unknown"
+	case StarknetRPCAvailableStatusQuiesced:
+		return "Quiesced"
 	default:
 		return fmt.Sprintf("Unknown(%s)", string(s))
 	}
@@ -63,6 +67,8 @@ func (s StarknetRPCAvailableStatus) Message() string {
 		return "The node failed to start, or another error occurred"
 	case StarknetRPCAvailableStatusUnknown:
 		return "Impossible to determine the status of the node"
+	case StarknetRPCAvailableStatusQuiesced:
+		return "The node is stopped while its database is being backed up"
 	default:
 		return fmt.Sprintf("Unknown(%s)", string(s))
 	}
@@ -82,6 +88,8 @@ func (s StarknetRPCAvailableStatus) Status() metav1.ConditionStatus {
 		return metav1.ConditionFalse
 	case StarknetRPCAvailableStatusUnknown:
 		return metav1.ConditionUnknown
+	case StarknetRPCAvailableStatusQuiesced:
+		return metav1.ConditionFalse
 	default:
 		return metav1.ConditionUnknown
 	}
@@ -0,0 +1,80 @@
+package starknetrpc
+
+import (
+	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
+	"github.com/runelabs-xyz/starknet-operators/internal/utils/condition"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type StarknetRPCStorageStatus string
+
+const (
+	// Ready status indicates that the data volume has the size requested in the spec.
+	StarknetRPCStorageStatusReady StarknetRPCStorageStatus = "Ready"
+	// Resizing status indicates that the data volume is being expanded by the storage driver.
+	StarknetRPCStorageStatusResizing StarknetRPCStorageStatus = "Resizing"
+	// FileSystemResizePending status indicates that the volume was expanded, and its filesystem is resized
+	// when the node is (re)started.
+	StarknetRPCStorageStatusFileSystemResizePending StarknetRPCStorageStatus = "FileSystemResizePending"
+	// ResizeFailed status indicates that the storage driver failed to expand the data volume.
+	StarknetRPCStorageStatusResizeFailed StarknetRPCStorageStatus = "ResizeFailed"
+	// ResizeNotSupported status indicates that the storage class of the data volume does not allow its expansion.
+	StarknetRPCStorageStatusResizeNotSupported StarknetRPCStorageStatus = "ResizeNotSupported"
+	// ShrinkRefused status indicates that the size requested in the spec is smaller than the data volume,
+	// which cannot be shrunk.
+	StarknetRPCStorageStatusShrinkRefused StarknetRPCStorageStatus = "ShrinkRefused"
+)
+
+func (s StarknetRPCStorageStatus) Message() string {
+	switch s {
+	case StarknetRPCStorageStatusReady:
+		return "The data volume has the requested size"
+	case StarknetRPCStorageStatusResizing:
+		return "The data volume is being expanded"
+	case StarknetRPCStorageStatusFileSystemResizePending:
+		return "The data volume was expanded, its filesystem is resized when the node starts"
+	case StarknetRPCStorageStatusResizeFailed:
+		return "The storage driver failed to expand the data volume"
+	case StarknetRPCStorageStatusResizeNotSupported:
+		return "The storage class of the data volume does not allow volume expansion"
+	case StarknetRPCStorageStatusShrinkRefused:
+		return "The data volume cannot be shrunk, the requested size is ignored"
+	default:
+		return "Unknown status"
+	}
+}
+
+func (s StarknetRPCStorageStatus) Status() metav1.ConditionStatus {
+	switch s {
+	case StarknetRPCStorageStatusReady:
+		return metav1.ConditionTrue
+	case StarknetRPCStorageStatusResizing:
+		return metav1.ConditionFalse
+	case StarknetRPCStorageStatusFileSystemResizePending:
+		return metav1.ConditionFalse
+	case StarknetRPCStorageStatusResizeFailed:
+		return metav1.ConditionFalse
+	case StarknetRPCStorageStatusResizeNotSupported:
+		return metav1.ConditionFalse
+	case StarknetRPCStorageStatusShrinkRefused:
+		return metav1.ConditionFalse
+	default:
+		return metav1.ConditionUnknown
+	}
+}
+
+func (s StarknetRPCStorageStatus) AsCondition() metav1.Condition {
+	return metav1.Condition{
+		Type:    string(StarknetRPCStorageCondition),
+		Reason:  string(s),
+		Status:  s.Status(),
+		Message: s.Message(),
+	}
+}
+
+func (s StarknetRPCStorageStatus) Apply() condition.StateTransition {
+	return func(rpc *v1alpha1.StarknetRPC) {
+		meta.SetStatusCondition(&rpc.Status.Conditions, s.AsCondition())
+	}
+}
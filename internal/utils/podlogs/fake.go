@@ -0,0 +1,53 @@
+package podlogs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// FakeReader is a Reader returning static logs, to be used in tests
+type FakeReader struct {
+	mu sync.Mutex
+
+	// Logs maps the name of a pod to its logs
+	Logs map[string]string
+	// Err, if set, is returned by every call
+	Err error
+}
+
+var _ Reader = &FakeReader{}
+
+// NewFakeReader returns a fake reader without any logs
+func NewFakeReader() *FakeReader {
+	return &FakeReader{Logs: map[string]string{}}
+}
+
+// SetLogs sets the logs of the pod
+func (f *FakeReader) SetLogs(podName string, logs string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Logs[podName] = logs
+}
+
+func (f *FakeReader) Tail(_ context.Context, pod *corev1.Pod, _ string, lines int64) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	logs, ok := f.Logs[pod.Name]
+	if !ok {
+		return nil, fmt.Errorf("pod %s has no logs", pod.Name)
+	}
+
+	all := bytes.Split(bytes.TrimSuffix([]byte(logs), []byte("\n")), []byte("\n"))
+	if int64(len(all)) > lines {
+		all = all[int64(len(all))-lines:]
+	}
+	return bytes.Join(all, []byte("\n")), nil
+}
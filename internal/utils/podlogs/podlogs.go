@@ -0,0 +1,32 @@
+// Package podlogs reads the logs of the containers of a pod
+package podlogs
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Reader reads the logs of the containers of a pod
+type Reader interface {
+	// Tail returns the last `lines` lines of the logs of the container of the pod
+	Tail(ctx context.Context, pod *corev1.Pod, container string, lines int64) ([]byte, error)
+}
+
+// apiReader is the Reader going through the pods/log subresource of the API server
+type apiReader struct {
+	kubeInterface kubernetes.Interface
+}
+
+// NewReader returns a Reader using the pods/log subresource
+func NewReader(kubeInterface kubernetes.Interface) Reader {
+	return &apiReader{kubeInterface: kubeInterface}
+}
+
+func (r *apiReader) Tail(ctx context.Context, pod *corev1.Pod, container string, lines int64) ([]byte, error) {
+	return r.kubeInterface.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: container,
+		TailLines: &lines,
+	}).DoRaw(ctx)
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// FakeNodeHealthClient is a NodeHealthClient returning static answers, to be used in tests
+type FakeNodeHealthClient struct {
+	mu sync.Mutex
+
+	// Ready is the answer of IsReady
+	Ready bool
+	// Synced is the answer of IsSynced
+	Synced bool
+	// MetricsData is the answer of Metrics
+	MetricsData []byte
+	// Results maps a JSON-RPC method to its result, as it would be encoded by the node
+	Results map[string]any
+	// Err, if set, is returned by every call
+	Err error
+
+	// Calls records the JSON-RPC methods called, in order
+	Calls []string
+}
+
+var _ NodeHealthClient = &FakeNodeHealthClient{}
+
+// NewFakeNodeHealthClient returns a fake client for a node that is ready and reports the given sync status
+func NewFakeNodeHealthClient(currentBlock, highestBlock int64) *FakeNodeHealthClient {
+	fake := &FakeNodeHealthClient{
+		Ready:   true,
+		Results: map[string]any{},
+	}
+	fake.SetSyncStatus(currentBlock, highestBlock)
+	return fake
+}
+
+// SetSyncStatus changes the answers of `starknet_syncing` and `starknet_blockNumber`
+func (f *FakeNodeHealthClient) SetSyncStatus(currentBlock, highestBlock int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Results == nil {
+		f.Results = map[string]any{}
+	}
+
+	f.Synced = currentBlock >= highestBlock
+	f.Results["starknet_blockNumber"] = currentBlock
+	if f.Synced {
+		f.Results["starknet_syncing"] = false
+	} else {
+		f.Results["starknet_syncing"] = syncingResult{
+			CurrentBlockNum: currentBlock,
+			HighestBlockNum: highestBlock,
+		}
+	}
+}
+
+func (f *FakeNodeHealthClient) IsReady(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Ready, f.Err
+}
+
+func (f *FakeNodeHealthClient) IsSynced(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Synced, f.Err
+}
+
+func (f *FakeNodeHealthClient) Metrics(ctx context.Context, pod *corev1.Pod) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.MetricsData, f.Err
+}
+
+func (f *FakeNodeHealthClient) Call(ctx context.Context, pod *corev1.Pod, method string, result any, params ...any) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Calls = append(f.Calls, method)
+	if f.Err != nil {
+		return f.Err
+	}
+
+	answer, ok := f.Results[method]
+	if !ok {
+		return &JSONRPCError{Code: -32601, Message: fmt.Sprintf("Method not found: %s", method)}
+	}
+
+	// Go through JSON, as the real client would
+	raw, err := json.Marshal(answer)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, result)
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// rpcPath is the path of the JSON-RPC endpoint of pathfinder (defaults to the latest supported version)
+const rpcPath = "/"
+
+type jsonRPCRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+type jsonRPCResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *JSONRPCError   `json:"error,omitempty"`
+}
+
+// JSONRPCError is an error returned by the node itself
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+// SyncStatus is the sync status of the node, as reported by `starknet_syncing`
+type SyncStatus struct {
+	// Syncing is false once the node is at the head of the chain
+	Syncing bool
+	// CurrentBlock is the latest block processed by the node
+	CurrentBlock int64
+	// HighestBlock is the highest block known by the node
+	HighestBlock int64
+}
+
+type syncingResult struct {
+	StartingBlockNum int64 `json:"starting_block_num"`
+	CurrentBlockNum  int64 `json:"current_block_num"`
+	HighestBlockNum  int64 `json:"highest_block_num"`
+}
+
+func (c *podProxyClient) Call(ctx context.Context, pod *corev1.Pod, method string, result any, params ...any) error {
+	if params == nil {
+		params = []any{}
+	}
+	body, err := json.Marshal(jsonRPCRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	name, err := proxyName(pod, RPCPortName)
+	if err != nil {
+		return err
+	}
+
+	raw, err := c.kubeInterface.CoreV1().RESTClient().Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		SubResource("proxy").
+		Name(name).
+		Suffix(rpcPath).
+		SetHeader("Content-Type", "application/json").
+		Body(body).
+		DoRaw(ctx)
+	if err != nil {
+		return err
+	}
+
+	var response jsonRPCResponse
+	if err := json.Unmarshal(raw, &response); err != nil {
+		return fmt.Errorf("invalid json-rpc response for %s: %w", method, err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
+
+// BlockNumber returns the latest block number known by the node (`starknet_blockNumber`)
+func BlockNumber(ctx context.Context, healthClient NodeHealthClient, pod *corev1.Pod) (int64, error) {
+	var blockNumber int64
+	if err := healthClient.Call(ctx, pod, "starknet_blockNumber", &blockNumber); err != nil {
+		return 0, err
+	}
+	return blockNumber, nil
+}
+
+// Syncing returns the sync status of the node (`starknet_syncing`).
+//
+// When the node reports that it is not syncing, the current block is fetched
+// with `starknet_blockNumber` so that the returned status is always complete.
+func Syncing(ctx context.Context, healthClient NodeHealthClient, pod *corev1.Pod) (*SyncStatus, error) {
+	var raw json.RawMessage
+	if err := healthClient.Call(ctx, pod, "starknet_syncing", &raw); err != nil {
+		return nil, err
+	}
+
+	// The result is either `false`, or an object describing the sync progress
+	var syncing bool
+	if err := json.Unmarshal(raw, &syncing); err == nil {
+		blockNumber, err := BlockNumber(ctx, healthClient, pod)
+		if err != nil {
+			return nil, err
+		}
+		return &SyncStatus{
+			Syncing:      false,
+			CurrentBlock: blockNumber,
+			HighestBlock: blockNumber,
+		}, nil
+	}
+
+	var result syncingResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("invalid starknet_syncing result: %w", err)
+	}
+
+	return &SyncStatus{
+		Syncing:      result.CurrentBlockNum < result.HighestBlockNum,
+		CurrentBlock: result.CurrentBlockNum,
+		HighestBlock: result.HighestBlockNum,
+	}, nil
+}
@@ -22,68 +22,119 @@ package proxy
 
 import (
 	"context"
+	"fmt"
 	"strconv"
+	"strings"
 
-	"github.com/runelabs-xyz/starknet-operators/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/client-go/kubernetes"
-	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-func getNamedPort(pod *corev1.Pod, name string) int {
-	for _, port := range pod.Spec.Containers[0].Ports {
-		if port.Name == name {
-			return int(port.ContainerPort)
+const (
+	// RPCPortName is the name of the container port serving the JSON-RPC API
+	RPCPortName = "rpc"
+	// MonitoringPortName is the name of the container port serving the health and metrics endpoints
+	MonitoringPortName = "monitoring"
+)
+
+// NodeHealthClient queries the health of a pathfinder node running in a pod
+type NodeHealthClient interface {
+	// IsReady returns true if the node answers on its `/ready` endpoint
+	IsReady(ctx context.Context, pod *corev1.Pod) (bool, error)
+	// IsSynced returns true if the node answers on its `/ready/synced` endpoint
+	IsSynced(ctx context.Context, pod *corev1.Pod) (bool, error)
+	// Metrics returns the raw prometheus metrics exposed by the node
+	Metrics(ctx context.Context, pod *corev1.Pod) ([]byte, error)
+	// Call makes a JSON-RPC call to the node, and decodes its result into `result`
+	Call(ctx context.Context, pod *corev1.Pod, method string, result any, params ...any) error
+}
+
+// podProxyClient is the NodeHealthClient going through the pods/proxy subresource of the API server
+type podProxyClient struct {
+	kubeInterface kubernetes.Interface
+}
+
+// NewNodeHealthClient returns a NodeHealthClient using the pods/proxy subresource
+func NewNodeHealthClient(kubeInterface kubernetes.Interface) NodeHealthClient {
+	return &podProxyClient{kubeInterface: kubeInterface}
+}
+
+// getNamedPort finds the container port with the given name, in any container of the pod
+func getNamedPort(pod *corev1.Pod, name string) (*corev1.ContainerPort, error) {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == name {
+				return &port, nil
+			}
 		}
 	}
-	return 0
+	return nil, fmt.Errorf("pod %s has no port named %q", pod.Name, name)
+}
+
+// getScheme returns the scheme used to talk to the given port.
+//
+// Pathfinder only serves plain HTTP, unless the port is explicitly named after https.
+func getScheme(port *corev1.ContainerPort) string {
+	if port.Name == "https" || strings.HasPrefix(port.Name, "https-") {
+		return "https"
+	}
+	return "http"
+}
+
+// proxyName returns the name used to reach the named port of the pod through the proxy subresource
+func proxyName(pod *corev1.Pod, portName string) (string, error) {
+	port, err := getNamedPort(pod, portName)
+	if err != nil {
+		return "", err
+	}
+	return utilnet.JoinSchemeNamePort(getScheme(port), pod.Name, strconv.Itoa(int(port.ContainerPort))), nil
 }
 
-func IsReady(ctx context.Context, kubeInterface kubernetes.Interface, rpc *v1alpha1.StarknetRPC, pod *corev1.Pod) (bool, error) {
+func (c *podProxyClient) get(ctx context.Context, pod *corev1.Pod, portName string, path string) ([]byte, error) {
+	name, err := proxyName(pod, portName)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.kubeInterface.CoreV1().RESTClient().Get().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		SubResource("proxy").
+		Name(name).
+		Suffix(path).
+		DoRaw(ctx)
+}
+
+// isUp calls a health endpoint of the node, and returns false when the node answers that
+// it is not ready, or when it is not listening yet.
+func (c *podProxyClient) isUp(ctx context.Context, pod *corev1.Pod, path string) (bool, error) {
 	if pod.Status.Phase != corev1.PodRunning {
 		// If the pod is not running, it is not ready
 		return false, nil
 	}
-	// Find named port "management"
-	port := strconv.Itoa(getNamedPort(pod, "management"))
-	schema := "http"
-	if pod.Spec.Containers[0].Ports[0].Protocol == corev1.ProtocolTCP {
-		schema = "https"
-	}
 
-	req := kubeInterface.CoreV1().Pods(pod.Namespace).ProxyGet(
-		schema, pod.Name, port, "/ready", map[string]string{})
-
-	_, err := req.DoRaw(ctx)
+	_, err := c.get(ctx, pod, MonitoringPortName, path)
 	if err != nil {
 		if errors.IsBadRequest(err) || errors.IsServiceUnavailable(err) {
 			// This is possible that the pod hasn't been started yet
 			return false, nil
 		}
-		log.FromContext(ctx).Error(err, "Failed to get ready status", "reason", errors.ReasonForError(err))
 		return false, err
 	}
 
 	return true, nil
 }
 
-func IsSynced(ctx context.Context, kubeInterface kubernetes.Interface, rpc *v1alpha1.StarknetRPC, pod *corev1.Pod) (bool, error) {
-	// Find named port "management"
-	port := strconv.Itoa(getNamedPort(pod, "management"))
-	schema := "http"
-	if pod.Spec.Containers[0].Ports[0].Protocol == corev1.ProtocolTCP {
-		schema = "https"
-	}
-
-	req := kubeInterface.CoreV1().Pods(pod.Namespace).ProxyGet(
-		schema, pod.Name, port, "/ready/synced", map[string]string{})
+func (c *podProxyClient) IsReady(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	return c.isUp(ctx, pod, "/ready")
+}
 
-	_, err := req.DoRaw(ctx)
-	if err != nil {
-		log.FromContext(ctx).Error(err, "Failed to get ready status")
-		return false, err
-	}
+func (c *podProxyClient) IsSynced(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	return c.isUp(ctx, pod, "/ready/synced")
+}
 
-	return true, nil
+func (c *podProxyClient) Metrics(ctx context.Context, pod *corev1.Pod) ([]byte, error) {
+	return c.get(ctx, pod, MonitoringPortName, "/metrics")
 }
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Pod proxy", func() {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-rpc"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "pathfinder",
+					Ports: []corev1.ContainerPort{
+						{Name: RPCPortName, ContainerPort: 9545},
+						{Name: MonitoringPortName, ContainerPort: 9000},
+					},
+				},
+				{
+					Name: "sidecar",
+					Ports: []corev1.ContainerPort{
+						{Name: "https-metrics", ContainerPort: 8443},
+					},
+				},
+			},
+		},
+	}
+
+	DescribeTable("Resolving a named port",
+		func(name string, containerPort int32) {
+			port, err := getNamedPort(pod, name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(port.Name).To(Equal(name))
+			Expect(port.ContainerPort).To(Equal(containerPort))
+		},
+		Entry("the JSON-RPC port", RPCPortName, int32(9545)),
+		Entry("the monitoring port", MonitoringPortName, int32(9000)),
+		Entry("a port of another container", "https-metrics", int32(8443)),
+	)
+
+	It("Should fail to resolve a missing port", func() {
+		_, err := getNamedPort(pod, "websocket")
+		Expect(err).To(MatchError(`pod node-rpc has no port named "websocket"`))
+	})
+
+	DescribeTable("Selecting the scheme of a port",
+		func(name string, scheme string) {
+			Expect(getScheme(&corev1.ContainerPort{Name: name})).To(Equal(scheme))
+		},
+		Entry("a plain port", RPCPortName, "http"),
+		Entry("a port named https", "https", "https"),
+		Entry("a port prefixed with https-", "https-metrics", "https"),
+		Entry("a port merely containing https", "metrics-https", "http"),
+		Entry("an unnamed port", "", "http"),
+	)
+
+	DescribeTable("Building the proxy name of a port",
+		func(name string, expected string) {
+			proxied, err := proxyName(pod, name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(proxied).To(Equal(expected))
+		},
+		Entry("a plain port", MonitoringPortName, "http:node-rpc:9000"),
+		Entry("an https port", "https-metrics", "https:node-rpc:8443"),
+	)
+})
@@ -0,0 +1,14 @@
+package proxy
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestProxy(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Proxy Suite")
+}
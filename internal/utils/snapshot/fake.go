@@ -0,0 +1,24 @@
+package snapshot
+
+import "context"
+
+// FakeResolver is a Resolver selecting snapshots from a static index, to be used in tests
+type FakeResolver struct {
+	// Index is the index used instead of the one at the requested URL
+	Index Index
+	// Err, if set, is returned by every call
+	Err error
+
+	// Requests records the index URLs requested, in order
+	Requests []string
+}
+
+var _ Resolver = &FakeResolver{}
+
+func (f *FakeResolver) Resolve(ctx context.Context, indexURL string, network string, versionRange string) (*Snapshot, error) {
+	f.Requests = append(f.Requests, indexURL)
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return Select(&f.Index, network, versionRange)
+}
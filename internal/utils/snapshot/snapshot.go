@@ -0,0 +1,140 @@
+// Package snapshot resolves the pathfinder database snapshots to restore from a snapshot index
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/blang/semver/v4"
+)
+
+// ErrNoSnapshot is returned when no snapshot of the index matches the request
+var ErrNoSnapshot = errors.New("no matching snapshot found in the index")
+
+// defaultTimeout is the timeout used to fetch the index when no HTTP client is provided
+const defaultTimeout = 30 * time.Second
+
+// Snapshot is a database snapshot, as described by the index
+type Snapshot struct {
+	// Network is the network of the database (e.g. mainnet, sepolia-testnet)
+	Network string `json:"network"`
+	// FileName is the name of the snapshot file in the bucket
+	FileName string `json:"fileName"`
+	// Checksum is the sha256 checksum of the snapshot file
+	Checksum string `json:"checksum"`
+	// Size is the size of the (compressed) snapshot file, in bytes
+	Size int64 `json:"size,omitempty"`
+	// ExtractedSize is the size of the database once extracted, in bytes
+	ExtractedSize int64 `json:"extractedSize,omitempty"`
+	// BlockHeight is the latest block contained in the snapshot
+	BlockHeight int64 `json:"blockHeight,omitempty"`
+	// Version is the pathfinder version that created the snapshot
+	Version string `json:"version,omitempty"`
+}
+
+// Index is the list of the snapshots available for download
+type Index struct {
+	Snapshots []Snapshot `json:"snapshots"`
+}
+
+// Resolver finds the snapshot to restore for a network
+type Resolver interface {
+	// Resolve returns the most recent snapshot of the index at `indexURL` for the network,
+	// whose version satisfies `versionRange` (if not empty)
+	Resolve(ctx context.Context, indexURL string, network string, versionRange string) (*Snapshot, error)
+}
+
+// httpResolver is the Resolver fetching the index over HTTP
+type httpResolver struct {
+	client *http.Client
+}
+
+// NewResolver returns a Resolver fetching the index over HTTP with the given client
+func NewResolver(client *http.Client) Resolver {
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	return &httpResolver{client: client}
+}
+
+func (r *httpResolver) Resolve(ctx context.Context, indexURL string, network string, versionRange string) (*Snapshot, error) {
+	index, err := r.fetchIndex(ctx, indexURL)
+	if err != nil {
+		return nil, err
+	}
+	return Select(index, network, versionRange)
+}
+
+func (r *httpResolver) fetchIndex(ctx context.Context, indexURL string) (*Index, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, indexURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the snapshot index: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch the snapshot index: unexpected status %s", res.Status)
+	}
+
+	index := &Index{}
+	if err := json.NewDecoder(res.Body).Decode(index); err != nil {
+		return nil, fmt.Errorf("failed to decode the snapshot index: %w", err)
+	}
+	return index, nil
+}
+
+// Select returns the snapshot of the index with the highest block for the network, whose
+// version satisfies `versionRange` (e.g. ">=0.16.0 <0.17.0"). Ties are broken by the highest version.
+func Select(index *Index, network string, versionRange string) (*Snapshot, error) {
+	var matches func(semver.Version) bool
+	if versionRange != "" {
+		r, err := semver.ParseRange(versionRange)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version range %q: %w", versionRange, err)
+		}
+		matches = r
+	}
+
+	var (
+		best        *Snapshot
+		bestVersion semver.Version
+	)
+	for i := range index.Snapshots {
+		candidate := &index.Snapshots[i]
+		if candidate.Network != network || candidate.FileName == "" || candidate.Checksum == "" {
+			continue
+		}
+
+		version, err := semver.ParseTolerant(candidate.Version)
+		if matches != nil && (err != nil || !matches(version)) {
+			continue
+		}
+
+		if best == nil ||
+			candidate.BlockHeight > best.BlockHeight ||
+			(candidate.BlockHeight == best.BlockHeight && version.GT(bestVersion)) {
+			best = candidate
+			bestVersion = version
+		}
+	}
+
+	if best == nil {
+		if versionRange != "" {
+			return nil, fmt.Errorf("%w for network %s and version %s", ErrNoSnapshot, network, versionRange)
+		}
+		return nil, fmt.Errorf("%w for network %s", ErrNoSnapshot, network)
+	}
+
+	snapshot := *best
+	return &snapshot, nil
+}